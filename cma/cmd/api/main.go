@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -15,8 +17,10 @@ import (
 	"github.com/hibiken/asynq"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/redis/go-redis/v9"
+	openai "github.com/sashabaranov/go-openai"
 
 	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/chat"
 	"github.com/memora/cma/internal/consolidation"
 	"github.com/memora/cma/internal/dig"
 	"github.com/memora/cma/internal/graphstore"
@@ -63,111 +67,165 @@ func main() {
 	m := metrics.New()
 
 	// --- Infrastructure: Qdrant (Episodic Memory / Hippocampus) ---
-	qdrantStore, err := vectorstore.NewQdrantStore(cfg.Qdrant)
+	// qdrant.backend selects between Qdrant and the in-process store.
+	vectorDB, err := vectorstore.New(cfg.Qdrant)
 	if err != nil {
-		slog.Error("qdrant connection failed", "error", err)
+		slog.Error("vector store connection failed", "backend", cfg.Qdrant.Backend, "error", err)
 		os.Exit(1)
 	}
-	defer qdrantStore.Close()
+	defer vectorDB.Close()
 
-	if err := qdrantStore.EnsureCollection(ctx); err != nil {
-		slog.Error("qdrant collection setup failed", "error", err)
+	if err := vectorDB.EnsureCollection(ctx); err != nil {
+		slog.Error("vector store collection setup failed", "backend", cfg.Qdrant.Backend, "error", err)
 		os.Exit(1)
 	}
 
 	// --- Infrastructure: Neo4j (Semantic Memory / Neocortex) ---
-	neo4jStore, err := graphstore.NewNeo4jStore(cfg.Neo4j)
+	// neo4j.backend selects between Neo4j and the in-process graph.
+	graphDB, err := graphstore.New(cfg.Neo4j)
 	if err != nil {
-		slog.Error("neo4j connection failed", "error", err)
+		slog.Error("graph store connection failed", "backend", cfg.Neo4j.Backend, "error", err)
 		os.Exit(1)
 	}
-	defer neo4jStore.Close(ctx)
+	defer graphDB.Close(ctx)
 
-	if err := neo4jStore.EnsureSchema(ctx); err != nil {
-		slog.Error("neo4j schema setup failed", "error", err)
+	if err := graphDB.EnsureSchema(ctx); err != nil {
+		slog.Error("graph store schema setup failed", "backend", cfg.Neo4j.Backend, "error", err)
 		os.Exit(1)
 	}
 
 	// --- Infrastructure: Redis ---
-	redisClient := redis.NewClient(&redis.Options{
+	// Redis backs the stores configured with a redis backend and the asynq
+	// consolidation queue. With every store in memory the server needs no
+	// Redis and consolidates in-process.
+	var redisClient *redis.Client
+	var asynqClient *asynq.Client
+	redisOpt := asynq.RedisClientOpt{
 		Addr:     cfg.Redis.Addr,
 		Password: cfg.Redis.Password,
 		DB:       cfg.Redis.DB,
-	})
-	defer redisClient.Close()
-
-	if err := redisClient.Ping(ctx).Err(); err != nil {
-		slog.Error("redis connection failed", "error", err)
-		os.Exit(1)
 	}
+	if cfg.UsesRedis() {
+		redisClient = redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		defer redisClient.Close()
 
-	// --- Infrastructure: Asynq ---
-	asynqClient := asynq.NewClient(asynq.RedisClientOpt{
-		Addr:     cfg.Redis.Addr,
-		Password: cfg.Redis.Password,
-		DB:       cfg.Redis.DB,
-	})
-	defer asynqClient.Close()
+		if err := redisClient.Ping(ctx).Err(); err != nil {
+			slog.Error("redis connection failed", "error", err)
+			os.Exit(1)
+		}
+
+		// --- Infrastructure: Asynq ---
+		asynqClient = asynq.NewClient(redisOpt)
+		defer asynqClient.Close()
+	} else {
+		slog.Info("no redis backends configured, consolidating in-process")
+	}
 
 	// --- LLM Provider ---
-	llmProvider := llm.NewOpenAIProvider(cfg.LLM)
+	llmProvider, err := llm.NewProvider(cfg.LLM)
+	if err != nil {
+		slog.Error("llm provider setup failed", "provider", cfg.LLM.Provider, "error", err)
+		os.Exit(1)
+	}
 
 	// --- Domain Services ---
 
-	// Segmentation engine (Bayesian Surprise).
-	surprisalEngine := segmentation.NewSurprisalEngine(llmProvider, cfg.Segmentation)
+	// Segmentation engine (Bayesian Surprise by default, per-tenant strategies).
+	segStats, err := segmentation.NewStatsStore(cfg.Segmentation, redisClient)
+	if err != nil {
+		slog.Error("segmentation stats setup failed", "backend", cfg.Segmentation.StatsBackend, "error", err)
+		os.Exit(1)
+	}
+	segmenter, err := segmentation.New(llmProvider, segStats, cfg.Segmentation)
+	if err != nil {
+		slog.Error("segmentation setup failed", "strategy", cfg.Segmentation.Strategy, "error", err)
+		os.Exit(1)
+	}
 
 	// Ingest pipeline (append-only episodic writes).
-	ingestSvc := ingest.NewService(surprisalEngine, qdrantStore, m)
+	ingestSvc := ingest.NewService(segmenter, vectorDB, m)
 
 	// Retrieval service (concurrent vector + graph).
-	retrievalSvc := retrieval.NewService(qdrantStore, neo4jStore, llmProvider, cfg.Retrieval, m)
+	retrievalSvc := retrieval.NewService(vectorDB, graphDB, llmProvider, cfg.Retrieval, m)
 
-	// DIG reranker.
-	digReranker := dig.NewReranker(llmProvider, cfg.DIG)
+	// DIG reranker: the configured scorer behind a (query, document) score cache.
+	digCache, err := dig.NewCache(cfg.DIG, redisClient)
+	if err != nil {
+		slog.Error("dig cache setup failed", "backend", cfg.DIG.CacheBackend, "error", err)
+		os.Exit(1)
+	}
+	digScorer, err := dig.NewScorer(cfg.DIG, llmProvider)
+	if err != nil {
+		slog.Error("dig scorer setup failed", "scorer", cfg.DIG.Scorer, "error", err)
+		os.Exit(1)
+	}
+	// Per-tenant calibration of DIG scores from feedback.
+	feedbackStore, err := dig.NewFeedbackStore(cfg.DIG.Calibration, redisClient)
+	if err != nil {
+		slog.Error("dig feedback store setup failed", "backend", cfg.DIG.Calibration.Backend, "error", err)
+		os.Exit(1)
+	}
+	digCalibrator := dig.NewCalibrator(feedbackStore, cfg.DIG.Calibration)
+	digReranker := dig.NewReranker(digScorer, digCache, digCalibrator, cfg.DIG)
 
-	// Knapsack optimizer.
-	knapsackOpt := knapsack.NewOptimizer(cfg.Knapsack)
+	// Knapsack optimizer, weighing items with the chat model's tokenizer.
+	knapsackOpt := knapsack.NewOptimizer(cfg.Knapsack, llmProvider.Tokenizer())
+
+	// Phonological loop (recent raw turns per conversation).
+	turnStore, err := workspace.NewTurnStore(cfg.Workspace, redisClient)
+	if err != nil {
+		slog.Error("turn store setup failed", "backend", cfg.Workspace.TurnBackend, "error", err)
+		os.Exit(1)
+	}
 
 	// Cognitive workspace (full read path).
-	ws := workspace.NewWorkspace(retrievalSvc, digReranker, knapsackOpt, cfg.Knapsack, m)
+	ws := workspace.NewWorkspace(retrievalSvc, digReranker, knapsackOpt, turnStore, llmProvider.Tokenizer(), cfg.Knapsack, m)
+
+	// Memory-augmented chat: workspace context → LLM answer → ingest.
+	chatSvc := chat.NewService(ws, ingestSvc, llmProvider, cfg.Chat)
 
 	// Consolidation engine (Sleep cycle).
 	dbscan := consolidation.NewDBSCAN(cfg.Consolidation.DBSCANEpsilon, cfg.Consolidation.DBSCANMinPoints)
-	conflictResolver := consolidation.NewConflictResolver(neo4jStore, cfg.Consolidation.DecayRate)
-	consolWorker := consolidation.NewWorker(qdrantStore, llmProvider, dbscan, conflictResolver, cfg.Consolidation, m)
+	conflictResolver := consolidation.NewConflictResolver(graphDB, cfg.Consolidation.DecayRate)
+	consolWorker := consolidation.NewWorker(vectorDB, llmProvider, dbscan, conflictResolver, cfg.Consolidation, m)
 
 	// Consolidation scheduler.
-	consolScheduler := consolidation.NewScheduler(consolWorker, qdrantStore, asynqClient, redisClient, cfg.Consolidation)
+	consolScheduler := consolidation.NewScheduler(consolWorker, vectorDB, asynqClient, redisClient, cfg.Consolidation)
 
 	// --- Asynq Worker Server ---
-	asynqSrv := asynq.NewServer(
-		asynq.RedisClientOpt{
-			Addr:     cfg.Redis.Addr,
-			Password: cfg.Redis.Password,
-			DB:       cfg.Redis.DB,
-		},
-		asynq.Config{
-			Concurrency: cfg.Consolidation.WorkerConcurrency,
-			Queues: map[string]int{
-				"consolidation": 10,
-				"default":       5,
+	var asynqSrv *asynq.Server
+	if asynqClient != nil {
+		asynqSrv = asynq.NewServer(
+			redisOpt,
+			asynq.Config{
+				Concurrency: cfg.Consolidation.WorkerConcurrency,
+				Queues: map[string]int{
+					"consolidation": 10,
+					"default":       5,
+				},
 			},
-		},
-	)
+		)
 
-	mux := asynq.NewServeMux()
-	consolWorker.RegisterHandler(mux)
+		mux := asynq.NewServeMux()
+		consolWorker.RegisterHandler(mux)
 
-	go func() {
-		if err := asynqSrv.Start(mux); err != nil {
-			slog.Error("asynq server failed", "error", err)
-		}
-	}()
+		go func() {
+			if err := asynqSrv.Start(mux); err != nil {
+				slog.Error("asynq server failed", "error", err)
+			}
+		}()
+	}
 
 	// Start consolidation scheduler.
 	go consolScheduler.Start(ctx)
 
+	// Start DIG calibration refits.
+	go digCalibrator.Start(ctx)
+
 	// --- HTTP Server (Gin) ---
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
@@ -193,7 +251,9 @@ func main() {
 		}
 
 		// Check Redis health.
-		if err := redisClient.Ping(c.Request.Context()).Err(); err != nil {
+		if redisClient == nil {
+			services["redis"] = "unused"
+		} else if err := redisClient.Ping(c.Request.Context()).Err(); err != nil {
 			services["redis"] = "error: " + err.Error()
 		}
 
@@ -208,6 +268,76 @@ func main() {
 	// Prometheus metrics.
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
+	// OpenAI-compatible chat completions: any OpenAI client pointed at
+	// this server gets the user's memories injected transparently.
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		var req openai.ChatCompletionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, openAIError(err.Error(), "invalid_request_error"))
+			return
+		}
+
+		// The tenant header takes precedence over the request's user field.
+		userID := c.GetString("tenant_id")
+		if userID == "" {
+			userID = req.User
+		}
+		if userID == "" {
+			c.JSON(http.StatusBadRequest, openAIError("set the X-Tenant-ID header or the user field", "invalid_request_error"))
+			return
+		}
+
+		// Record activity.
+		consolScheduler.RecordActivity(userID)
+
+		if !req.Stream {
+			resp, err := chatSvc.Complete(c.Request.Context(), userID, req)
+			if errors.Is(err, chat.ErrNoUserMessage) {
+				c.JSON(http.StatusBadRequest, openAIError(err.Error(), "invalid_request_error"))
+				return
+			}
+			if err != nil {
+				slog.Error("chat completion failed", "user_id", userID, "error", err)
+				c.JSON(http.StatusInternalServerError, openAIError("chat completion failed", "server_error"))
+				return
+			}
+			c.JSON(http.StatusOK, resp)
+			return
+		}
+
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+		streamed := false
+		err := chatSvc.CompleteStream(c.Request.Context(), userID, req, func(chunk openai.ChatCompletionStreamResponse) error {
+			data, err := json.Marshal(chunk)
+			if err != nil {
+				return err
+			}
+			if !streamed {
+				streamed = true
+				c.Header("Content-Type", "text/event-stream")
+			}
+			fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+			c.Writer.Flush()
+			return c.Request.Context().Err()
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, chat.ErrNoUserMessage):
+				c.JSON(http.StatusBadRequest, openAIError(err.Error(), "invalid_request_error"))
+			case !streamed:
+				slog.Error("chat completion failed", "user_id", userID, "error", err)
+				c.JSON(http.StatusInternalServerError, openAIError("chat completion failed", "server_error"))
+			default:
+				slog.Error("chat completion stream failed", "user_id", userID, "error", err)
+				data, _ := json.Marshal(openAIError("chat completion failed", "server_error"))
+				fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+			}
+			return
+		}
+		fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	})
+
 	// API v1 group.
 	v1 := router.Group("/api/v1")
 	{
@@ -223,9 +353,11 @@ func main() {
 			consolScheduler.RecordActivity(req.UserID)
 
 			// Add turn to workspace phonological loop.
-			ws.AddTurn(req.UserID, req.Role, req.Content)
+			if err := ws.AddTurn(c.Request.Context(), req.UserID, req.SessionID, req.Role, req.Content); err != nil {
+				slog.Warn("add turn failed", "user_id", req.UserID, "error", err)
+			}
 
-			resp, err := ingestSvc.Ingest(c.Request.Context(), req.UserID, req.Content, req.Role)
+			resp, err := ingestSvc.Ingest(c.Request.Context(), req)
 			if err != nil {
 				slog.Error("ingest failed", "error", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "ingest failed"})
@@ -256,6 +388,83 @@ func main() {
 			c.JSON(http.StatusOK, resp)
 		})
 
+		// Chat endpoint — answers from memory, streamed as server-sent
+		// events: "delta" chunks of the answer, then "done" with the full
+		// answer and its citations, or "error".
+		v1.POST("/chat", func(c *gin.Context) {
+			var req models.ChatRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			// Record activity.
+			consolScheduler.RecordActivity(req.UserID)
+
+			c.Header("Cache-Control", "no-cache")
+			c.Header("X-Accel-Buffering", "no")
+			streamed := false
+			resp, err := chatSvc.Chat(c.Request.Context(), req, func(delta string) error {
+				streamed = true
+				c.SSEvent("delta", gin.H{"content": delta})
+				c.Writer.Flush()
+				return c.Request.Context().Err()
+			})
+			if err != nil {
+				slog.Error("chat failed", "user_id", req.UserID, "error", err)
+				if !streamed {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "chat failed"})
+					return
+				}
+				c.SSEvent("error", gin.H{"error": "chat failed"})
+				return
+			}
+
+			c.SSEvent("done", resp)
+		})
+
+		// Feedback endpoint — which memories of a query's context helped,
+		// for per-tenant DIG calibration.
+		v1.POST("/feedback", func(c *gin.Context) {
+			var req models.FeedbackRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			n, err := digCalibrator.Record(c.Request.Context(), req)
+			if err != nil {
+				slog.Error("feedback failed", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "feedback failed"})
+				return
+			}
+
+			c.JSON(http.StatusAccepted, gin.H{"recorded": n})
+		})
+
+		// DIG Calibration Endpoint: the tenant's fit for a scorer (default: the active one).
+		v1.GET("/dig/calibration", func(c *gin.Context) {
+			userID := c.Query("user_id")
+			if userID == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "user_id required"})
+				return
+			}
+			scorer := c.DefaultQuery("scorer", digScorer.Name())
+
+			cal, err := digCalibrator.Calibration(c.Request.Context(), userID, scorer)
+			if err != nil {
+				slog.Error("dig calibration fetch failed", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "fetch failed"})
+				return
+			}
+			if cal == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "not calibrated"})
+				return
+			}
+
+			c.JSON(http.StatusOK, cal)
+		})
+
 		// Hippocampus Stats Endpoint.
 		v1.GET("/hippocampus", func(c *gin.Context) {
 			userID := c.Query("user_id")
@@ -264,16 +473,28 @@ func main() {
 				return
 			}
 
-			episodes, err := qdrantStore.GetRecent(c.Request.Context(), userID, 50)
+			episodes, err := vectorDB.GetRecent(c.Request.Context(), userID, 50)
 			if err != nil {
 				slog.Error("hippocampus fetch failed", "error", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "fetch failed"})
 				return
 			}
 
+			// Current μ, σ and boundary threshold; null for strategies without one.
+			var boundary *segmentation.BoundaryStats
+			if reporter, ok := segmenter.(segmentation.StatsReporter); ok {
+				boundary, err = reporter.BoundaryStats(c.Request.Context(), userID)
+				if err != nil {
+					slog.Error("segmentation stats fetch failed", "error", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "fetch failed"})
+					return
+				}
+			}
+
 			c.JSON(http.StatusOK, gin.H{
-				"episodes": episodes,
-				"stats":    gin.H{"total": len(episodes)}, // Placeholder for total count if expensive
+				"episodes":     episodes,
+				"stats":        gin.H{"total": len(episodes)}, // Placeholder for total count if expensive
+				"segmentation": boundary,
 			})
 		})
 
@@ -285,7 +506,7 @@ func main() {
 				return
 			}
 
-			stats, err := neo4jStore.GetStats(c.Request.Context(), userID)
+			stats, err := graphDB.GetStats(c.Request.Context(), userID)
 			if err != nil {
 				slog.Error("neocortex stats failed", "error", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "fetch failed"})
@@ -301,30 +522,27 @@ func main() {
 			c.JSON(http.StatusOK, logs)
 		})
 
-		// Workspace Context Endpoint.
+		// Workspace Context Endpoint: the last knapsack decision of a conversation.
 		v1.GET("/workspace/context", func(c *gin.Context) {
-			// In a real system, this would fetch current context based on user/session.
-			// For now, we return a static/simulated context or fetch the last query.
 			userID := c.Query("user_id")
 			if userID == "" {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "user_id required"})
 				return
 			}
+			sessionID := c.Query("session_id")
+
+			selection := ws.LastSelection(userID, sessionID)
+			if selection == nil {
+				// Not queried yet: an empty workspace.
+				selection = &models.WorkspaceSelection{
+					UserID:      userID,
+					SessionID:   sessionID,
+					Items:       []models.WorkspaceItem{},
+					TokenBudget: cfg.Knapsack.TokenBudget,
+				}
+			}
 
-			// TODO: Add strict "context" retrieval from Workspace service if available.
-			// For now, let's return some stats about the workspace.
-			
-			// Mock data structure matching frontend expectations or new design
-			c.JSON(http.StatusOK, gin.H{
-				"id":           "ws_" + userID,
-				"total_tokens": 2405, // TODO: Get from metrics or state
-				"token_budget": 4096,
-				"items": []gin.H{
-					{"id": "kn_1", "content": "Query: Diff b/w Hippocampus & Neocortex", "weight": 12, "value": 0.99, "status": "kept"},
-					{"id": "kn_2", "content": "[Graph] Hippocampus -> stores -> Episodes", "weight": 45, "value": 0.85, "status": "kept"},
-					{"id": "kn_4", "content": "Prev Turn: User asked about architecture", "weight": 156, "value": 0.50, "status": "kept"},
-				},
-			})
+			c.JSON(http.StatusOK, selection)
 		})
 
 		// Admin: manually trigger consolidation.
@@ -335,24 +553,44 @@ func main() {
 				return
 			}
 
-			task, err := consolidation.NewConsolidateTask(userID)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "create task failed"})
+			taskID, err := consolScheduler.Enqueue(c.Request.Context(), userID)
+			if errors.Is(err, consolidation.ErrConsolidationRunning) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 				return
 			}
-
-			info, err := asynqClient.Enqueue(task)
 			if err != nil {
+				slog.Error("enqueue consolidation failed", "user_id", userID, "error", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "enqueue failed"})
 				return
 			}
 
 			c.JSON(http.StatusAccepted, gin.H{
 				"message": "consolidation enqueued",
-				"task_id": info.ID,
+				"task_id": taskID,
 				"user_id": userID,
 			})
 		})
+
+		// Admin: refit a tenant's DIG calibration now.
+		v1.POST("/admin/calibrate", func(c *gin.Context) {
+			userID := c.Query("user_id")
+			if userID == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "user_id required"})
+				return
+			}
+
+			fitted, err := digCalibrator.Fit(c.Request.Context(), userID)
+			if err != nil {
+				slog.Error("dig calibration failed", "user_id", userID, "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "calibration failed"})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"user_id":      userID,
+				"calibrations": fitted,
+			})
+		})
 	}
 
 	// --- Start HTTP Server ---
@@ -379,11 +617,14 @@ func main() {
 
 	slog.Info("shutting down...")
 
-	// Stop consolidation scheduler.
+	// Stop consolidation scheduler and DIG calibrator.
 	consolScheduler.Stop()
+	digCalibrator.Stop()
 
 	// Stop Asynq workers.
-	asynqSrv.Shutdown()
+	if asynqSrv != nil {
+		asynqSrv.Shutdown()
+	}
 
 	// Shutdown HTTP server with timeout.
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -503,3 +744,9 @@ func (m *MultiHandler) WithGroup(name string) slog.Handler {
 	return NewMultiHandler(handlers...)
 }
 
+// --- Helpers ---
+
+// openAIError is an error body in the OpenAI API format.
+func openAIError(message, typ string) gin.H {
+	return gin.H{"error": gin.H{"message": message, "type": typ}}
+}
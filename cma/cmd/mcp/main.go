@@ -0,0 +1,193 @@
+// Command mcp serves the memory system to agent runtimes as Model Context
+// Protocol tools over stdio or HTTP (mcp.transport). It shares the API
+// server's configuration and stores.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/consolidation"
+	"github.com/memora/cma/internal/dig"
+	"github.com/memora/cma/internal/graphstore"
+	"github.com/memora/cma/internal/ingest"
+	"github.com/memora/cma/internal/knapsack"
+	"github.com/memora/cma/internal/llm"
+	"github.com/memora/cma/internal/mcp"
+	"github.com/memora/cma/internal/metrics"
+	"github.com/memora/cma/internal/retrieval"
+	"github.com/memora/cma/internal/segmentation"
+	"github.com/memora/cma/internal/vectorstore"
+	"github.com/memora/cma/internal/workspace"
+)
+
+const version = "1.0.0"
+
+func main() {
+	// --- Configuration ---
+	cfgPath := os.Getenv("CMA_CONFIG")
+	if cfgPath == "" {
+		cfgPath = "configs/config.yaml"
+	}
+
+	// --- Logger ---
+	// stdout carries the stdio transport, so logs go to stderr.
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	cfg, err := configs.Load(cfgPath)
+	if err != nil {
+		slog.Error("failed to load config", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("CMA MCP server starting", "version", version, "transport", cfg.MCP.Transport)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	m := metrics.New()
+
+	// --- Infrastructure ---
+	vectorDB, err := vectorstore.New(cfg.Qdrant)
+	if err != nil {
+		slog.Error("vector store connection failed", "backend", cfg.Qdrant.Backend, "error", err)
+		os.Exit(1)
+	}
+	defer vectorDB.Close()
+
+	if err := vectorDB.EnsureCollection(ctx); err != nil {
+		slog.Error("vector store collection setup failed", "backend", cfg.Qdrant.Backend, "error", err)
+		os.Exit(1)
+	}
+
+	graphDB, err := graphstore.New(cfg.Neo4j)
+	if err != nil {
+		slog.Error("graph store connection failed", "backend", cfg.Neo4j.Backend, "error", err)
+		os.Exit(1)
+	}
+	defer graphDB.Close(context.Background())
+
+	if err := graphDB.EnsureSchema(ctx); err != nil {
+		slog.Error("graph store schema setup failed", "backend", cfg.Neo4j.Backend, "error", err)
+		os.Exit(1)
+	}
+
+	// Redis is only needed by the stores configured with a redis backend.
+	var redisClient *redis.Client
+	if cfg.UsesRedis() {
+		redisClient = redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		defer redisClient.Close()
+	}
+
+	llmProvider, err := llm.NewProvider(cfg.LLM)
+	if err != nil {
+		slog.Error("llm provider setup failed", "provider", cfg.LLM.Provider, "error", err)
+		os.Exit(1)
+	}
+
+	// --- Domain Services ---
+	segStats, err := segmentation.NewStatsStore(cfg.Segmentation, redisClient)
+	if err != nil {
+		slog.Error("segmentation stats setup failed", "backend", cfg.Segmentation.StatsBackend, "error", err)
+		os.Exit(1)
+	}
+	segmenter, err := segmentation.New(llmProvider, segStats, cfg.Segmentation)
+	if err != nil {
+		slog.Error("segmentation setup failed", "strategy", cfg.Segmentation.Strategy, "error", err)
+		os.Exit(1)
+	}
+	ingestSvc := ingest.NewService(segmenter, vectorDB, m)
+
+	retrievalSvc := retrieval.NewService(vectorDB, graphDB, llmProvider, cfg.Retrieval, m)
+
+	digCache, err := dig.NewCache(cfg.DIG, redisClient)
+	if err != nil {
+		slog.Error("dig cache setup failed", "backend", cfg.DIG.CacheBackend, "error", err)
+		os.Exit(1)
+	}
+	digScorer, err := dig.NewScorer(cfg.DIG, llmProvider)
+	if err != nil {
+		slog.Error("dig scorer setup failed", "scorer", cfg.DIG.Scorer, "error", err)
+		os.Exit(1)
+	}
+	// Calibrations are read as the API server fits them.
+	feedbackStore, err := dig.NewFeedbackStore(cfg.DIG.Calibration, redisClient)
+	if err != nil {
+		slog.Error("dig feedback store setup failed", "backend", cfg.DIG.Calibration.Backend, "error", err)
+		os.Exit(1)
+	}
+	digCalibrator := dig.NewCalibrator(feedbackStore, cfg.DIG.Calibration)
+	digReranker := dig.NewReranker(digScorer, digCache, digCalibrator, cfg.DIG)
+
+	knapsackOpt := knapsack.NewOptimizer(cfg.Knapsack, llmProvider.Tokenizer())
+
+	turnStore, err := workspace.NewTurnStore(cfg.Workspace, redisClient)
+	if err != nil {
+		slog.Error("turn store setup failed", "backend", cfg.Workspace.TurnBackend, "error", err)
+		os.Exit(1)
+	}
+	ws := workspace.NewWorkspace(retrievalSvc, digReranker, knapsackOpt, turnStore, llmProvider.Tokenizer(), cfg.Knapsack, m)
+
+	// The consolidate tool runs the Sleep cycle in-process, under the
+	// per-user lock the API server's scheduler takes in the same Redis.
+	dbscan := consolidation.NewDBSCAN(cfg.Consolidation.DBSCANEpsilon, cfg.Consolidation.DBSCANMinPoints)
+	conflictResolver := consolidation.NewConflictResolver(graphDB, cfg.Consolidation.DecayRate)
+	consolWorker := consolidation.NewWorker(vectorDB, llmProvider, dbscan, conflictResolver, cfg.Consolidation, m)
+	consolScheduler := consolidation.NewScheduler(consolWorker, vectorDB, nil, redisClient, cfg.Consolidation)
+
+	srv := mcp.NewServer(ingestSvc, ws, graphDB, vectorDB, consolScheduler, version, cfg.MCP)
+
+	// --- Transport ---
+	switch cfg.MCP.Transport {
+	case "stdio":
+		if err := srv.ServeStdio(ctx, os.Stdin, os.Stdout); err != nil {
+			slog.Error("MCP stdio server failed", "error", err)
+			os.Exit(1)
+		}
+
+	case "http":
+		mux := http.NewServeMux()
+		mux.Handle("/mcp", srv)
+
+		addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.MCP.Port)
+		httpSrv := &http.Server{
+			Addr:        addr,
+			Handler:     mux,
+			ReadTimeout: cfg.Server.ReadTimeout,
+			// Tool calls such as consolidate may outlast server.write_timeout.
+		}
+
+		go func() {
+			slog.Info("MCP HTTP server starting", "addr", addr, "path", "/mcp")
+			if err := httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("MCP HTTP server failed", "error", err)
+				os.Exit(1)
+			}
+		}()
+
+		<-ctx.Done()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer shutdownCancel()
+		if err := httpSrv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("MCP HTTP server shutdown error", "error", err)
+		}
+
+	default:
+		slog.Error("unknown mcp transport", "transport", cfg.MCP.Transport)
+		os.Exit(1)
+	}
+
+	slog.Info("CMA MCP server shutdown complete")
+}
@@ -16,9 +16,12 @@ type Config struct {
 	LLM           LLMConfig           `yaml:"llm"`
 	Segmentation  SegmentationConfig  `yaml:"segmentation"`
 	Knapsack      KnapsackConfig      `yaml:"knapsack"`
+	Workspace     WorkspaceConfig     `yaml:"workspace"`
 	DIG           DIGConfig           `yaml:"dig"`
 	Consolidation ConsolidationConfig `yaml:"consolidation"`
 	Retrieval     RetrievalConfig     `yaml:"retrieval"`
+	Chat          ChatConfig          `yaml:"chat"`
+	MCP           MCPConfig           `yaml:"mcp"`
 	Metrics       MetricsConfig       `yaml:"metrics"`
 }
 
@@ -30,6 +33,7 @@ type ServerConfig struct {
 }
 
 type QdrantConfig struct {
+	Backend    string `yaml:"backend"` // "qdrant" or "memory"
 	Host       string `yaml:"host"`
 	GRPCPort   int    `yaml:"grpc_port"`
 	Collection string `yaml:"collection"`
@@ -39,10 +43,12 @@ type QdrantConfig struct {
 }
 
 type Neo4jConfig struct {
-	URI      string `yaml:"uri"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	Database string `yaml:"database"`
+	Backend      string `yaml:"backend"` // "neo4j" or "memory"
+	URI          string `yaml:"uri"`
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	Database     string `yaml:"database"`
+	SnapshotPath string `yaml:"snapshot_path"` // memory backend only; empty = no persistence
 }
 
 type RedisConfig struct {
@@ -52,30 +58,130 @@ type RedisConfig struct {
 }
 
 type LLMConfig struct {
-	Provider       string  `yaml:"provider"`
-	APIKey         string  `yaml:"api_key"`
-	Model          string  `yaml:"model"`
-	EmbeddingModel string  `yaml:"embedding_model"`
-	MaxTokens      int     `yaml:"max_tokens"`
-	Temperature    float64 `yaml:"temperature"`
+	Provider          string  `yaml:"provider"` // "openai", "anthropic" or "local"
+	APIKey            string  `yaml:"api_key"`
+	BaseURL           string  `yaml:"base_url"`
+	Model             string  `yaml:"model"`
+	EmbeddingProvider string  `yaml:"embedding_provider"` // for providers without embeddings
+	EmbeddingAPIKey   string  `yaml:"embedding_api_key"`
+	EmbeddingBaseURL  string  `yaml:"embedding_base_url"`
+	EmbeddingModel    string  `yaml:"embedding_model"`
+	MaxTokens         int     `yaml:"max_tokens"`
+	Temperature       float64 `yaml:"temperature"`
+
+	// Prompt-token surprisal for segmentation.
+	Surprisal            string `yaml:"surprisal"`             // "synthetic" or "sliding_window" (one request per word)
+	SurprisalModel       string `yaml:"surprisal_model"`       // completions model with echo logprobs
+	SurprisalWindow      int    `yaml:"surprisal_window"`      // words of left context per next-token request
+	SurprisalConcurrency int    `yaml:"surprisal_concurrency"` // in-flight next-token requests
+
+	// Token counting for budgets; see TokenizerConfig.
+	Tokenizer TokenizerConfig `yaml:"tokenizer"`
+}
+
+// TokenizerConfig selects the BPE vocabulary used to count tokens. Each
+// model maps to an encoding (cl100k_base, o200k_base, ...), read from
+// <vocab_dir>/<encoding>.tiktoken. Without vocab_dir, tokens are estimated
+// as bytes/4.
+type TokenizerConfig struct {
+	VocabDir string            `yaml:"vocab_dir"`
+	Models   map[string]string `yaml:"models"` // model → encoding overrides
 }
 
 type SegmentationConfig struct {
-	Gamma            float64 `yaml:"gamma"`
-	WindowSize       int     `yaml:"window_size"`
-	MinEpisodeTokens int     `yaml:"min_episode_tokens"`
-	MaxEpisodeTokens int     `yaml:"max_episode_tokens"`
+	Strategy         string            `yaml:"strategy"`          // "surprisal", "embedding_drift" or "fixed_window"
+	TenantStrategies map[string]string `yaml:"tenant_strategies"` // user_id → strategy overrides
+	StatsBackend     string            `yaml:"stats_backend"`     // rolling μ/σ window store: "redis" or "memory"
+	StatsTTL         time.Duration     `yaml:"stats_ttl"`         // idle time before a user's redis windows expire
+	Gamma            float64           `yaml:"gamma"`
+	WindowSize       int               `yaml:"window_size"`
+	MinEpisodeTokens int               `yaml:"min_episode_tokens"`
+	MaxEpisodeTokens int               `yaml:"max_episode_tokens"`
+	DriftWindow      int               `yaml:"drift_window"`       // sentences per side compared by embedding_drift
+	FixedWindowWords int               `yaml:"fixed_window_words"` // words per episode for fixed_window
 }
 
 type KnapsackConfig struct {
 	TokenBudget      int     `yaml:"token_budget"`
 	ForceRecentTurns int     `yaml:"force_recent_turns"`
 	LambdaInit       float64 `yaml:"lambda_init"`
+
+	// Solver is "auto", "greedy", "dp", "branch_and_bound" or "submodular".
+	// Auto uses exact DP while candidates × budget ≤ DPMaxCells, then branch
+	// and bound capped at BnBMaxNodes search nodes, then greedy for very
+	// large sets.
+	Solver      string `yaml:"solver"`
+	DPMaxCells  int    `yaml:"dp_max_cells"`
+	BnBMaxNodes int    `yaml:"bnb_max_nodes"`
+
+	// Diversity in [0, 1] weighs how well the selection covers the candidate
+	// pool against its summed relevance for the "submodular" solver. Unset
+	// is 0.5; 0 packs for relevance alone.
+	Diversity *float64 `yaml:"diversity"`
+
+	// ReservedTokens are held back from every budget for the system prompt;
+	// the query's own tokens are reserved per request.
+	ReservedTokens int `yaml:"reserved_tokens"`
+
+	// SectionCaps limits the tokens packed per context section ("episodes"
+	// or "facts"); uncapped sections share the budget by density.
+	SectionCaps map[string]int `yaml:"section_caps"`
+
+	// Sections splits the budget left after reserved tokens between the
+	// context sections "profile", "turns", "facts" and "episodes" by share;
+	// a section's unused budget spills over to the others. Empty packs all
+	// memories as one pool.
+	Sections map[string]float64 `yaml:"sections"`
+}
+
+type WorkspaceConfig struct {
+	TurnBackend string        `yaml:"turn_backend"` // phonological loop store: "redis" or "memory"
+	MaxTurns    int           `yaml:"max_turns"`    // turns kept per conversation
+	TurnTTL     time.Duration `yaml:"turn_ttl"`     // idle time before a conversation's turns expire
 }
 
 type DIGConfig struct {
-	MinScore        float64 `yaml:"min_score"`
-	FallbackEnabled bool    `yaml:"fallback_enabled"`
+	Scorer          string        `yaml:"scorer"` // "llm", "listwise", "cross_encoder" or "heuristic"
+	MinScore        float64       `yaml:"min_score"`
+	FallbackEnabled bool          `yaml:"fallback_enabled"`
+	Concurrency     int           `yaml:"concurrency"`   // in-flight scoring calls per query
+	Timeout         time.Duration `yaml:"timeout"`       // per-query scoring deadline
+	CacheBackend    string        `yaml:"cache_backend"` // score cache: "redis", "memory" or "none"
+	CacheSize       int           `yaml:"cache_size"`    // memory cache entries (LRU)
+	CacheTTL        time.Duration `yaml:"cache_ttl"`     // redis cache entry lifetime
+
+	CrossEncoder CrossEncoderConfig `yaml:"cross_encoder"`
+	Heuristic    HeuristicConfig    `yaml:"heuristic"` // also used for the fallback
+	Calibration  CalibrationConfig  `yaml:"calibration"`
+}
+
+// CalibrationConfig controls the per-tenant calibration of DIG scores from
+// feedback. Once a tenant has min_samples labelled scores for the active
+// scorer, candidates are kept by calibrated P(helpful) instead of min_score.
+type CalibrationConfig struct {
+	Backend        string        `yaml:"backend"`         // feedback and calibration store: "redis" or "memory"
+	MinSamples     int           `yaml:"min_samples"`     // feedback per scorer before calibrating
+	MinProbability float64       `yaml:"min_probability"` // calibrated P(helpful) a candidate needs
+	MaxSamples     int           `yaml:"max_samples"`     // feedback kept per tenant
+	Interval       time.Duration `yaml:"interval"`        // how often tenants with new feedback are refitted
+}
+
+// CrossEncoderConfig points the cross_encoder scorer at a reranking server
+// with the text-embeddings-inference /rerank API.
+type CrossEncoderConfig struct {
+	URL    string `yaml:"url"`     // e.g. http://localhost:8081
+	APIKey string `yaml:"api_key"` // sent as a bearer token if set
+}
+
+// HeuristicConfig weighs the signals of the heuristic scorer. If all
+// weights are zero the defaults apply.
+type HeuristicConfig struct {
+	Similarity   float64       `yaml:"similarity"`    // retrieval score (default 1.0)
+	Recency      float64       `yaml:"recency"`       // exp(-age / recency_scale) (default 0.3)
+	RecencyScale time.Duration `yaml:"recency_scale"` // default 24h
+	Surprisal    float64       `yaml:"surprisal"`     // log1p(surprisal) / 5 (default 0.2)
+	Importance   float64       `yaml:"importance"`    // default 0.1
+	GraphFact    float64       `yaml:"graph_fact"`    // per fact, times its confidence (default 0.15)
 }
 
 type ConsolidationConfig struct {
@@ -92,6 +198,30 @@ type RetrievalConfig struct {
 	VectorTopK   int           `yaml:"vector_top_k"`
 	GraphMaxHops int           `yaml:"graph_max_hops"`
 	Timeout      time.Duration `yaml:"timeout"`
+
+	// SessionBoost is added to the similarity of episodes from the query's
+	// own session when retrieval spans the user's whole memory. Unset is
+	// 0.1; 0 turns the boost off.
+	SessionBoost *float64 `yaml:"session_boost"`
+}
+
+type ChatConfig struct {
+	// SystemPrompt opens every chat conversation; empty uses the built-in
+	// prompt, which asks the model to cite memories as [Memory N].
+	SystemPrompt string `yaml:"system_prompt"`
+}
+
+// MCPConfig configures cmd/mcp, the Model Context Protocol server.
+type MCPConfig struct {
+	Transport string `yaml:"transport"` // "stdio" or "http"
+	Port      int    `yaml:"port"`      // http transport
+
+	// UserID is the tenant of the stdio session, and of http sessions
+	// initialized without an X-Tenant-ID header.
+	UserID string `yaml:"user_id"`
+
+	// SessionTTL expires http sessions idle for longer.
+	SessionTTL time.Duration `yaml:"session_ttl"`
 }
 
 type MetricsConfig struct {
@@ -128,12 +258,30 @@ func (c *Config) applyDefaults() {
 	if c.Server.WriteTimeout == 0 {
 		c.Server.WriteTimeout = 30 * time.Second
 	}
+	if c.Qdrant.Backend == "" {
+		c.Qdrant.Backend = "qdrant"
+	}
 	if c.Qdrant.Collection == "" {
 		c.Qdrant.Collection = "cma_episodes"
 	}
 	if c.Qdrant.VectorSize == 0 {
 		c.Qdrant.VectorSize = 1536
 	}
+	if c.Neo4j.Backend == "" {
+		c.Neo4j.Backend = "neo4j"
+	}
+	if c.LLM.Surprisal == "" {
+		c.LLM.Surprisal = "synthetic"
+	}
+	if c.Segmentation.Strategy == "" {
+		c.Segmentation.Strategy = "surprisal"
+	}
+	if c.Segmentation.StatsBackend == "" {
+		c.Segmentation.StatsBackend = "redis"
+	}
+	if c.Segmentation.StatsTTL == 0 {
+		c.Segmentation.StatsTTL = 30 * 24 * time.Hour
+	}
 	if c.Segmentation.Gamma == 0 {
 		c.Segmentation.Gamma = 1.5
 	}
@@ -146,6 +294,24 @@ func (c *Config) applyDefaults() {
 	if c.Knapsack.ForceRecentTurns == 0 {
 		c.Knapsack.ForceRecentTurns = 3
 	}
+	if c.Workspace.TurnBackend == "" {
+		c.Workspace.TurnBackend = "redis"
+	}
+	if c.Workspace.MaxTurns == 0 {
+		c.Workspace.MaxTurns = 100
+	}
+	if c.Workspace.TurnTTL == 0 {
+		c.Workspace.TurnTTL = 24 * time.Hour
+	}
+	if c.DIG.Scorer == "" {
+		c.DIG.Scorer = "llm"
+	}
+	if c.DIG.Calibration.Backend == "" {
+		c.DIG.Calibration.Backend = "redis"
+	}
+	if c.DIG.CacheBackend == "" {
+		c.DIG.CacheBackend = "redis"
+	}
 	if c.Consolidation.InactivityTimeout == 0 {
 		c.Consolidation.InactivityTimeout = 15 * time.Minute
 	}
@@ -167,4 +333,22 @@ func (c *Config) applyDefaults() {
 	if c.Retrieval.Timeout == 0 {
 		c.Retrieval.Timeout = 10 * time.Second
 	}
+	if c.MCP.Transport == "" {
+		c.MCP.Transport = "stdio"
+	}
+	if c.MCP.Port == 0 {
+		c.MCP.Port = 8090
+	}
+	if c.MCP.SessionTTL == 0 {
+		c.MCP.SessionTTL = 24 * time.Hour
+	}
+}
+
+// UsesRedis reports whether any store is configured with the redis backend.
+// Without one, the servers run without Redis and consolidate in-process.
+func (c *Config) UsesRedis() bool {
+	return c.Segmentation.StatsBackend == "redis" ||
+		c.Workspace.TurnBackend == "redis" ||
+		c.DIG.CacheBackend == "redis" ||
+		c.DIG.Calibration.Backend == "redis"
 }
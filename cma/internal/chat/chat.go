@@ -0,0 +1,145 @@
+// Package chat answers user messages from memory: it assembles the
+// cognitive workspace context for the message, has the LLM answer with it
+// and remembers both sides of the exchange.
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/ingest"
+	"github.com/memora/cma/internal/llm"
+	"github.com/memora/cma/internal/models"
+	"github.com/memora/cma/internal/workspace"
+)
+
+// DefaultSystemPrompt opens every conversation unless configured otherwise.
+// Renderers number memories [Memory N], which Cite maps back to episodes.
+const DefaultSystemPrompt = `You are a helpful assistant with long-term memory of this user. ` +
+	`Use the memories provided when they are relevant and cite each one you rely on by its marker, e.g. [Memory 2]. ` +
+	`If the memories do not answer the question, say so instead of guessing.`
+
+// MetaSourceChat is the source metadata of messages remembered by chat.
+const MetaSourceChat = "chat"
+
+// Service answers messages with memory-augmented context.
+type Service struct {
+	workspace    *workspace.Workspace
+	ingest       *ingest.Service
+	provider     llm.Provider
+	systemPrompt string
+}
+
+// NewService creates a chat service.
+func NewService(ws *workspace.Workspace, ingestSvc *ingest.Service, provider llm.Provider, cfg configs.ChatConfig) *Service {
+	systemPrompt := cfg.SystemPrompt
+	if systemPrompt == "" {
+		systemPrompt = DefaultSystemPrompt
+	}
+	return &Service{
+		workspace:    ws,
+		ingest:       ingestSvc,
+		provider:     provider,
+		systemPrompt: systemPrompt,
+	}
+}
+
+// Chat answers req.Message. With onDelta set the answer is streamed to it
+// as it is generated. The message joins the recent turns before the answer
+// is generated and is ingested while it is, so ingestion delays neither the
+// first delta nor, when it fails, the answer. The answer is remembered once
+// it is complete.
+func (s *Service) Chat(ctx context.Context, req models.ChatRequest, onDelta func(delta string) error) (*models.ChatResponse, error) {
+	q, err := s.workspace.Query(ctx, models.QueryRequest{
+		UserID:      req.UserID,
+		Query:       req.Message,
+		TokenBudget: req.TokenBudget,
+		Profile:     req.Profile,
+		SessionID:   req.SessionID,
+		Scope:       req.Scope,
+		Format:      models.FormatMessages,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("chat query: %w", err)
+	}
+
+	if err := s.workspace.AddTurn(ctx, req.UserID, req.SessionID, "user", req.Message); err != nil {
+		slog.Warn("add turn failed", "user_id", req.UserID, "error", err)
+	}
+	ingested := make(chan struct{})
+	go func() {
+		defer close(ingested)
+		err := s.ingestMessage(context.WithoutCancel(ctx), req.UserID, req.SessionID, "user", req.Message, MetaSourceChat)
+		if err != nil {
+			slog.Error("chat message not remembered", "user_id", req.UserID, "error", err)
+		}
+	}()
+
+	messages := append([]models.ChatMessage{{Role: "system", Content: s.systemPrompt}}, q.Messages...)
+	answer, err := s.provider.Chat(ctx, messages, onDelta)
+	if err != nil {
+		return nil, fmt.Errorf("chat generate: %w", err)
+	}
+
+	// A client that disconnected after the last delta still gets its
+	// answer remembered, after the message it answers.
+	<-ingested
+	if err := s.Remember(context.WithoutCancel(ctx), req.UserID, req.SessionID, "assistant", answer); err != nil {
+		slog.Error("chat answer not remembered", "user_id", req.UserID, "error", err)
+	}
+
+	return &models.ChatResponse{
+		Answer:     answer,
+		Citations:  Cite(answer, q.MemoryIDs),
+		Sources:    q.Sources,
+		TokensUsed: q.TokensUsed,
+	}, nil
+}
+
+// Remember appends a message to the conversation's recent turns and
+// ingests it as episodic memory.
+func (s *Service) Remember(ctx context.Context, userID, sessionID, role, content string) error {
+	if err := s.workspace.AddTurn(ctx, userID, sessionID, role, content); err != nil {
+		slog.Warn("add turn failed", "user_id", userID, "error", err)
+	}
+	return s.ingestMessage(ctx, userID, sessionID, role, content, MetaSourceChat)
+}
+
+// ingestMessage ingests a message as episodic memory tagged with source.
+func (s *Service) ingestMessage(ctx context.Context, userID, sessionID, role, content, source string) error {
+	_, err := s.ingest.Ingest(ctx, models.IngestRequest{
+		UserID:    userID,
+		SessionID: sessionID,
+		Content:   content,
+		Role:      role,
+		Metadata:  map[string]any{models.MetaSource: source},
+	})
+	if err != nil {
+		return fmt.Errorf("chat remember %s message: %w", role, err)
+	}
+	return nil
+}
+
+var memoryMarker = regexp.MustCompile(`\[Memory (\d+)\]`)
+
+// Cite returns the memories an answer cites by [Memory N] marker, in order
+// of first citation. memoryIDs are the context's memory IDs in marker
+// order; markers out of range or of graph facts, which have no episode, are
+// skipped.
+func Cite(answer string, memoryIDs []string) []models.Citation {
+	citations := make([]models.Citation, 0)
+	seen := make(map[int]bool)
+	for _, m := range memoryMarker.FindAllStringSubmatch(answer, -1) {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n < 1 || n > len(memoryIDs) || memoryIDs[n-1] == "" || seen[n] {
+			continue
+		}
+		seen[n] = true
+		citations = append(citations, models.Citation{Memory: n, EpisodeID: memoryIDs[n-1]})
+	}
+	return citations
+}
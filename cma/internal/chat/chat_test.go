@@ -0,0 +1,79 @@
+package chat
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/memora/cma/internal/models"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestCite(t *testing.T) {
+	ids := []string{"ep-1", "", "ep-3"}
+
+	tests := []struct {
+		name   string
+		answer string
+		want   []models.Citation
+	}{
+		{name: "no markers", answer: "Alice works at Google.", want: []models.Citation{}},
+		{
+			name:   "order of first citation",
+			answer: "At Google [Memory 3], since 2020 [Memory 1]. Still there [Memory 3].",
+			want:   []models.Citation{{Memory: 3, EpisodeID: "ep-3"}, {Memory: 1, EpisodeID: "ep-1"}},
+		},
+		{
+			name:   "facts and unknown markers skipped",
+			answer: "See [Memory 2], [Memory 4] and [Memory 0].",
+			want:   []models.Citation{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Cite(tt.answer, ids); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Cite = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatMessages(t *testing.T) {
+	in := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "Be terse."},
+		{Role: openai.ChatMessageRoleUser, MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: "What is in"},
+			{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "https://x/cat.png"}},
+			{Type: openai.ChatMessagePartTypeText, Text: "this picture?"},
+		}},
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: "call_1"}}},
+		{Role: openai.ChatMessageRoleTool, Content: "A cat.", ToolCallID: "call_1"},
+	}
+	got := chatMessages(in)
+	want := []models.ChatMessage{
+		{Role: "system", Content: "Be terse."},
+		{Role: "user", Content: "What is in\nthis picture?"},
+		{Role: "user", Content: "A cat."},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chatMessages = %+v, want %+v", got, want)
+	}
+	if q := latestUserMessage(in); q != "What is in\nthis picture?" {
+		t.Errorf("latest user message = %q", q)
+	}
+}
+
+func TestInjectContext(t *testing.T) {
+	conversation := []models.ChatMessage{{Role: "system", Content: "Be terse."}, {Role: "user", Content: "Hi"}}
+	memory := []models.ChatMessage{{Role: "system", Content: "[Memory 1] ..."}, {Role: "user", Content: "Hi"}}
+
+	got := injectContext(conversation, memory)
+	if len(got) != 3 || got[1] != memory[0] || got[2] != conversation[1] {
+		t.Errorf("injectContext = %+v", got)
+	}
+
+	// A context without memories has no system message to inject.
+	if got := injectContext(conversation, memory[1:]); !reflect.DeepEqual(got, conversation) {
+		t.Errorf("injectContext without memories = %+v", got)
+	}
+}
@@ -0,0 +1,200 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memora/cma/internal/models"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// MetaSourceCompletions is the source metadata of messages remembered by
+// the chat completions proxy.
+const MetaSourceCompletions = "chat_completions"
+
+// ErrNoUserMessage is returned for a completions request without a user
+// message to retrieve memories for.
+var ErrNoUserMessage = errors.New("chat completions: no user message")
+
+// Complete answers an OpenAI chat completions request for userID. The
+// memory context for the latest user message is injected as a system
+// message after the request's own system messages, and the configured
+// provider answers in place of req.Model, which is only echoed back. The
+// client keeps the conversation, so stored turns are neither used nor
+// added; the latest user message and the answer are ingested as episodes.
+func (s *Service) Complete(ctx context.Context, userID string, req openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+	answer, usage, err := s.complete(ctx, userID, req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &openai.ChatCompletionResponse{
+		ID:      completionID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer},
+			FinishReason: openai.FinishReasonStop,
+		}},
+		Usage: usage,
+	}, nil
+}
+
+// CompleteStream is Complete streaming the answer to onChunk as
+// chat.completion.chunk objects: the assistant role, one chunk per delta
+// and the finish reason, then the usage if req.StreamOptions asks for it.
+func (s *Service) CompleteStream(ctx context.Context, userID string, req openai.ChatCompletionRequest, onChunk func(openai.ChatCompletionStreamResponse) error) error {
+	id := completionID()
+	chunk := func(delta openai.ChatCompletionStreamChoiceDelta, finish openai.FinishReason) openai.ChatCompletionStreamResponse {
+		return openai.ChatCompletionStreamResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: time.Now().Unix(),
+			Model:   req.Model,
+			Choices: []openai.ChatCompletionStreamChoice{{Delta: delta, FinishReason: finish}},
+		}
+	}
+	started := false
+	_, usage, err := s.complete(ctx, userID, req, func(delta string) error {
+		if !started {
+			started = true
+			if err := onChunk(chunk(openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, "")); err != nil {
+				return err
+			}
+		}
+		return onChunk(chunk(openai.ChatCompletionStreamChoiceDelta{Content: delta}, ""))
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := onChunk(chunk(openai.ChatCompletionStreamChoiceDelta{}, openai.FinishReasonStop)); err != nil {
+		return err
+	}
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+		last := chunk(openai.ChatCompletionStreamChoiceDelta{}, "")
+		last.Choices = []openai.ChatCompletionStreamChoice{}
+		last.Usage = &usage
+		return onChunk(last)
+	}
+	return nil
+}
+
+// complete runs the memory read path for the request, forwards the
+// augmented conversation to the provider and remembers the exchange.
+func (s *Service) complete(ctx context.Context, userID string, req openai.ChatCompletionRequest, onDelta func(delta string) error) (string, openai.Usage, error) {
+	query := latestUserMessage(req.Messages)
+	if query == "" {
+		return "", openai.Usage{}, ErrNoUserMessage
+	}
+
+	q, err := s.workspace.Query(ctx, models.QueryRequest{
+		UserID:       userID,
+		Query:        query,
+		ExcludeTurns: true,
+		Format:       models.FormatMessages,
+	})
+	if err != nil {
+		return "", openai.Usage{}, fmt.Errorf("chat completions query: %w", err)
+	}
+
+	messages := injectContext(chatMessages(req.Messages), q.Messages)
+	answer, err := s.provider.Chat(ctx, messages, onDelta)
+	if err != nil {
+		return "", openai.Usage{}, fmt.Errorf("chat completions generate: %w", err)
+	}
+
+	// Remembered even if the client disconnected after the last delta.
+	rememberCtx := context.WithoutCancel(ctx)
+	for _, m := range []models.ChatMessage{{Role: "user", Content: query}, {Role: "assistant", Content: answer}} {
+		if err := s.ingestMessage(rememberCtx, userID, "", m.Role, m.Content, MetaSourceCompletions); err != nil {
+			slog.Error("chat completions exchange not remembered", "user_id", userID, "role", m.Role, "error", err)
+		}
+	}
+
+	usage := openai.Usage{CompletionTokens: s.provider.CountTokens(answer)}
+	for _, m := range messages {
+		usage.PromptTokens += s.provider.CountTokens(m.Content)
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return answer, usage, nil
+}
+
+// --- Helpers ---
+
+// chatMessages converts OpenAI messages to provider messages. Text parts
+// of multi-part content are joined; tool and function results become user
+// messages, and messages without text, such as bare tool calls, are dropped.
+func chatMessages(in []openai.ChatCompletionMessage) []models.ChatMessage {
+	out := make([]models.ChatMessage, 0, len(in))
+	for _, m := range in {
+		content := messageText(m)
+		if content == "" {
+			continue
+		}
+
+		role := m.Role
+		if role != openai.ChatMessageRoleSystem && role != openai.ChatMessageRoleAssistant {
+			role = openai.ChatMessageRoleUser
+		}
+		out = append(out, models.ChatMessage{Role: role, Content: content})
+	}
+	return out
+}
+
+// messageText returns a message's content, joining the text parts of
+// multi-part content.
+func messageText(m openai.ChatCompletionMessage) string {
+	if m.Content != "" {
+		return m.Content
+	}
+	var parts []string
+	for _, p := range m.MultiContent {
+		if p.Type == openai.ChatMessagePartTypeText {
+			parts = append(parts, p.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// latestUserMessage returns the text of the last user message with text,
+// or "". Tool results are not user messages here.
+func latestUserMessage(messages []openai.ChatCompletionMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != openai.ChatMessageRoleUser {
+			continue
+		}
+		if text := messageText(messages[i]); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// injectContext inserts the system message of a FormatMessages memory
+// context after the conversation's leading system messages. Without
+// memories the conversation is returned unchanged.
+func injectContext(messages, memory []models.ChatMessage) []models.ChatMessage {
+	if len(memory) == 0 || memory[0].Role != openai.ChatMessageRoleSystem {
+		return messages
+	}
+	at := 0
+	for at < len(messages) && messages[at].Role == openai.ChatMessageRoleSystem {
+		at++
+	}
+	out := make([]models.ChatMessage, 0, len(messages)+1)
+	out = append(out, messages[:at]...)
+	out = append(out, memory[0])
+	return append(out, messages[at:]...)
+}
+
+// completionID returns a chat completion ID in OpenAI's format.
+func completionID() string {
+	return "chatcmpl-" + strings.ReplaceAll(uuid.NewString(), "-", "")
+}
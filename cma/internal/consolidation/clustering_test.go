@@ -0,0 +1,90 @@
+package consolidation
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/memora/cma/internal/models"
+)
+
+func vecEpisode(id string, vec ...float32) models.Episode {
+	return models.Episode{ID: id, Embedding: vec}
+}
+
+func TestDBSCANCluster(t *testing.T) {
+	tests := []struct {
+		name      string
+		epsilon   float64
+		minPoints int
+		episodes  []models.Episode
+		wantSizes []int // cluster sizes, descending
+	}{
+		{
+			name:      "empty input",
+			epsilon:   0.1,
+			minPoints: 2,
+			wantSizes: nil,
+		},
+		{
+			name:      "two dense groups and one outlier",
+			epsilon:   0.1,
+			minPoints: 2,
+			episodes: []models.Episode{
+				vecEpisode("a1", 1, 0, 0),
+				vecEpisode("a2", 0.99, 0.05, 0),
+				vecEpisode("a3", 0.98, 0.02, 0.01),
+				vecEpisode("b1", 0, 1, 0),
+				vecEpisode("b2", 0.03, 0.99, 0),
+				vecEpisode("noise", 0, 0, 1),
+			},
+			wantSizes: []int{3, 2, 1},
+		},
+		{
+			name:      "sparse points all become singletons",
+			epsilon:   0.1,
+			minPoints: 3,
+			episodes: []models.Episode{
+				vecEpisode("x", 1, 0, 0),
+				vecEpisode("y", 0, 1, 0),
+				vecEpisode("z", 0, 0, 1),
+			},
+			wantSizes: []int{1, 1, 1},
+		},
+		{
+			name:      "episodes without embeddings are noise",
+			epsilon:   0.5,
+			minPoints: 1,
+			episodes: []models.Episode{
+				vecEpisode("empty1"),
+				vecEpisode("empty2"),
+			},
+			wantSizes: []int{1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusters := NewDBSCAN(tt.epsilon, tt.minPoints).Cluster(tt.episodes)
+
+			var sizes []int
+			total := 0
+			for _, c := range clusters {
+				sizes = append(sizes, len(c.Episodes))
+				total += len(c.Episodes)
+			}
+			sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+
+			if len(sizes) != len(tt.wantSizes) {
+				t.Fatalf("cluster sizes %v, want %v", sizes, tt.wantSizes)
+			}
+			for i := range sizes {
+				if sizes[i] != tt.wantSizes[i] {
+					t.Fatalf("cluster sizes %v, want %v", sizes, tt.wantSizes)
+				}
+			}
+			if total != len(tt.episodes) {
+				t.Errorf("clusters hold %d episodes, want %d", total, len(tt.episodes))
+			}
+		})
+	}
+}
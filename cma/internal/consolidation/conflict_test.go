@@ -0,0 +1,105 @@
+package consolidation
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/graphstore"
+	"github.com/memora/cma/internal/models"
+)
+
+func TestConflictResolverResolveAndInsert(t *testing.T) {
+	lives := func(city string) models.Triple {
+		return models.Triple{Subject: "Alice", Predicate: "lives_in", Object: city, Confidence: 0.8}
+	}
+
+	tests := []struct {
+		name          string
+		existing      []models.Triple
+		incoming      []models.Triple
+		wantConflicts int
+		wantInserted  int
+		wantObjects   []string // currently-valid objects for Alice after resolution
+	}{
+		{
+			name:          "new fact without conflict",
+			incoming:      []models.Triple{lives("Paris")},
+			wantConflicts: 0,
+			wantInserted:  1,
+			wantObjects:   []string{"Paris"},
+		},
+		{
+			name:          "contradicting fact supersedes the old one",
+			existing:      []models.Triple{lives("Paris")},
+			incoming:      []models.Triple{lives("Berlin")},
+			wantConflicts: 1,
+			wantInserted:  1,
+			wantObjects:   []string{"Berlin"},
+		},
+		{
+			name:          "restating a fact is not a conflict",
+			existing:      []models.Triple{lives("Paris")},
+			incoming:      []models.Triple{lives("Paris")},
+			wantConflicts: 0,
+			wantInserted:  1,
+			wantObjects:   []string{"Paris", "Paris"},
+		},
+		{
+			name:     "different predicate coexists",
+			existing: []models.Triple{lives("Paris")},
+			incoming: []models.Triple{
+				{Subject: "Alice", Predicate: "works_at", Object: "Google", Confidence: 0.9},
+			},
+			wantConflicts: 0,
+			wantInserted:  1,
+			wantObjects:   []string{"Google", "Paris"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			graph, err := graphstore.NewInMemoryStore(configs.Neo4jConfig{})
+			if err != nil {
+				t.Fatalf("NewInMemoryStore: %v", err)
+			}
+
+			for _, tr := range tt.existing {
+				if err := graph.InsertTriple(ctx, "u1", tr, "ep-old"); err != nil {
+					t.Fatalf("seed InsertTriple: %v", err)
+				}
+			}
+
+			cr := NewConflictResolver(graph, 0.5)
+			conflicts, inserted, err := cr.ResolveAndInsert(ctx, "u1", tt.incoming, "ep-new")
+			if err != nil {
+				t.Fatalf("ResolveAndInsert: %v", err)
+			}
+			if conflicts != tt.wantConflicts {
+				t.Errorf("conflicts = %d, want %d", conflicts, tt.wantConflicts)
+			}
+			if inserted != tt.wantInserted {
+				t.Errorf("inserted = %d, want %d", inserted, tt.wantInserted)
+			}
+
+			// One-hop traversal only follows currently-valid edges.
+			facts, err := graph.TraverseHops(ctx, "u1", []string{"Alice"}, 1)
+			if err != nil {
+				t.Fatalf("TraverseHops: %v", err)
+			}
+
+			var objects []string
+			for _, f := range facts {
+				objects = append(objects, f.GraphFacts[0].Object)
+			}
+			sort.Strings(objects)
+
+			if strings.Join(objects, ",") != strings.Join(tt.wantObjects, ",") {
+				t.Errorf("valid objects = %v, want %v", objects, tt.wantObjects)
+			}
+		})
+	}
+}
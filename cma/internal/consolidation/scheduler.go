@@ -2,10 +2,13 @@ package consolidation
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
 	"github.com/redis/go-redis/v9"
 
@@ -13,6 +16,15 @@ import (
 	"github.com/memora/cma/internal/vectorstore"
 )
 
+// ErrConsolidationRunning is returned when the user's consolidation lock is
+// taken: a consolidation is running in this process or, with Redis, was
+// started by any process within lockTTL.
+var ErrConsolidationRunning = errors.New("consolidation already running")
+
+// lockTTL bounds how long a user's Redis consolidation lock is held: it
+// expires rather than being released for tasks run by asynq workers.
+const lockTTL = 5 * time.Minute
+
 // Scheduler periodically checks for users that need consolidation
 // and enqueues Asynq tasks. This implements the CMA "Sleep trigger"
 // that fires on inactivity or unconsolidated episode threshold.
@@ -23,10 +35,14 @@ type Scheduler struct {
 	redisClient  *redis.Client
 	cfg          configs.ConsolidationConfig
 	lastActivity sync.Map // map[userID]time.Time
+	running      sync.Map // map[userID]struct{}, consolidations locked by this process
 	stopCh       chan struct{}
 }
 
-// NewScheduler creates a new consolidation scheduler.
+// NewScheduler creates a new consolidation scheduler. Without an asynq
+// client tasks run in-process on worker, as on a single node with only
+// in-memory stores. With a Redis client the per-user lock is shared with
+// every other process using the same Redis.
 func NewScheduler(
 	worker *Worker,
 	vectorDB vectorstore.VectorStore,
@@ -98,40 +114,100 @@ func (s *Scheduler) checkAllUsers(ctx context.Context) {
 			return true
 		}
 
-		// Try to acquire a Redis lock for this user's consolidation.
-		// This prevents concurrent consolidation of the same user.
-		lockKey := "cma:consolidation:lock:" + userID
-		acquired, err := s.redisClient.SetNX(ctx, lockKey, "locked", 5*time.Minute).Result()
-		if err != nil {
-			slog.Error("redis lock failed", "user_id", userID, "error", err)
-			return true
-		}
-		if !acquired {
+		// Enqueue consolidation task under the user's lock, which
+		// prevents concurrent consolidation of the same user.
+		taskID, err := s.Enqueue(ctx, userID)
+		if errors.Is(err, ErrConsolidationRunning) {
 			slog.Debug("consolidation already running", "user_id", userID)
 			return true
 		}
-
-		// Enqueue consolidation task.
-		task, err := NewConsolidateTask(userID)
-		if err != nil {
-			slog.Error("create task failed", "user_id", userID, "error", err)
-			return true
-		}
-
-		info, err := s.asynqClient.Enqueue(task)
 		if err != nil {
 			slog.Error("enqueue consolidation failed", "user_id", userID, "error", err)
-			// Release the lock on failure.
-			s.redisClient.Del(ctx, lockKey)
 			return true
 		}
 
 		slog.Info("consolidation enqueued",
 			"user_id", userID,
 			"reason", reason,
-			"task_id", info.ID,
+			"task_id", taskID,
 		)
 
 		return true
 	})
 }
+
+// Enqueue queues a consolidation task for userID under the user's lock and
+// returns its ID. Without an asynq client the task runs in-process in the
+// background, outliving ctx, and releases the lock when done.
+func (s *Scheduler) Enqueue(ctx context.Context, userID string) (string, error) {
+	task, err := NewConsolidateTask(userID)
+	if err != nil {
+		return "", fmt.Errorf("create consolidation task: %w", err)
+	}
+	release, err := s.lock(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if s.asynqClient != nil {
+		info, err := s.asynqClient.EnqueueContext(ctx, task)
+		if err != nil {
+			release()
+			return "", fmt.Errorf("enqueue consolidation: %w", err)
+		}
+		// The task runs on an asynq worker; its Redis lock expires.
+		s.running.Delete(userID)
+		return info.ID, nil
+	}
+
+	taskID := uuid.NewString()
+	go func() {
+		defer release()
+		if err := s.worker.ProcessTask(context.WithoutCancel(ctx), task); err != nil {
+			slog.Error("consolidation failed", "user_id", userID, "task_id", taskID, "error", err)
+		}
+	}()
+	return taskID, nil
+}
+
+// Run consolidates userID now and waits for it, under the same per-user
+// lock as Enqueue.
+func (s *Scheduler) Run(ctx context.Context, userID string) error {
+	task, err := NewConsolidateTask(userID)
+	if err != nil {
+		return fmt.Errorf("create consolidation task: %w", err)
+	}
+	release, err := s.lock(ctx, userID)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return s.worker.ProcessTask(ctx, task)
+}
+
+// lock takes the user's consolidation lock: the in-process guard and, with
+// a Redis client, the cma:consolidation:lock:<user> key. release frees both.
+func (s *Scheduler) lock(ctx context.Context, userID string) (release func(), err error) {
+	if _, busy := s.running.LoadOrStore(userID, struct{}{}); busy {
+		return nil, ErrConsolidationRunning
+	}
+	if s.redisClient == nil {
+		return func() { s.running.Delete(userID) }, nil
+	}
+
+	key := "cma:consolidation:lock:" + userID
+	acquired, err := s.redisClient.SetNX(ctx, key, "locked", lockTTL).Result()
+	if err != nil {
+		s.running.Delete(userID)
+		return nil, fmt.Errorf("redis lock: %w", err)
+	}
+	if !acquired {
+		s.running.Delete(userID)
+		return nil, ErrConsolidationRunning
+	}
+	return func() {
+		s.redisClient.Del(context.WithoutCancel(ctx), key)
+		s.running.Delete(userID)
+	}, nil
+}
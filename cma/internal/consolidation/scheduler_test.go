@@ -0,0 +1,41 @@
+package consolidation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/memora/cma/configs"
+)
+
+func TestSchedulerLock(t *testing.T) {
+	ctx := context.Background()
+	s := NewScheduler(nil, nil, nil, nil, configs.ConsolidationConfig{})
+
+	release, err := s.lock(ctx, "alice")
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+
+	// Both entry points refuse a user whose lock is held, before touching
+	// the worker.
+	if err := s.Run(ctx, "alice"); !errors.Is(err, ErrConsolidationRunning) {
+		t.Errorf("Run while locked: err = %v, want ErrConsolidationRunning", err)
+	}
+	if _, err := s.Enqueue(ctx, "alice"); !errors.Is(err, ErrConsolidationRunning) {
+		t.Errorf("Enqueue while locked: err = %v, want ErrConsolidationRunning", err)
+	}
+
+	other, err := s.lock(ctx, "bob")
+	if err != nil {
+		t.Fatalf("lock other user: %v", err)
+	}
+	other()
+
+	release()
+	release, err = s.lock(ctx, "alice")
+	if err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+	release()
+}
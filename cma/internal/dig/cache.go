@@ -0,0 +1,168 @@
+package dig
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/memora/cma/configs"
+)
+
+// Cache stores DIG scores by (scorer, query, document) so repeated queries
+// over the same memories skip the model. Heuristic scores are never cached.
+type Cache interface {
+	// Get returns the cached score for key and whether it was present.
+	Get(ctx context.Context, key string) (float64, bool, error)
+
+	// Set stores score under key.
+	Set(ctx context.Context, key string, score float64) error
+}
+
+// NewCache creates the score cache selected by cfg.CacheBackend: "redis"
+// (default), which requires client, "memory", a per-process LRU, or "none",
+// which returns nil. An empty backend outside configs.Load means "memory".
+func NewCache(cfg configs.DIGConfig, client *redis.Client) (Cache, error) {
+	switch cfg.CacheBackend {
+	case "", "memory":
+		return NewLRUCache(cfg.CacheSize), nil
+	case "redis":
+		if client == nil {
+			return nil, fmt.Errorf("redis dig cache: no redis client")
+		}
+		return NewRedisCache(client, cfg.CacheTTL), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown dig cache backend %q", cfg.CacheBackend)
+	}
+}
+
+// cacheKey is the key of (scorer, query, document), built from the scorer
+// name and query hash (queryKey, computed once per query) and the
+// document's hash.
+func cacheKey(queryKey, document string) string {
+	return queryKey + ":" + hashText(document)
+}
+
+// hashText returns the first 128 bits of text's SHA-256 in hex.
+func hashText(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:16])
+}
+
+// --- In-memory ---
+
+// LRUCache is a process-local Cache that evicts the least recently used
+// score beyond its capacity. It is safe for concurrent use.
+type LRUCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front: most recently used
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	score float64
+}
+
+// NewLRUCache creates an LRU cache of size entries (default 10000).
+func NewLRUCache(size int) *LRUCache {
+	if size <= 0 {
+		size = 10000
+	}
+	return &LRUCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(ctx context.Context, key string) (float64, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return 0, false, nil
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry).score, true, nil
+}
+
+func (c *LRUCache) Set(ctx context.Context, key string, score float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*lruEntry).score = score
+		c.order.MoveToFront(el)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, score: score})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of cached scores.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// --- Redis ---
+
+// RedisCache shares scores between replicas as plain string keys that
+// expire after ttl.
+type RedisCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisCache creates a Redis-backed cache (default ttl 24h).
+func NewRedisCache(client *redis.Client, ttl time.Duration) *RedisCache {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &RedisCache{client: client, ttl: ttl}
+}
+
+func (r *RedisCache) key(key string) string {
+	return "cma:dig:" + key
+}
+
+func (r *RedisCache) Get(ctx context.Context, key string) (float64, bool, error) {
+	val, err := r.client.Get(ctx, r.key(key)).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("redis dig cache get: %w", err)
+	}
+	score, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("redis dig cache get: %w", err)
+	}
+	return score, true, nil
+}
+
+func (r *RedisCache) Set(ctx context.Context, key string, score float64) error {
+	val := strconv.FormatFloat(score, 'g', -1, 64)
+	if err := r.client.Set(ctx, r.key(key), val, r.ttl).Err(); err != nil {
+		return fmt.Errorf("redis dig cache set: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package dig
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRUCache(2)
+	c.Set(ctx, "a", 1)
+	c.Set(ctx, "b", 2)
+	c.Get(ctx, "a") // b is now the least recently used
+	c.Set(ctx, "c", 3)
+
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("b should have been evicted")
+	}
+	for key, want := range map[string]float64{"a": 1, "c": 3} {
+		if got, ok, _ := c.Get(ctx, key); !ok || got != want {
+			t.Errorf("Get(%q) = %v, %v; want %v, true", key, got, ok, want)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len = %d, want 2", c.Len())
+	}
+}
+
+func TestCacheKeyDependsOnQueryAndDocument(t *testing.T) {
+	q1, q2 := hashText("where does Alice work"), hashText("where does Bob work")
+	keys := map[string]bool{
+		cacheKey(q1, "Alice works at Google"): true,
+		cacheKey(q2, "Alice works at Google"): true,
+		cacheKey(q1, "Bob works at Acme"):     true,
+	}
+	if len(keys) != 3 {
+		t.Errorf("got %d distinct keys, want 3", len(keys))
+	}
+}
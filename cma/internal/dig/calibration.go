@@ -0,0 +1,274 @@
+package dig
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/models"
+)
+
+// Calibrator turns raw DIG scores into per-tenant probabilities that a
+// candidate is helpful. It records labelled feedback and, offline, fits an
+// isotonic regression of helpful on score for each (tenant, scorer) with
+// at least minSamples labels. The Reranker then keeps candidates whose
+// calibrated probability reaches minProbability instead of applying the
+// global min_score, which says little about a given tenant or scorer.
+type Calibrator struct {
+	store          FeedbackStore
+	minSamples     int
+	minProbability float64
+	maxSamples     int
+	interval       time.Duration
+	stopCh         chan struct{}
+}
+
+// NewCalibrator creates a calibrator over store.
+func NewCalibrator(store FeedbackStore, cfg configs.CalibrationConfig) *Calibrator {
+	minSamples := cfg.MinSamples
+	if minSamples <= 0 {
+		minSamples = 50
+	}
+	minProbability := cfg.MinProbability
+	if minProbability <= 0 {
+		minProbability = 0.5
+	}
+	maxSamples := cfg.MaxSamples
+	if maxSamples <= 0 {
+		maxSamples = 5000
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	return &Calibrator{
+		store:          store,
+		minSamples:     minSamples,
+		minProbability: minProbability,
+		maxSamples:     maxSamples,
+		interval:       interval,
+		stopCh:         make(chan struct{}),
+	}
+}
+
+// Record stores the feedback of req and returns the number of items.
+func (c *Calibrator) Record(ctx context.Context, req models.FeedbackRequest) (int, error) {
+	now := time.Now().UTC()
+	fb := make([]models.DIGFeedback, len(req.Items))
+	for i, item := range req.Items {
+		fb[i] = models.DIGFeedback{
+			Query:       req.Query,
+			CandidateID: item.ID,
+			Score:       item.Score,
+			Scorer:      item.Scorer,
+			Helpful:     item.Helpful,
+			Timestamp:   now,
+		}
+	}
+	if err := c.store.AddFeedback(ctx, req.UserID, fb, c.maxSamples); err != nil {
+		return 0, fmt.Errorf("dig feedback: %w", err)
+	}
+	return len(fb), nil
+}
+
+// Fit refits the tenant's calibrations from their feedback, one per scorer
+// with at least minSamples labels, and returns them.
+func (c *Calibrator) Fit(ctx context.Context, userID string) ([]models.DIGCalibration, error) {
+	fb, err := c.store.Feedback(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("dig calibration: %w", err)
+	}
+
+	byScorer := make(map[string][]models.DIGFeedback)
+	for _, f := range fb {
+		byScorer[f.Scorer] = append(byScorer[f.Scorer], f)
+	}
+
+	scorers := make([]string, 0, len(byScorer))
+	for s := range byScorer {
+		scorers = append(scorers, s)
+	}
+	sort.Strings(scorers)
+
+	var fitted []models.DIGCalibration
+	for _, scorer := range scorers {
+		samples := byScorer[scorer]
+		if len(samples) < c.minSamples {
+			continue
+		}
+
+		cal := c.fit(userID, scorer, samples)
+		if err := c.store.SaveCalibration(ctx, cal); err != nil {
+			return fitted, fmt.Errorf("dig calibration: %w", err)
+		}
+		fitted = append(fitted, cal)
+	}
+	return fitted, nil
+}
+
+// Calibration returns the tenant's calibration for scorer, or nil.
+func (c *Calibrator) Calibration(ctx context.Context, userID, scorer string) (*models.DIGCalibration, error) {
+	return c.store.Calibration(ctx, userID, scorer)
+}
+
+// Start refits tenants with new feedback every interval until Stop.
+func (c *Calibrator) Start(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	slog.Info("dig calibrator started",
+		"interval", c.interval,
+		"min_samples", c.minSamples,
+		"min_probability", c.minProbability,
+	)
+
+	for {
+		select {
+		case <-ticker.C:
+			c.fitPending(ctx)
+		case <-c.stopCh:
+			slog.Info("dig calibrator stopped")
+			return
+		case <-ctx.Done():
+			slog.Info("dig calibrator context cancelled")
+			return
+		}
+	}
+}
+
+// Stop signals the calibrator to stop.
+func (c *Calibrator) Stop() {
+	close(c.stopCh)
+}
+
+func (c *Calibrator) fitPending(ctx context.Context) {
+	users, err := c.store.PendingUsers(ctx)
+	if err != nil {
+		slog.Error("dig calibration pending users failed", "error", err)
+	}
+	for _, userID := range users {
+		fitted, err := c.Fit(ctx, userID)
+		if err != nil {
+			slog.Error("dig calibration failed", "user_id", userID, "error", err)
+			continue
+		}
+		for _, cal := range fitted {
+			slog.Info("dig calibration fitted",
+				"user_id", userID,
+				"scorer", cal.Scorer,
+				"samples", cal.Samples,
+				"threshold", cal.Threshold,
+			)
+		}
+	}
+}
+
+// fit computes the isotonic calibration of one scorer's samples.
+func (c *Calibrator) fit(userID, scorer string, samples []models.DIGFeedback) models.DIGCalibration {
+	scores := make([]float64, len(samples))
+	helpful := make([]bool, len(samples))
+	for i, s := range samples {
+		scores[i], helpful[i] = s.Score, s.Helpful
+	}
+
+	knots, probs := isotonic(scores, helpful)
+	cal := models.DIGCalibration{
+		UserID:   userID,
+		Scorer:   scorer,
+		Samples:  len(samples),
+		Scores:   knots,
+		Probs:    probs,
+		FittedAt: time.Now().UTC(),
+	}
+	for i, p := range probs {
+		if p >= c.minProbability {
+			threshold := thresholdScore(knots, probs, i, c.minProbability)
+			cal.Threshold = &threshold
+			break
+		}
+	}
+	return cal
+}
+
+// Probability returns the calibrated P(helpful) of score: the isotonic fit
+// interpolated linearly between knots and constant beyond them.
+func Probability(cal *models.DIGCalibration, score float64) float64 {
+	n := len(cal.Scores)
+	if n == 0 {
+		return 0
+	}
+	i := sort.SearchFloat64s(cal.Scores, score)
+	switch {
+	case i == 0:
+		return cal.Probs[0]
+	case i == n:
+		return cal.Probs[n-1]
+	}
+	x0, x1 := cal.Scores[i-1], cal.Scores[i]
+	p0, p1 := cal.Probs[i-1], cal.Probs[i]
+	return p0 + (p1-p0)*(score-x0)/(x1-x0)
+}
+
+// --- Helpers ---
+
+// isotonic fits a non-decreasing step function to the labels by pool
+// adjacent violators. It returns one knot per block, at the block's mean
+// score, with the block's fraction of helpful labels.
+func isotonic(scores []float64, helpful []bool) (knots, probs []float64) {
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] < scores[order[b]] })
+
+	type block struct {
+		sumX, sumY float64
+		n          int
+	}
+	var blocks []block
+	for _, i := range order {
+		y := 0.0
+		if helpful[i] {
+			y = 1
+		}
+		b := block{sumX: scores[i], sumY: y, n: 1}
+		// Equal scores form one block so the fit is a function of score.
+		if k := len(blocks) - 1; k >= 0 && blocks[k].sumX/float64(blocks[k].n) == scores[i] {
+			blocks[k].sumX += b.sumX
+			blocks[k].sumY += b.sumY
+			blocks[k].n++
+		} else {
+			blocks = append(blocks, b)
+		}
+		// Merge while the last block's mean falls below its predecessor's.
+		for k := len(blocks) - 1; k > 0; k-- {
+			prev, last := blocks[k-1], blocks[k]
+			if prev.sumY/float64(prev.n) <= last.sumY/float64(last.n) {
+				break
+			}
+			blocks[k-1] = block{sumX: prev.sumX + last.sumX, sumY: prev.sumY + last.sumY, n: prev.n + last.n}
+			blocks = blocks[:k]
+		}
+	}
+
+	knots = make([]float64, len(blocks))
+	probs = make([]float64, len(blocks))
+	for i, b := range blocks {
+		knots[i] = b.sumX / float64(b.n)
+		probs[i] = b.sumY / float64(b.n)
+	}
+	return knots, probs
+}
+
+// thresholdScore returns the score at which the interpolated fit first
+// reaches p, given that knot i is the first with probs[i] ≥ p.
+func thresholdScore(knots, probs []float64, i int, p float64) float64 {
+	if i == 0 || probs[i] == probs[i-1] {
+		return knots[i]
+	}
+	return knots[i-1] + (knots[i]-knots[i-1])*(p-probs[i-1])/(probs[i]-probs[i-1])
+}
@@ -0,0 +1,193 @@
+package dig
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/llm"
+	"github.com/memora/cma/internal/models"
+)
+
+func TestIsotonic(t *testing.T) {
+	tests := []struct {
+		name      string
+		scores    []float64
+		helpful   []bool
+		wantKnots []float64
+		wantProbs []float64
+	}{
+		{
+			name:      "already monotone",
+			scores:    []float64{0.1, 0.2, 0.3},
+			helpful:   []bool{false, false, true},
+			wantKnots: []float64{0.1, 0.2, 0.3},
+			wantProbs: []float64{0, 0, 1},
+		},
+		{
+			name:      "violators are pooled",
+			scores:    []float64{0.4, 0.1, 0.2, 0.3},
+			helpful:   []bool{true, true, false, false},
+			wantKnots: []float64{0.2, 0.4},
+			wantProbs: []float64{1.0 / 3, 1},
+		},
+		{
+			name:      "equal scores share a knot",
+			scores:    []float64{0.5, 0.5, 0.9},
+			helpful:   []bool{true, false, true},
+			wantKnots: []float64{0.5, 0.9},
+			wantProbs: []float64{0.5, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			knots, probs := isotonic(tt.scores, tt.helpful)
+			if !approxEqual(knots, tt.wantKnots) || !approxEqual(probs, tt.wantProbs) {
+				t.Errorf("isotonic = %v, %v; want %v, %v", knots, probs, tt.wantKnots, tt.wantProbs)
+			}
+		})
+	}
+}
+
+func TestProbabilityInterpolates(t *testing.T) {
+	cal := &models.DIGCalibration{Scores: []float64{0, 1}, Probs: []float64{0.2, 0.6}}
+	for score, want := range map[float64]float64{-1: 0.2, 0: 0.2, 0.5: 0.4, 1: 0.6, 3: 0.6} {
+		if got := Probability(cal, score); math.Abs(got-want) > 1e-9 {
+			t.Errorf("Probability(%v) = %v, want %v", score, got, want)
+		}
+	}
+}
+
+func TestCalibratorFit(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryFeedbackStore()
+	c := NewCalibrator(store, configs.CalibrationConfig{MinSamples: 4})
+
+	// Scores above 0.5 helped; the llm scorer gets enough feedback, the
+	// listwise one does not.
+	req := models.FeedbackRequest{UserID: "u1", Query: "where does Alice work"}
+	for i, score := range []float64{0.1, 0.3, 0.6, 0.8} {
+		req.Items = append(req.Items, models.FeedbackItem{ID: string(rune('a' + i)), Score: score, Scorer: ScorerLLM, Helpful: score > 0.5})
+	}
+	req.Items = append(req.Items, models.FeedbackItem{ID: "e", Score: 0.9, Scorer: ScorerListwise, Helpful: true})
+	if n, err := c.Record(ctx, req); err != nil || n != 5 {
+		t.Fatalf("Record = %d, %v", n, err)
+	}
+
+	if users, _ := store.PendingUsers(ctx); !reflect.DeepEqual(users, []string{"u1"}) {
+		t.Errorf("pending users = %v, want [u1]", users)
+	}
+
+	fitted, err := c.Fit(ctx, "u1")
+	if err != nil {
+		t.Fatalf("Fit: %v", err)
+	}
+	if len(fitted) != 1 || fitted[0].Scorer != ScorerLLM || fitted[0].Samples != 4 {
+		t.Fatalf("fitted = %+v, want one llm calibration over 4 samples", fitted)
+	}
+	if th := fitted[0].Threshold; th == nil || *th <= 0.3 || *th > 0.6 {
+		t.Errorf("threshold = %v, want in (0.3, 0.6]", th)
+	}
+	if cal, _ := store.Calibration(ctx, "u1", ScorerListwise); cal != nil {
+		t.Errorf("listwise calibrated from 1 sample: %+v", cal)
+	}
+}
+
+func TestRerankerUsesCalibration(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryFeedbackStore()
+	// For u1, the fake's word-overlap scores below 0.5 were never helpful.
+	store.SaveCalibration(ctx, models.DIGCalibration{
+		UserID: "u1",
+		Scorer: ScorerLLM,
+		Scores: []float64{0.2, 0.8},
+		Probs:  []float64{0, 1},
+	})
+	c := NewCalibrator(store, configs.CalibrationConfig{MinProbability: 0.5})
+
+	candidates := []models.RetrievalResult{
+		episodeResult("full", "Alice works at Google", 0.9),
+		episodeResult("partial", "Alice likes hiking", 0.4),
+	}
+	r := NewReranker(NewLLMScorer(llm.NewFakeProvider(16), 0), nil, c, configs.DIGConfig{MinScore: 0})
+
+	// Query content words: alice, work, google. full scores 2/3 → P 7/9,
+	// partial 1/3 → P 2/9.
+	got, err := r.Rerank(ctx, "u1", "Where does Alice work at Google", candidates)
+	if err != nil {
+		t.Fatalf("Rerank: %v", err)
+	}
+	if len(got) != 1 || got[0].Result.Episode.ID != "full" {
+		t.Fatalf("calibrated rerank kept %d candidates, want only full", len(got))
+	}
+	if p := got[0].Probability; p == nil || math.Abs(*p-7.0/9) > 1e-9 {
+		t.Errorf("probability = %v, want 7/9", p)
+	}
+
+	// Another tenant without calibration falls back to min_score.
+	got, err = r.Rerank(ctx, "u2", "Where does Alice work at Google", candidates)
+	if err != nil {
+		t.Fatalf("Rerank: %v", err)
+	}
+	if len(got) != 2 || got[0].Probability != nil {
+		t.Errorf("uncalibrated rerank = %d candidates (probability %v), want 2 without probability", len(got), got[0].Probability)
+	}
+}
+
+func TestRerankerCalibratesAfterScoringDeadline(t *testing.T) {
+	ctx := context.Background()
+	store := deadlineFeedbackStore{NewMemoryFeedbackStore()}
+	store.SaveCalibration(ctx, models.DIGCalibration{
+		UserID: "u1",
+		Scorer: ScorerLLM,
+		Scores: []float64{0, 1},
+		Probs:  []float64{1, 1},
+	})
+	c := NewCalibrator(store, configs.CalibrationConfig{MinProbability: 0.5})
+
+	// The slow candidate holds scoring until the deadline.
+	provider := &baselineProvider{FakeProvider: llm.NewFakeProvider(16)}
+	r := NewReranker(NewLLMScorer(provider, 0), nil, c, configs.DIGConfig{Timeout: 50 * time.Millisecond})
+
+	got, err := r.Rerank(ctx, "u1", "Where does Alice work at Google", []models.RetrievalResult{
+		episodeResult("fast", "Alice works at Google", 0.9),
+		episodeResult("slow", "Alice slow answer about Google", 0.8),
+	})
+	if err != nil {
+		t.Fatalf("Rerank: %v", err)
+	}
+	if len(got) != 1 || got[0].Probability == nil {
+		t.Fatalf("got %d candidates, want fast with a calibrated probability", len(got))
+	}
+}
+
+// --- Helpers ---
+
+// deadlineFeedbackStore fails calibration lookups on a done context, as the
+// Redis store does.
+type deadlineFeedbackStore struct {
+	FeedbackStore
+}
+
+func (s deadlineFeedbackStore) Calibration(ctx context.Context, userID, scorer string) (*models.DIGCalibration, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.FeedbackStore.Calibration(ctx, userID, scorer)
+}
+
+func approxEqual(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
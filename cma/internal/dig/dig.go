@@ -2,12 +2,12 @@ package dig
 
 import (
 	"context"
-	"math"
+	"errors"
+	"log/slog"
 	"sort"
 	"time"
 
 	"github.com/memora/cma/configs"
-	"github.com/memora/cma/internal/llm"
 	"github.com/memora/cma/internal/models"
 )
 
@@ -22,25 +22,65 @@ import (
 // - If DIG < 0: document is a distractor (hallucination inducer).
 //
 // CMA filters out all candidates with DIG ≤ 0.
+//
+// Scoring is delegated to a Scorer (pointwise LLM DIG, listwise LLM,
+// cross-encoder or heuristic) within a per-query deadline; scores are cached
+// by (scorer, query, document). Once the tenant's feedback has calibrated
+// the scorer, candidates are kept by calibrated P(helpful) rather than the
+// raw score (see Calibrator).
 type Reranker struct {
-	llmProvider     llm.Provider
-	minScore        float64
-	fallbackEnabled bool
+	scorer     Scorer
+	fallback   *HeuristicScorer // nil when fallback is disabled
+	cache      Cache
+	calibrator *Calibrator
+	minScore   float64
+	timeout    time.Duration
 }
 
-// NewReranker creates a new DIG reranker.
-func NewReranker(provider llm.Provider, cfg configs.DIGConfig) *Reranker {
-	return &Reranker{
-		llmProvider:     provider,
-		minScore:        cfg.MinScore,
-		fallbackEnabled: cfg.FallbackEnabled,
+// NewReranker creates a new DIG reranker. cache and calibrator may be nil
+// to disable caching and calibration.
+func NewReranker(scorer Scorer, cache Cache, calibrator *Calibrator, cfg configs.DIGConfig) *Reranker {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	r := &Reranker{
+		scorer:     scorer,
+		cache:      cache,
+		calibrator: calibrator,
+		minScore:   cfg.MinScore,
+		timeout:    timeout,
+	}
+	if cfg.FallbackEnabled {
+		r.fallback = NewHeuristicScorer(cfg.Heuristic)
 	}
+	// Heuristic scores are cheap and age with the memory, and listwise
+	// scores are relative to the other documents in their prompt; never
+	// cache either per (query, document).
+	if name := scorer.Name(); name == ScorerHeuristic || name == ScorerListwise {
+		r.cache = nil
+	}
+	return r
 }
 
-// Rerank scores and filters retrieval results using Document Information Gain.
-// Returns only candidates with DIG > 0, sorted by DIG score descending.
-func (r *Reranker) Rerank(ctx context.Context, query string, candidates []models.RetrievalResult) ([]models.DIGCandidate, error) {
+// Rerank scores and filters the user's retrieval results using Document
+// Information Gain. Returns only candidates with DIG > min_score, or with
+// calibrated P(helpful) ≥ min_probability, sorted by DIG score descending.
+//
+// When the deadline hits, candidates scored so far are returned; the rest
+// get the heuristic score if fallback is enabled and are dropped otherwise.
+func (r *Reranker) Rerank(ctx context.Context, userID, query string, candidates []models.RetrievalResult) ([]models.DIGCandidate, error) {
+	// The calibration is looked up after scoring, which may have used the
+	// whole deadline.
+	calibrationCtx := ctx
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	queryKey := r.scorer.Name() + ":" + hashText(query)
 	scored := make([]models.DIGCandidate, 0, len(candidates))
+	done := make([]bool, 0, len(candidates))
+	var pending []int
 
 	for _, candidate := range candidates {
 		content := extractContent(candidate)
@@ -48,29 +88,56 @@ func (r *Reranker) Rerank(ctx context.Context, query string, candidates []models
 			continue
 		}
 
-		var digScore float64
-		var err error
+		dc := models.DIGCandidate{Result: candidate, Content: content}
+		score, ok := r.cached(ctx, cacheKey(queryKey, content))
+		if ok {
+			dc.DIGScore, dc.Scorer = score, r.scorer.Name()
+		} else {
+			pending = append(pending, len(scored))
+		}
+		scored = append(scored, dc)
+		done = append(done, ok)
+	}
+
+	if len(pending) > 0 {
+		r.score(ctx, query, queryKey, scored, done, pending)
+	}
 
-		// Try cross-encoder DIG scoring via LLM.
-		digScore, err = r.llmProvider.ScoreDIG(ctx, query, content)
-		if err != nil {
-			if !r.fallbackEnabled {
+	// Candidates the scorer could not score.
+	kept := scored[:0]
+	unscored := 0
+	for i, c := range scored {
+		if !done[i] {
+			unscored++
+			if r.fallback == nil {
 				continue
 			}
 			// Fallback: heuristic scoring based on cosine similarity, recency, and surprisal.
-			digScore = r.heuristicScore(candidate)
+			c.DIGScore, c.Scorer = r.fallback.score(c.Result), ScorerHeuristic
 		}
-
-		scored = append(scored, models.DIGCandidate{
-			Result:   candidate,
-			DIGScore: digScore,
-			Content:  content,
-		})
+		kept = append(kept, c)
+	}
+	if unscored > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		slog.Warn("dig scoring deadline exceeded",
+			"scorer", r.scorer.Name(),
+			"candidates", len(scored),
+			"unscored", unscored,
+			"timeout", r.timeout,
+		)
 	}
 
-	// Filter: remove DIG ≤ 0 candidates (distractors).
-	filtered := make([]models.DIGCandidate, 0, len(scored))
-	for _, c := range scored {
+	r.calibrate(calibrationCtx, userID, kept)
+
+	// Filter: remove DIG ≤ 0 candidates (distractors), or those unlikely to
+	// help by the tenant's calibration.
+	filtered := make([]models.DIGCandidate, 0, len(kept))
+	for _, c := range kept {
+		if c.Probability != nil {
+			if *c.Probability >= r.calibrator.minProbability {
+				filtered = append(filtered, c)
+			}
+			continue
+		}
 		if c.DIGScore > r.minScore {
 			filtered = append(filtered, c)
 		}
@@ -84,41 +151,67 @@ func (r *Reranker) Rerank(ctx context.Context, query string, candidates []models
 	return filtered, nil
 }
 
-// heuristicScore computes a fallback DIG approximation when the LLM cross-encoder
-// is unavailable. Uses a combination of:
-//   - Cosine similarity score (from vector search)
-//   - Recency decay (exponential decay based on age)
-//   - Surprisal value (high-surprise events are more salient)
-func (r *Reranker) heuristicScore(result models.RetrievalResult) float64 {
-	score := result.Score // cosine similarity baseline
-
-	if result.Episode != nil {
-		// Recency boost: exponential decay with half-life of 24 hours.
-		age := time.Since(result.Episode.Timestamp).Hours()
-		recencyBoost := math.Exp(-age / 24.0)
-		score += 0.3 * recencyBoost
-
-		// Surprisal boost: high-surprise events are memory landmarks.
-		if result.Episode.SurprisalValue > 0 {
-			surprisalBoost := math.Log1p(result.Episode.SurprisalValue) / 5.0
-			score += 0.2 * surprisalBoost
-		}
+// score runs the scorer over scored[pending], setting done for each
+// candidate it scored and caching the score.
+func (r *Reranker) score(ctx context.Context, query, queryKey string, scored []models.DIGCandidate, done []bool, pending []int) {
+	batch := make([]models.DIGCandidate, len(pending))
+	for k, i := range pending {
+		batch[k] = scored[i]
+	}
 
-		// Importance score contribution.
-		score += 0.1 * result.Episode.ImportanceScore
+	scores, ok, err := r.scorer.Score(ctx, query, batch)
+	if err != nil {
+		slog.Warn("dig scoring failed", "scorer", r.scorer.Name(), "error", err)
+		return
+	}
 
-		// Decay factor penalty.
-		score *= result.Episode.DecayFactor
+	for k, i := range pending {
+		if !ok[k] {
+			continue
+		}
+		scored[i].DIGScore, scored[i].Scorer = scores[k], r.scorer.Name()
+		done[i] = true
+		if r.cache != nil {
+			if err := r.cache.Set(context.WithoutCancel(ctx), cacheKey(queryKey, scored[i].Content), scores[k]); err != nil {
+				slog.Warn("dig score not cached", "error", err)
+			}
+		}
 	}
+}
 
-	// Graph facts get a baseline positive score.
-	if len(result.GraphFacts) > 0 {
-		for _, fact := range result.GraphFacts {
-			score += 0.15 * fact.Confidence
+// calibrate sets the calibrated probability of the candidates scored by the
+// configured scorer, if the tenant has a calibration for it.
+func (r *Reranker) calibrate(ctx context.Context, userID string, candidates []models.DIGCandidate) {
+	if r.calibrator == nil {
+		return
+	}
+	cal, err := r.calibrator.Calibration(ctx, userID, r.scorer.Name())
+	if err != nil {
+		slog.Warn("dig calibration unavailable", "user_id", userID, "error", err)
+		return
+	}
+	if cal == nil {
+		return
+	}
+	for i := range candidates {
+		if candidates[i].Scorer == cal.Scorer {
+			p := Probability(cal, candidates[i].DIGScore)
+			candidates[i].Probability = &p
 		}
 	}
+}
 
-	return score
+// cached returns the cached score for key, treating cache errors as misses.
+func (r *Reranker) cached(ctx context.Context, key string) (float64, bool) {
+	if r.cache == nil {
+		return 0, false
+	}
+	score, ok, err := r.cache.Get(ctx, key)
+	if err != nil {
+		slog.Warn("dig cache unavailable", "error", err)
+		return 0, false
+	}
+	return score, ok
 }
 
 // extractContent retrieves the textual content from a RetrievalResult.
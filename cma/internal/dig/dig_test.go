@@ -0,0 +1,226 @@
+package dig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/llm"
+	"github.com/memora/cma/internal/models"
+)
+
+func episodeResult(id, content string, score float64) models.RetrievalResult {
+	return models.RetrievalResult{
+		Episode: &models.Episode{
+			ID:          id,
+			Content:     content,
+			Timestamp:   time.Now(),
+			DecayFactor: 1.0,
+		},
+		Score:  score,
+		Source: "vector",
+	}
+}
+
+func TestRerankerRerank(t *testing.T) {
+	candidates := []models.RetrievalResult{
+		episodeResult("partial", "Alice likes hiking", 0.4),
+		episodeResult("full", "Alice works at Google in Mountain View", 0.9),
+		episodeResult("none", "The weather was sunny", 0.2),
+		{Source: "vector"}, // no content, always skipped
+	}
+
+	tests := []struct {
+		name     string
+		cfg      configs.DIGConfig
+		digErr   error
+		wantIDs  []string
+		checkDIG bool
+	}{
+		{
+			name:     "filters at min score and sorts by DIG",
+			cfg:      configs.DIGConfig{MinScore: 0},
+			wantIDs:  []string{"full", "partial"},
+			checkDIG: true,
+		},
+		{
+			name:    "negative min score keeps irrelevant candidates",
+			cfg:     configs.DIGConfig{MinScore: -0.5},
+			wantIDs: []string{"full", "partial", "none"},
+		},
+		{
+			name:    "scoring errors without fallback drop everything",
+			cfg:     configs.DIGConfig{MinScore: 0},
+			digErr:  errors.New("llm down"),
+			wantIDs: []string{},
+		},
+		{
+			name:    "scoring errors with fallback use heuristic ranking",
+			cfg:     configs.DIGConfig{MinScore: 0, FallbackEnabled: true},
+			digErr:  errors.New("llm down"),
+			wantIDs: []string{"full", "partial", "none"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := llm.NewFakeProvider(16)
+			provider.DIGErr = tt.digErr
+
+			r := NewReranker(NewLLMScorer(provider, 0), nil, nil, tt.cfg)
+			got, err := r.Rerank(context.Background(), "user-1", "Where does Alice work at Google", candidates)
+			if err != nil {
+				t.Fatalf("Rerank: %v", err)
+			}
+
+			if len(got) != len(tt.wantIDs) {
+				t.Fatalf("got %d candidates, want %d", len(got), len(tt.wantIDs))
+			}
+			for i, id := range tt.wantIDs {
+				if got[i].Result.Episode.ID != id {
+					t.Errorf("rank %d: got %q, want %q", i, got[i].Result.Episode.ID, id)
+				}
+			}
+
+			if tt.checkDIG {
+				// Query content words: alice, work, google. "full" has "works", not "work".
+				if want := 2.0 / 3.0; got[0].DIGScore != want {
+					t.Errorf("top DIG = %v, want %v", got[0].DIGScore, want)
+				}
+			}
+		})
+	}
+}
+
+// baselineProvider splits the fake DIG score into a baseline and per-document
+// calls, counting both and the peak number of calls in flight. Documents
+// containing "slow" block until the context is done.
+type baselineProvider struct {
+	*llm.FakeProvider
+
+	baselines atomic.Int32
+	scores    atomic.Int32
+	inFlight  atomic.Int32
+	peak      atomic.Int32
+}
+
+func (p *baselineProvider) DIGBaseline(ctx context.Context, query string) (float64, error) {
+	p.baselines.Add(1)
+	return 0, nil
+}
+
+func (p *baselineProvider) ScoreDIGAgainst(ctx context.Context, query, document string, baseline float64) (float64, error) {
+	p.scores.Add(1)
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		peak := p.peak.Load()
+		if n <= peak || p.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+
+	if strings.Contains(document, "slow") {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	time.Sleep(5 * time.Millisecond)
+	score, err := p.FakeProvider.ScoreDIG(ctx, query, document)
+	return score - baseline, err
+}
+
+func TestRerankerConcurrentCached(t *testing.T) {
+	var candidates []models.RetrievalResult
+	for i := 0; i < 12; i++ {
+		candidates = append(candidates, episodeResult(fmt.Sprintf("ep-%d", i), fmt.Sprintf("Alice works at Google, note %d", i), 0.5))
+	}
+
+	provider := &baselineProvider{FakeProvider: llm.NewFakeProvider(16)}
+	cache := NewLRUCache(0)
+	r := NewReranker(NewLLMScorer(provider, 3), cache, nil, configs.DIGConfig{})
+
+	got, err := r.Rerank(context.Background(), "user-1", "Where does Alice work", candidates)
+	if err != nil {
+		t.Fatalf("Rerank: %v", err)
+	}
+	if len(got) != len(candidates) {
+		t.Fatalf("got %d candidates, want %d", len(got), len(candidates))
+	}
+	if n := provider.baselines.Load(); n != 1 {
+		t.Errorf("baseline computed %d times, want 1", n)
+	}
+	if n := provider.scores.Load(); n != int32(len(candidates)) {
+		t.Errorf("scored %d documents, want %d", n, len(candidates))
+	}
+	if peak := provider.peak.Load(); peak > 3 || peak < 2 {
+		t.Errorf("peak concurrency %d, want 2..3", peak)
+	}
+	if cache.Len() != len(candidates) {
+		t.Errorf("cached %d scores, want %d", cache.Len(), len(candidates))
+	}
+
+	// A repeated query is served from the cache.
+	again, err := r.Rerank(context.Background(), "user-1", "Where does Alice work", candidates)
+	if err != nil {
+		t.Fatalf("Rerank: %v", err)
+	}
+	if len(again) != len(got) || again[0].DIGScore != got[0].DIGScore {
+		t.Errorf("cached rerank = %d candidates, top %v; want %d, top %v", len(again), again[0].DIGScore, len(got), got[0].DIGScore)
+	}
+	if n := provider.baselines.Load(); n != 1 {
+		t.Errorf("baseline recomputed on a cache hit (%d calls)", n)
+	}
+	if n := provider.scores.Load(); n != int32(len(candidates)) {
+		t.Errorf("rescored on a cache hit (%d calls)", n)
+	}
+}
+
+func TestRerankerDeadlineReturnsPartialResults(t *testing.T) {
+	candidates := []models.RetrievalResult{
+		episodeResult("fast", "Alice works at Google", 0.9),
+		episodeResult("slow", "Alice slow answer about Google", 0.8),
+	}
+
+	tests := []struct {
+		name     string
+		fallback bool
+		wantIDs  []string
+	}{
+		{name: "unscored candidates dropped", wantIDs: []string{"fast"}},
+		{name: "unscored candidates use the heuristic", fallback: true, wantIDs: []string{"fast", "slow"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &baselineProvider{FakeProvider: llm.NewFakeProvider(16)}
+			r := NewReranker(NewLLMScorer(provider, 0), nil, nil, configs.DIGConfig{
+				Timeout:         50 * time.Millisecond,
+				FallbackEnabled: tt.fallback,
+			})
+
+			start := time.Now()
+			got, err := r.Rerank(context.Background(), "user-1", "Where does Alice work at Google", candidates)
+			if err != nil {
+				t.Fatalf("Rerank: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Rerank took %v, want about the 50ms deadline", elapsed)
+			}
+
+			ids := make([]string, len(got))
+			for i, c := range got {
+				ids[i] = c.Result.Episode.ID
+			}
+			sort.Strings(ids)
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("got %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
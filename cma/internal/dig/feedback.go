@@ -0,0 +1,230 @@
+package dig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/models"
+)
+
+// FeedbackStore keeps each tenant's DIG feedback and the calibrations fitted
+// from it.
+type FeedbackStore interface {
+	// AddFeedback appends feedback, keeping the tenant's newest maxEntries,
+	// and marks the tenant for refitting.
+	AddFeedback(ctx context.Context, userID string, fb []models.DIGFeedback, maxEntries int) error
+
+	// Feedback returns the tenant's feedback, oldest first.
+	Feedback(ctx context.Context, userID string) ([]models.DIGFeedback, error)
+
+	// PendingUsers returns the tenants with feedback since the last call and
+	// clears the marks.
+	PendingUsers(ctx context.Context) ([]string, error)
+
+	// SaveCalibration stores cal, replacing the tenant's previous fit for
+	// its scorer.
+	SaveCalibration(ctx context.Context, cal models.DIGCalibration) error
+
+	// Calibration returns the tenant's fit for scorer, or nil if none.
+	Calibration(ctx context.Context, userID, scorer string) (*models.DIGCalibration, error)
+}
+
+// NewFeedbackStore creates the store selected by cfg.Backend: "redis"
+// (default), which requires client, or "memory", which keeps calibrations
+// per process. Without configs.Load an empty backend selects "memory".
+func NewFeedbackStore(cfg configs.CalibrationConfig, client *redis.Client) (FeedbackStore, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemoryFeedbackStore(), nil
+	case "redis":
+		if client == nil {
+			return nil, fmt.Errorf("redis feedback store: no redis client")
+		}
+		return NewRedisFeedbackStore(client), nil
+	default:
+		return nil, fmt.Errorf("unknown dig calibration backend %q", cfg.Backend)
+	}
+}
+
+// --- In-memory ---
+
+// MemoryFeedbackStore keeps feedback and calibrations in process memory.
+// It is safe for concurrent use.
+type MemoryFeedbackStore struct {
+	mu           sync.Mutex
+	feedback     map[string][]models.DIGFeedback
+	pending      map[string]bool
+	calibrations map[string]models.DIGCalibration
+}
+
+// NewMemoryFeedbackStore creates an empty in-memory feedback store.
+func NewMemoryFeedbackStore() *MemoryFeedbackStore {
+	return &MemoryFeedbackStore{
+		feedback:     make(map[string][]models.DIGFeedback),
+		pending:      make(map[string]bool),
+		calibrations: make(map[string]models.DIGCalibration),
+	}
+}
+
+func (m *MemoryFeedbackStore) AddFeedback(ctx context.Context, userID string, fb []models.DIGFeedback, maxEntries int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := append(m.feedback[userID], fb...)
+	if maxEntries > 0 && len(all) > maxEntries {
+		all = append([]models.DIGFeedback(nil), all[len(all)-maxEntries:]...)
+	}
+	m.feedback[userID] = all
+	m.pending[userID] = true
+	return nil
+}
+
+func (m *MemoryFeedbackStore) Feedback(ctx context.Context, userID string) ([]models.DIGFeedback, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.DIGFeedback(nil), m.feedback[userID]...), nil
+}
+
+func (m *MemoryFeedbackStore) PendingUsers(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := make([]string, 0, len(m.pending))
+	for u := range m.pending {
+		users = append(users, u)
+	}
+	m.pending = make(map[string]bool)
+	return users, nil
+}
+
+func (m *MemoryFeedbackStore) SaveCalibration(ctx context.Context, cal models.DIGCalibration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calibrations[cal.UserID+":"+cal.Scorer] = cal
+	return nil
+}
+
+func (m *MemoryFeedbackStore) Calibration(ctx context.Context, userID, scorer string) (*models.DIGCalibration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cal, ok := m.calibrations[userID+":"+scorer]
+	if !ok {
+		return nil, nil
+	}
+	return &cal, nil
+}
+
+// --- Redis ---
+
+// RedisFeedbackStore keeps each tenant's feedback in a capped Redis list of
+// JSON entries, pending tenants in a set and calibrations as JSON strings.
+type RedisFeedbackStore struct {
+	client *redis.Client
+}
+
+// NewRedisFeedbackStore creates a Redis-backed feedback store.
+func NewRedisFeedbackStore(client *redis.Client) *RedisFeedbackStore {
+	return &RedisFeedbackStore{client: client}
+}
+
+const redisFeedbackPending = "cma:dig:feedback:pending"
+
+func (r *RedisFeedbackStore) feedbackKey(userID string) string {
+	return "cma:dig:feedback:" + userID
+}
+
+func (r *RedisFeedbackStore) calibrationKey(userID, scorer string) string {
+	return "cma:dig:calibration:" + userID + ":" + scorer
+}
+
+func (r *RedisFeedbackStore) AddFeedback(ctx context.Context, userID string, fb []models.DIGFeedback, maxEntries int) error {
+	values := make([]any, len(fb))
+	for i, f := range fb {
+		data, err := json.Marshal(f)
+		if err != nil {
+			return fmt.Errorf("redis feedback add: %w", err)
+		}
+		values[i] = data
+	}
+
+	key := r.feedbackKey(userID)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, values...)
+		if maxEntries > 0 {
+			pipe.LTrim(ctx, key, int64(-maxEntries), -1)
+		}
+		pipe.SAdd(ctx, redisFeedbackPending, userID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("redis feedback add: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisFeedbackStore) Feedback(ctx context.Context, userID string) ([]models.DIGFeedback, error) {
+	raw, err := r.client.LRange(ctx, r.feedbackKey(userID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis feedback get: %w", err)
+	}
+
+	fb := make([]models.DIGFeedback, 0, len(raw))
+	for _, item := range raw {
+		var f models.DIGFeedback
+		if err := json.Unmarshal([]byte(item), &f); err != nil {
+			return nil, fmt.Errorf("redis feedback get: %w", err)
+		}
+		fb = append(fb, f)
+	}
+	return fb, nil
+}
+
+// PendingUsers pops the pending set, so each tenant is refitted by one
+// replica.
+func (r *RedisFeedbackStore) PendingUsers(ctx context.Context) ([]string, error) {
+	var users []string
+	for {
+		batch, err := r.client.SPopN(ctx, redisFeedbackPending, 100).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return users, fmt.Errorf("redis feedback pending: %w", err)
+		}
+		users = append(users, batch...)
+		if len(batch) < 100 {
+			return users, nil
+		}
+	}
+}
+
+func (r *RedisFeedbackStore) SaveCalibration(ctx context.Context, cal models.DIGCalibration) error {
+	data, err := json.Marshal(cal)
+	if err != nil {
+		return fmt.Errorf("redis calibration save: %w", err)
+	}
+	if err := r.client.Set(ctx, r.calibrationKey(cal.UserID, cal.Scorer), data, 0).Err(); err != nil {
+		return fmt.Errorf("redis calibration save: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisFeedbackStore) Calibration(ctx context.Context, userID, scorer string) (*models.DIGCalibration, error) {
+	data, err := r.client.Get(ctx, r.calibrationKey(userID, scorer)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis calibration get: %w", err)
+	}
+
+	var cal models.DIGCalibration
+	if err := json.Unmarshal(data, &cal); err != nil {
+		return nil, fmt.Errorf("redis calibration get: %w", err)
+	}
+	return &cal, nil
+}
@@ -0,0 +1,356 @@
+package dig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/llm"
+	"github.com/memora/cma/internal/models"
+)
+
+// Scorer names accepted by DIGConfig.Scorer.
+const (
+	ScorerLLM          = "llm"
+	ScorerListwise     = "listwise"
+	ScorerCrossEncoder = "cross_encoder"
+	ScorerHeuristic    = "heuristic"
+)
+
+// Scorer estimates how much each candidate helps answer a query. Scores
+// follow the DIG convention: positive helps, about zero is irrelevant,
+// negative distracts. Score returns one score per candidate and ok[i] false
+// for candidates it could not score, e.g. because ctx expired; an error
+// means none were scored.
+type Scorer interface {
+	Name() string
+	Score(ctx context.Context, query string, candidates []models.DIGCandidate) (scores []float64, ok []bool, err error)
+}
+
+// NewScorer creates the scorer selected by cfg.Scorer: "llm" (default),
+// "listwise", "cross_encoder" or "heuristic".
+func NewScorer(cfg configs.DIGConfig, provider llm.Provider) (Scorer, error) {
+	switch cfg.Scorer {
+	case "", ScorerLLM:
+		return NewLLMScorer(provider, cfg.Concurrency), nil
+	case ScorerListwise:
+		return NewListwiseScorer(provider), nil
+	case ScorerCrossEncoder:
+		if cfg.CrossEncoder.URL == "" {
+			return nil, fmt.Errorf("cross encoder scorer: no url")
+		}
+		return NewCrossEncoderScorer(cfg.CrossEncoder), nil
+	case ScorerHeuristic:
+		return NewHeuristicScorer(cfg.Heuristic), nil
+	default:
+		return nil, fmt.Errorf("unknown dig scorer %q", cfg.Scorer)
+	}
+}
+
+// --- Pointwise LLM ---
+
+// LLMScorer scores each candidate with llm.Provider.ScoreDIG, at most
+// concurrency at a time. For providers implementing llm.DIGBaseliner the
+// query-only baseline is computed once per query instead of per candidate.
+type LLMScorer struct {
+	provider    llm.Provider
+	concurrency int
+}
+
+// NewLLMScorer creates a pointwise DIG scorer (default concurrency 8).
+func NewLLMScorer(provider llm.Provider, concurrency int) *LLMScorer {
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+	return &LLMScorer{provider: provider, concurrency: concurrency}
+}
+
+func (s *LLMScorer) Name() string { return ScorerLLM }
+
+func (s *LLMScorer) Score(ctx context.Context, query string, candidates []models.DIGCandidate) ([]float64, []bool, error) {
+	score := s.provider.ScoreDIG
+	if b, ok := s.provider.(llm.DIGBaseliner); ok {
+		baseline, err := b.DIGBaseline(ctx, query)
+		if err != nil {
+			return nil, nil, err
+		}
+		score = func(ctx context.Context, query, document string) (float64, error) {
+			return b.ScoreDIGAgainst(ctx, query, document, baseline)
+		}
+	}
+
+	scores := make([]float64, len(candidates))
+	ok := make([]bool, len(candidates))
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, s.concurrency)
+	)
+	for i := range candidates {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			dig, err := score(ctx, query, candidates[i].Content)
+			if err != nil {
+				return
+			}
+			scores[i], ok[i] = dig, true
+		}(i)
+	}
+	wg.Wait()
+
+	return scores, ok, nil
+}
+
+// --- Listwise LLM ---
+
+// listwiseMaxChars caps each document in the listwise prompt.
+const listwiseMaxChars = 1500
+
+// ListwiseScorer rates all candidates in a single completion: the model
+// sees the numbered documents side by side and returns a score in [-1, 1]
+// for each. One call per query instead of one or two per candidate, at the
+// price of a coarser, uncalibrated score.
+type ListwiseScorer struct {
+	provider llm.Provider
+}
+
+// NewListwiseScorer creates a listwise scorer.
+func NewListwiseScorer(provider llm.Provider) *ListwiseScorer {
+	return &ListwiseScorer{provider: provider}
+}
+
+func (s *ListwiseScorer) Name() string { return ScorerListwise }
+
+func (s *ListwiseScorer) Score(ctx context.Context, query string, candidates []models.DIGCandidate) ([]float64, []bool, error) {
+	var docs strings.Builder
+	for i, c := range candidates {
+		fmt.Fprintf(&docs, "[%d] %s\n\n", i+1, truncate(c.Content, listwiseMaxChars))
+	}
+
+	prompt := fmt.Sprintf(`Rate how much each numbered document helps answer the question.
+Score from -1 to 1: 1 if the document is needed for a correct answer, 0 if it
+is irrelevant, below 0 if it is misleading or contradicts the answer.
+Return ONLY a JSON array of %d numbers, one per document in order, no markdown formatting.
+
+Question: %s
+
+Documents:
+%s`, len(candidates), query, docs.String())
+
+	raw, err := s.provider.Generate(ctx, prompt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listwise scorer: %w", err)
+	}
+
+	raw = strings.TrimSpace(raw)
+	// Strip markdown code fences if present.
+	raw = strings.TrimPrefix(raw, "```json")
+	raw = strings.TrimPrefix(raw, "```")
+	raw = strings.TrimSuffix(raw, "```")
+	raw = strings.TrimSpace(raw)
+
+	var scores []float64
+	if err := json.Unmarshal([]byte(raw), &scores); err != nil {
+		return nil, nil, fmt.Errorf("listwise scorer parse: %w (raw: %s)", err, raw)
+	}
+	if len(scores) != len(candidates) {
+		return nil, nil, fmt.Errorf("listwise scorer: got %d scores for %d documents", len(scores), len(candidates))
+	}
+
+	ok := make([]bool, len(scores))
+	for i := range scores {
+		scores[i] = math.Max(-1, math.Min(1, scores[i]))
+		ok[i] = true
+	}
+	return scores, ok, nil
+}
+
+// --- Cross-encoder ---
+
+// CrossEncoderScorer sends the query and all candidates to a cross-encoder
+// reranking server in one request, using the text-embeddings-inference
+// /rerank API. Raw logits are requested, so irrelevant documents score
+// below zero as DIG distractors do.
+type CrossEncoderScorer struct {
+	httpClient *http.Client
+	url        string
+	apiKey     string
+}
+
+// NewCrossEncoderScorer creates a scorer for the server at cfg.URL.
+func NewCrossEncoderScorer(cfg configs.CrossEncoderConfig) *CrossEncoderScorer {
+	return &CrossEncoderScorer{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		url:        strings.TrimRight(cfg.URL, "/") + "/rerank",
+		apiKey:     cfg.APIKey,
+	}
+}
+
+func (s *CrossEncoderScorer) Name() string { return ScorerCrossEncoder }
+
+type rerankRequest struct {
+	Query     string   `json:"query"`
+	Texts     []string `json:"texts"`
+	RawScores bool     `json:"raw_scores"`
+	Truncate  bool     `json:"truncate"`
+}
+
+type rerankResult struct {
+	Index int     `json:"index"`
+	Score float64 `json:"score"`
+}
+
+func (s *CrossEncoderScorer) Score(ctx context.Context, query string, candidates []models.DIGCandidate) ([]float64, []bool, error) {
+	texts := make([]string, len(candidates))
+	for i, c := range candidates {
+		texts[i] = c.Content
+	}
+	body, err := json.Marshal(rerankRequest{Query: query, Texts: texts, RawScores: true, Truncate: true})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("cross encoder scorer: %w", err)
+	}
+	httpReq.Header.Set("content-type", "application/json")
+	if s.apiKey != "" {
+		httpReq.Header.Set("authorization", "Bearer "+s.apiKey)
+	}
+
+	httpResp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cross encoder scorer: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cross encoder scorer: %w", err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("cross encoder scorer: status %d: %s", httpResp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var results []rerankResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, nil, fmt.Errorf("cross encoder scorer: decode response: %w", err)
+	}
+
+	scores := make([]float64, len(candidates))
+	ok := make([]bool, len(candidates))
+	for _, r := range results {
+		if r.Index >= 0 && r.Index < len(candidates) {
+			scores[r.Index], ok[r.Index] = r.Score, true
+		}
+	}
+	return scores, ok, nil
+}
+
+// --- Heuristic ---
+
+// HeuristicScorer approximates DIG without a model from retrieval metadata:
+//   - Cosine similarity score (from vector search)
+//   - Recency decay (exponential decay based on age)
+//   - Surprisal value (high-surprise events are more salient)
+//   - Importance, and the confidence of graph facts
+//
+// It is also the Reranker's fallback when the configured scorer fails.
+type HeuristicScorer struct {
+	w configs.HeuristicConfig
+}
+
+// NewHeuristicScorer creates a heuristic scorer. All-zero weights use the
+// defaults (similarity 1, recency 0.3 over 24h, surprisal 0.2, importance
+// 0.1, graph facts 0.15).
+func NewHeuristicScorer(w configs.HeuristicConfig) *HeuristicScorer {
+	if w.Similarity == 0 && w.Recency == 0 && w.Surprisal == 0 && w.Importance == 0 && w.GraphFact == 0 {
+		w = configs.HeuristicConfig{
+			Similarity:   1.0,
+			Recency:      0.3,
+			RecencyScale: w.RecencyScale,
+			Surprisal:    0.2,
+			Importance:   0.1,
+			GraphFact:    0.15,
+		}
+	}
+	if w.RecencyScale <= 0 {
+		w.RecencyScale = 24 * time.Hour
+	}
+	return &HeuristicScorer{w: w}
+}
+
+func (s *HeuristicScorer) Name() string { return ScorerHeuristic }
+
+func (s *HeuristicScorer) Score(ctx context.Context, query string, candidates []models.DIGCandidate) ([]float64, []bool, error) {
+	scores := make([]float64, len(candidates))
+	ok := make([]bool, len(candidates))
+	for i, c := range candidates {
+		scores[i], ok[i] = s.score(c.Result), true
+	}
+	return scores, ok, nil
+}
+
+// score computes the weighted heuristic for one retrieval result.
+func (s *HeuristicScorer) score(result models.RetrievalResult) float64 {
+	score := s.w.Similarity * result.Score // cosine similarity baseline
+
+	if result.Episode != nil {
+		// Recency boost: exponential decay over RecencyScale.
+		age := time.Since(result.Episode.Timestamp)
+		recencyBoost := math.Exp(-age.Hours() / s.w.RecencyScale.Hours())
+		score += s.w.Recency * recencyBoost
+
+		// Surprisal boost: high-surprise events are memory landmarks.
+		if result.Episode.SurprisalValue > 0 {
+			surprisalBoost := math.Log1p(result.Episode.SurprisalValue) / 5.0
+			score += s.w.Surprisal * surprisalBoost
+		}
+
+		// Importance score contribution.
+		score += s.w.Importance * result.Episode.ImportanceScore
+
+		// Decay factor penalty.
+		score *= result.Episode.DecayFactor
+	}
+
+	// Graph facts get a baseline positive score.
+	for _, fact := range result.GraphFacts {
+		score += s.w.GraphFact * fact.Confidence
+	}
+
+	return score
+}
+
+// --- Helpers ---
+
+// truncate shortens s to at most n bytes on a rune boundary.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…"
+}
@@ -0,0 +1,206 @@
+package dig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/llm"
+	"github.com/memora/cma/internal/models"
+)
+
+func digCandidates(results ...models.RetrievalResult) []models.DIGCandidate {
+	out := make([]models.DIGCandidate, len(results))
+	for i, r := range results {
+		out[i] = models.DIGCandidate{Result: r, Content: extractContent(r)}
+	}
+	return out
+}
+
+// generateProvider answers every Generate call with reply and records the prompt.
+type generateProvider struct {
+	*llm.FakeProvider
+	reply  string
+	prompt string
+}
+
+func (p *generateProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	p.prompt = prompt
+	return p.reply, nil
+}
+
+func TestListwiseScorer(t *testing.T) {
+	candidates := digCandidates(
+		episodeResult("a", "Alice works at Google", 0.9),
+		episodeResult("b", "The weather was sunny", 0.2),
+	)
+
+	tests := []struct {
+		name    string
+		reply   string
+		want    []float64
+		wantErr bool
+	}{
+		{name: "plain array", reply: "[0.8, -0.2]", want: []float64{0.8, -0.2}},
+		{name: "fenced and clamped", reply: "```json\n[1.5, 0]\n```", want: []float64{1, 0}},
+		{name: "wrong length", reply: "[0.8]", wantErr: true},
+		{name: "not json", reply: "the first one", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &generateProvider{FakeProvider: llm.NewFakeProvider(16), reply: tt.reply}
+			scores, ok, err := NewListwiseScorer(provider).Score(context.Background(), "Where does Alice work?", candidates)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Score: %v", err)
+			}
+			for i, want := range tt.want {
+				if !ok[i] || scores[i] != want {
+					t.Errorf("doc %d: got %v (ok %v), want %v", i, scores[i], ok[i], want)
+				}
+			}
+			if !strings.Contains(provider.prompt, "[2] The weather was sunny") {
+				t.Errorf("prompt does not list the documents:\n%s", provider.prompt)
+			}
+		})
+	}
+}
+
+func TestRerankerDoesNotCacheListwise(t *testing.T) {
+	candidates := []models.RetrievalResult{
+		episodeResult("a", "Alice works at Google", 0.9),
+		episodeResult("b", "The weather was sunny", 0.2),
+	}
+	provider := &generateProvider{FakeProvider: llm.NewFakeProvider(16), reply: "[0.8, -0.2]"}
+	cache := NewLRUCache(0)
+
+	r := NewReranker(NewListwiseScorer(provider), cache, nil, configs.DIGConfig{MinScore: -1})
+	if _, err := r.Rerank(context.Background(), "user-1", "Where does Alice work?", candidates); err != nil {
+		t.Fatalf("Rerank: %v", err)
+	}
+	if cache.Len() != 0 {
+		t.Errorf("cached %d listwise scores, want none", cache.Len())
+	}
+}
+
+func TestCrossEncoderScorer(t *testing.T) {
+	var got rerankRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rerank" || r.Header.Get("authorization") != "Bearer secret" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		// Results come back sorted by score, not by input order.
+		json.NewEncoder(w).Encode([]rerankResult{{Index: 1, Score: 3.2}, {Index: 0, Score: -4.1}})
+	}))
+	defer srv.Close()
+
+	candidates := digCandidates(
+		episodeResult("a", "The weather was sunny", 0.2),
+		episodeResult("b", "Alice works at Google", 0.9),
+	)
+	s := NewCrossEncoderScorer(configs.CrossEncoderConfig{URL: srv.URL + "/", APIKey: "secret"})
+	scores, ok, err := s.Score(context.Background(), "Where does Alice work?", candidates)
+	if err != nil {
+		t.Fatalf("Score: %v", err)
+	}
+	if !ok[0] || !ok[1] || scores[0] != -4.1 || scores[1] != 3.2 {
+		t.Errorf("scores = %v (ok %v), want [-4.1 3.2]", scores, ok)
+	}
+	if !got.RawScores || len(got.Texts) != 2 || got.Texts[1] != "Alice works at Google" {
+		t.Errorf("request = %+v", got)
+	}
+
+	srv.Close()
+	if _, _, err := s.Score(context.Background(), "q", candidates); err == nil {
+		t.Error("want error from an unreachable server")
+	}
+}
+
+func TestHeuristicScorerWeights(t *testing.T) {
+	old := episodeResult("old", "Alice works at Google", 0.5)
+	old.Episode.Timestamp = time.Now().Add(-30 * 24 * time.Hour)
+	fresh := episodeResult("fresh", "Alice works at Google", 0.5)
+	candidates := digCandidates(old, fresh)
+
+	defaults, _, _ := NewHeuristicScorer(configs.HeuristicConfig{}).Score(context.Background(), "", candidates)
+	if defaults[1] <= defaults[0] {
+		t.Errorf("default weights: fresh %v should outscore old %v", defaults[1], defaults[0])
+	}
+
+	similarityOnly := configs.HeuristicConfig{Similarity: 2}
+	scores, _, _ := NewHeuristicScorer(similarityOnly).Score(context.Background(), "", candidates)
+	if scores[0] != 1 || scores[1] != 1 {
+		t.Errorf("similarity-only scores = %v, want [1 1]", scores)
+	}
+}
+
+func TestNewScorer(t *testing.T) {
+	provider := llm.NewFakeProvider(16)
+	tests := []struct {
+		cfg     configs.DIGConfig
+		want    string
+		wantErr bool
+	}{
+		{cfg: configs.DIGConfig{}, want: ScorerLLM},
+		{cfg: configs.DIGConfig{Scorer: ScorerListwise}, want: ScorerListwise},
+		{cfg: configs.DIGConfig{Scorer: ScorerHeuristic}, want: ScorerHeuristic},
+		{cfg: configs.DIGConfig{Scorer: ScorerCrossEncoder, CrossEncoder: configs.CrossEncoderConfig{URL: "http://x"}}, want: ScorerCrossEncoder},
+		{cfg: configs.DIGConfig{Scorer: ScorerCrossEncoder}, wantErr: true},
+		{cfg: configs.DIGConfig{Scorer: "bm25"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		s, err := NewScorer(tt.cfg, provider)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewScorer(%q): want error", tt.cfg.Scorer)
+			}
+			continue
+		}
+		if err != nil || s.Name() != tt.want {
+			t.Errorf("NewScorer(%q) = %v, %v; want %s", tt.cfg.Scorer, s, err, tt.want)
+		}
+	}
+}
+
+func TestRerankerReportsScorer(t *testing.T) {
+	candidates := []models.RetrievalResult{
+		episodeResult("a", "Alice works at Google", 0.9),
+		episodeResult("b", "Alice likes hiking", 0.4),
+	}
+	provider := llm.NewFakeProvider(16)
+	provider.DIGErr = errors.New("llm down")
+
+	r := NewReranker(NewLLMScorer(provider, 0), nil, nil, configs.DIGConfig{FallbackEnabled: true})
+	got, err := r.Rerank(context.Background(), "user-1", "Where does Alice work", candidates)
+	if err != nil {
+		t.Fatalf("Rerank: %v", err)
+	}
+	for _, c := range got {
+		if c.Scorer != ScorerHeuristic {
+			t.Errorf("%s: scorer %q, want fallback %q", c.Result.Episode.ID, c.Scorer, ScorerHeuristic)
+		}
+	}
+
+	r = NewReranker(NewLLMScorer(llm.NewFakeProvider(16), 0), nil, nil, configs.DIGConfig{})
+	got, err = r.Rerank(context.Background(), "user-1", "Where does Alice work", candidates)
+	if err != nil || len(got) == 0 {
+		t.Fatalf("Rerank: %v, %d candidates", err, len(got))
+	}
+	if got[0].Scorer != ScorerLLM {
+		t.Errorf("scorer %q, want %q", got[0].Scorer, ScorerLLM)
+	}
+}
@@ -0,0 +1,530 @@
+// Package e2e exercises the full CMA pipeline against in-memory stores
+// and the deterministic fake LLM provider.
+package e2e
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/chat"
+	"github.com/memora/cma/internal/consolidation"
+	"github.com/memora/cma/internal/dig"
+	"github.com/memora/cma/internal/graphstore"
+	"github.com/memora/cma/internal/ingest"
+	"github.com/memora/cma/internal/knapsack"
+	"github.com/memora/cma/internal/llm"
+	"github.com/memora/cma/internal/metrics"
+	"github.com/memora/cma/internal/models"
+	"github.com/memora/cma/internal/retrieval"
+	"github.com/memora/cma/internal/segmentation"
+	"github.com/memora/cma/internal/vectorstore"
+	"github.com/memora/cma/internal/workspace"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const dim = 64
+
+// harness wires every service the way cmd/api does, minus the network.
+type harness struct {
+	vectorDB  *vectorstore.InMemoryStore
+	graphDB   *graphstore.InMemoryStore
+	ingest    *ingest.Service
+	worker    *consolidation.Worker
+	workspace *workspace.Workspace
+	provider  *llm.FakeProvider
+	chat      *chat.Service
+}
+
+// Prometheus metrics register globally, so the package shares one instance.
+var testMetrics = metrics.New()
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	provider := llm.NewFakeProvider(dim)
+	vectorDB := vectorstore.NewInMemoryStore(configs.QdrantConfig{VectorSize: dim})
+	graphDB, err := graphstore.NewInMemoryStore(configs.Neo4jConfig{})
+	if err != nil {
+		t.Fatalf("graph store: %v", err)
+	}
+
+	segmenter := segmentation.NewSurprisalEngine(provider, nil, configs.SegmentationConfig{
+		Gamma:            1.5,
+		WindowSize:       50,
+		MinEpisodeTokens: 5,
+		MaxEpisodeTokens: 200,
+	})
+
+	consolCfg := configs.ConsolidationConfig{DecayRate: 0.5, MaxUnconsolidated: 10}
+	worker := consolidation.NewWorker(
+		vectorDB,
+		provider,
+		consolidation.NewDBSCAN(0.3, 2),
+		consolidation.NewConflictResolver(graphDB, consolCfg.DecayRate),
+		consolCfg,
+		testMetrics,
+	)
+
+	knapsackCfg := configs.KnapsackConfig{TokenBudget: 512, ForceRecentTurns: 2}
+	retriever := retrieval.NewService(vectorDB, graphDB, provider, configs.RetrievalConfig{
+		VectorTopK:   10,
+		GraphMaxHops: 2,
+		Timeout:      5 * time.Second,
+	}, testMetrics)
+
+	ws := workspace.NewWorkspace(
+		retriever,
+		dig.NewReranker(dig.NewLLMScorer(provider, 0), dig.NewLRUCache(0), nil, configs.DIGConfig{MinScore: 0}),
+		knapsack.NewOptimizer(knapsackCfg, provider.Tokenizer()),
+		workspace.NewMemoryTurnStore(configs.WorkspaceConfig{}),
+		provider.Tokenizer(),
+		knapsackCfg,
+		testMetrics,
+	)
+
+	ingestSvc := ingest.NewService(segmenter, vectorDB, testMetrics)
+	return &harness{
+		vectorDB:  vectorDB,
+		graphDB:   graphDB,
+		ingest:    ingestSvc,
+		worker:    worker,
+		workspace: ws,
+		provider:  provider,
+		chat:      chat.NewService(ws, ingestSvc, provider, configs.ChatConfig{}),
+	}
+}
+
+func (h *harness) say(t *testing.T, userID, role, content string) {
+	t.Helper()
+	h.sayIn(t, userID, "", role, content)
+}
+
+// sayIn is say within a session.
+func (h *harness) sayIn(t *testing.T, userID, sessionID, role, content string) {
+	t.Helper()
+	if err := h.workspace.AddTurn(context.Background(), userID, sessionID, role, content); err != nil {
+		t.Fatalf("add turn: %v", err)
+	}
+	req := models.IngestRequest{UserID: userID, SessionID: sessionID, Content: content, Role: role}
+	if _, err := h.ingest.Ingest(context.Background(), req); err != nil {
+		t.Fatalf("ingest %q: %v", content, err)
+	}
+}
+
+func (h *harness) sleep(t *testing.T, userID string) {
+	t.Helper()
+	task, err := consolidation.NewConsolidateTask(userID)
+	if err != nil {
+		t.Fatalf("consolidate task: %v", err)
+	}
+	if err := h.worker.ProcessTask(context.Background(), task); err != nil {
+		t.Fatalf("consolidate: %v", err)
+	}
+}
+
+func TestIngestConsolidateQuery(t *testing.T) {
+	ctx := context.Background()
+	h := newHarness(t)
+
+	h.say(t, "alice", "user", "Alice works at Google as a senior engineer.")
+	h.say(t, "alice", "user", "Alice lives in Paris near the river.")
+	h.say(t, "bob", "user", "Bob works at Acme on rockets.")
+
+	pending, err := h.vectorDB.CountUnconsolidated(ctx, "alice")
+	if err != nil {
+		t.Fatalf("CountUnconsolidated: %v", err)
+	}
+	if pending != 2 {
+		t.Fatalf("pending episodes = %d, want 2", pending)
+	}
+
+	// Sleep cycle: episodes become graph facts and are marked consolidated.
+	h.sleep(t, "alice")
+
+	if pending, _ := h.vectorDB.CountUnconsolidated(ctx, "alice"); pending != 0 {
+		t.Errorf("pending after consolidation = %d, want 0", pending)
+	}
+	if pending, _ := h.vectorDB.CountUnconsolidated(ctx, "bob"); pending != 1 {
+		t.Errorf("bob's episodes were consolidated with alice's")
+	}
+
+	stats, err := h.graphDB.GetStats(ctx, "alice")
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if stats["edges"] != 2 {
+		t.Errorf("graph edges = %v, want 2", stats["edges"])
+	}
+
+	// A later, contradicting episode supersedes the old fact on the next sleep.
+	h.say(t, "alice", "user", "Alice lives in Berlin now.")
+	h.sleep(t, "alice")
+
+	facts, err := h.graphDB.TraverseHops(ctx, "alice", []string{"Alice"}, 1)
+	if err != nil {
+		t.Fatalf("TraverseHops: %v", err)
+	}
+	for _, f := range facts {
+		if strings.Contains(f.Episode.Content, "Paris") {
+			t.Errorf("superseded fact still valid: %q", f.Episode.Content)
+		}
+	}
+
+	// Wake read path: retrieval → DIG → knapsack → context.
+	resp, err := h.workspace.Query(ctx, models.QueryRequest{
+		UserID: "alice",
+		Query:  "Where does Alice work?",
+	})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+
+	if !strings.Contains(resp.Context, "Google") {
+		t.Errorf("context does not mention Google:\n%s", resp.Context)
+	}
+	if strings.Contains(resp.Context, "Acme") {
+		t.Errorf("context leaked another user's memory:\n%s", resp.Context)
+	}
+	if !strings.HasSuffix(resp.Context, "Where does Alice work?") {
+		t.Errorf("context does not end with the query:\n%s", resp.Context)
+	}
+	if resp.TokensUsed > resp.TokenBudget {
+		t.Errorf("tokens used %d exceed budget %d", resp.TokensUsed, resp.TokenBudget)
+	}
+
+	// The decision is recorded for /workspace/context.
+	sel := h.workspace.LastSelection("alice", "")
+	// The rendered context adds headings and the query to the packed items.
+	if sel == nil || sel.Query != "Where does Alice work?" || sel.TotalTokens >= resp.TokensUsed {
+		t.Fatalf("last selection = %+v, want the query's", sel)
+	}
+	if len(sel.Items) != len(resp.Sources)+2 { // + ForceRecentTurns
+		t.Errorf("selection has %d items, want every candidate and recent turn (%d)", len(sel.Items), len(resp.Sources)+2)
+	}
+	if h.workspace.LastSelection("alice", "other") != nil {
+		t.Error("selection recorded for another session")
+	}
+
+	var fromGraph bool
+	for _, src := range resp.Sources {
+		if src.Source == "graph" {
+			fromGraph = true
+		}
+		if src.Episode != nil && src.Episode.Embedding != nil {
+			t.Errorf("source %s returned with its embedding", src.Episode.ID)
+		}
+	}
+	if !fromGraph {
+		t.Errorf("no graph facts among sources")
+	}
+}
+
+func TestInProcessConsolidation(t *testing.T) {
+	ctx := context.Background()
+	h := newHarness(t)
+
+	h.say(t, "alice", "user", "Alice works at Google as a senior engineer.")
+	h.say(t, "alice", "user", "Alice lives in Paris near the river.")
+
+	// Without asynq and Redis, as with only in-memory stores, tasks run on
+	// the worker in-process.
+	scheduler := consolidation.NewScheduler(h.worker, h.vectorDB, nil, nil, configs.ConsolidationConfig{})
+	if _, err := scheduler.Enqueue(ctx, "alice"); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pending, err := h.vectorDB.CountUnconsolidated(ctx, "alice")
+		if err != nil {
+			t.Fatalf("CountUnconsolidated: %v", err)
+		}
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pending episodes = %d after in-process consolidation, want 0", pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSessionScoping(t *testing.T) {
+	ctx := context.Background()
+	h := newHarness(t)
+
+	h.sayIn(t, "alice", "trip", "user", "Alice is booking a hotel in Kyoto for April.")
+	h.sayIn(t, "alice", "work", "user", "Alice is migrating the billing service to Go.")
+
+	query := func(scope string) (recent, memories string) {
+		t.Helper()
+		resp, err := h.workspace.Query(ctx, models.QueryRequest{
+			UserID:    "alice",
+			Query:     "What is Alice doing?",
+			SessionID: "trip",
+			Scope:     scope,
+		})
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		recent, memories, _ = strings.Cut(resp.Context, "## Retrieved Memories")
+		return recent, memories
+	}
+
+	// Recent turns come from the query's session only.
+	recent, memories := query(models.ScopeUser)
+	if !strings.Contains(recent, "Kyoto") || strings.Contains(recent, "billing") {
+		t.Errorf("recent turns not scoped to the session:\n%s", recent)
+	}
+	if !strings.Contains(memories, "billing") {
+		t.Errorf("user scope did not search other sessions:\n%s", memories)
+	}
+
+	_, memories = query(models.ScopeSession)
+	if strings.Contains(memories, "billing") {
+		t.Errorf("session scope leaked another session's memory:\n%s", memories)
+	}
+}
+
+func TestConcurrentQueryBudgets(t *testing.T) {
+	ctx := context.Background()
+	h := newHarness(t)
+
+	h.say(t, "alice", "user", "Alice works at Google as a senior engineer.")
+	h.say(t, "alice", "user", "Alice lives in Paris near the river.")
+	h.say(t, "alice", "user", "Alice plays the cello in a quartet on Sundays.")
+
+	query := func(budget int) (*models.QueryResponse, error) {
+		return h.workspace.Query(ctx, models.QueryRequest{
+			UserID:      "alice",
+			Query:       "What does Alice do?",
+			TokenBudget: budget,
+		})
+	}
+
+	// Each budget's packing, run alone, is what it must get under load.
+	budgets := []int{24, 48, 512}
+	want := make(map[int]int)
+	for _, budget := range budgets {
+		resp, err := query(budget)
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		want[budget] = resp.TokensUsed
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		budget := budgets[i%len(budgets)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := query(budget)
+			if err != nil {
+				t.Errorf("Query: %v", err)
+				return
+			}
+			if resp.TokenBudget != budget || resp.TokensUsed != want[budget] {
+				t.Errorf("budget %d: got budget %d, %d tokens used; want %d", budget, resp.TokenBudget, resp.TokensUsed, want[budget])
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestQueryReportsSections(t *testing.T) {
+	h := newHarness(t)
+	h.say(t, "alice", "user", "Alice works at Google as a senior engineer.")
+
+	resp, err := h.workspace.Query(context.Background(), models.QueryRequest{
+		UserID:  "alice",
+		Query:   "Where does Alice work?",
+		Profile: []string{"Alice prefers short answers."},
+	})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+
+	profile, rest, ok := strings.Cut(resp.Context, "## Recent Conversation")
+	if !ok || !strings.Contains(profile, "## User Profile\nAlice prefers short answers.") {
+		t.Errorf("profile not packed ahead of the conversation:\n%s", resp.Context)
+	}
+	if !strings.Contains(rest, "Google") {
+		t.Errorf("context does not mention Google:\n%s", resp.Context)
+	}
+
+	used := 0
+	for _, section := range []string{models.SectionProfile, models.SectionTurns, models.SectionEpisodes} {
+		if resp.Sections[section].Used == 0 {
+			t.Errorf("section %s unused: %+v", section, resp.Sections)
+		}
+		used += resp.Sections[section].Used
+	}
+	if used >= resp.TokensUsed {
+		t.Errorf("sections use %d tokens, rendered context %d", used, resp.TokensUsed)
+	}
+	if resp.Sections[models.SectionQuery].Used == 0 {
+		t.Errorf("query tokens not reported: %+v", resp.Sections)
+	}
+}
+
+func TestQueryPacksSeveralFacts(t *testing.T) {
+	h := newHarness(t)
+	h.say(t, "alice", "user", "Alice works at Google as a senior engineer.")
+	h.say(t, "alice", "user", "Alice lives in Paris near the river.")
+	h.sleep(t, "alice")
+
+	// Graph results have no episode ID; each fact must survive the merge.
+	resp, err := h.workspace.Query(context.Background(), models.QueryRequest{
+		UserID: "alice",
+		Query:  "Alice works at Google and lives in Paris?",
+	})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+
+	sel := h.workspace.LastSelection("alice", "")
+	if sel == nil {
+		t.Fatal("no selection recorded")
+	}
+	var facts []string
+	for _, item := range sel.Items {
+		if item.Section == models.SectionFacts && item.Status == models.ItemKept {
+			facts = append(facts, item.Content)
+		}
+	}
+	if len(facts) < 2 {
+		t.Errorf("kept facts = %q, want both of Alice's facts", facts)
+	}
+	if resp.Sections[models.SectionFacts].Used == 0 {
+		t.Errorf("facts section unused: %+v", resp.Sections)
+	}
+}
+
+func TestChatAnswersFromMemory(t *testing.T) {
+	ctx := context.Background()
+	h := newHarness(t)
+	h.say(t, "alice", "user", "Alice works at Google as a senior engineer.")
+
+	h.provider.Generations = map[string]string{
+		"Where does Alice work?": "At Google [Memory 1].",
+	}
+
+	var streamed strings.Builder
+	resp, err := h.chat.Chat(ctx, models.ChatRequest{UserID: "alice", Message: "Where does Alice work?"}, func(delta string) error {
+		streamed.WriteString(delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if resp.Answer != "At Google [Memory 1]." || streamed.String() != resp.Answer {
+		t.Errorf("answer %q, streamed %q", resp.Answer, streamed.String())
+	}
+	if len(resp.Citations) != 1 || resp.Sources[0].Episode == nil || resp.Citations[0].EpisodeID != resp.Sources[0].Episode.ID {
+		t.Errorf("citations = %+v, want the Google episode %+v", resp.Citations, resp.Sources)
+	}
+
+	// Both sides of the exchange are remembered.
+	pending, err := h.vectorDB.CountUnconsolidated(ctx, "alice")
+	if err != nil || pending != 3 {
+		t.Errorf("pending episodes = %d (%v), want the fact, the question and the answer", pending, err)
+	}
+	next, err := h.workspace.Query(ctx, models.QueryRequest{UserID: "alice", Query: "anything else?"})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if !strings.Contains(next.Context, "At Google [Memory 1].") {
+		t.Errorf("answer missing from recent turns:\n%s", next.Context)
+	}
+}
+
+// chatRecorder records the conversations the provider is asked to answer.
+type chatRecorder struct {
+	*llm.FakeProvider
+	messages []models.ChatMessage
+}
+
+func (p *chatRecorder) Chat(ctx context.Context, messages []models.ChatMessage, onDelta func(delta string) error) (string, error) {
+	p.messages = messages
+	return p.FakeProvider.Chat(ctx, messages, onDelta)
+}
+
+func TestChatCompletionsInjectMemory(t *testing.T) {
+	ctx := context.Background()
+	h := newHarness(t)
+	h.say(t, "alice", "user", "Alice works at Google as a senior engineer.")
+	h.provider.Generations = map[string]string{"Where does Alice work?": "At Google."}
+
+	recorder := &chatRecorder{FakeProvider: h.provider}
+	svc := chat.NewService(h.workspace, h.ingest, recorder, configs.ChatConfig{})
+	req := openai.ChatCompletionRequest{
+		Model: "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "Be terse."},
+			{Role: openai.ChatMessageRoleUser, Content: "Hi"},
+			{Role: openai.ChatMessageRoleAssistant, Content: "Hello!"},
+			{Role: openai.ChatMessageRoleUser, Content: "Where does Alice work?"},
+		},
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+	}
+
+	var chunks []openai.ChatCompletionStreamResponse
+	err := svc.CompleteStream(ctx, "alice", req, func(c openai.ChatCompletionStreamResponse) error {
+		chunks = append(chunks, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("CompleteStream: %v", err)
+	}
+
+	// The memories follow the client's system prompt; its conversation,
+	// not the stored turns, carries the dialogue.
+	got := recorder.messages
+	if len(got) != 5 || got[0].Content != "Be terse." || got[1].Role != "system" || got[4].Content != "Where does Alice work?" {
+		t.Fatalf("forwarded messages = %+v", got)
+	}
+	if !strings.Contains(got[1].Content, "[Memory 1] Alice works at Google") {
+		t.Errorf("memory message lacks the Google episode:\n%s", got[1].Content)
+	}
+
+	var answer strings.Builder
+	for _, c := range chunks {
+		if c.ID != chunks[0].ID || c.Model != "gpt-4o" {
+			t.Errorf("chunk %+v does not belong to the completion", c)
+		}
+		for _, choice := range c.Choices {
+			answer.WriteString(choice.Delta.Content)
+		}
+	}
+	n := len(chunks)
+	if n < 4 || chunks[0].Choices[0].Delta.Role != "assistant" || answer.String() != "At Google." {
+		t.Fatalf("streamed %q in %d chunks", answer.String(), n)
+	}
+	if chunks[n-2].Choices[0].FinishReason != openai.FinishReasonStop || chunks[n-1].Usage == nil || chunks[n-1].Usage.CompletionTokens == 0 {
+		t.Errorf("final chunks = %+v, %+v", chunks[n-2], chunks[n-1])
+	}
+
+	// The exchange is ingested; no turns are stored for it.
+	pending, err := h.vectorDB.CountUnconsolidated(ctx, "alice")
+	if err != nil || pending != 3 {
+		t.Errorf("pending episodes = %d (%v), want the fact, the question and the answer", pending, err)
+	}
+	q, err := h.workspace.Query(ctx, models.QueryRequest{UserID: "alice", Query: "anything else?"})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if q.Sections[models.SectionTurns].Used != h.provider.CountTokens("Alice works at Google as a senior engineer.") {
+		t.Errorf("turns section = %+v, want only the stored turn", q.Sections[models.SectionTurns])
+	}
+
+	req.Messages = req.Messages[:1]
+	if _, err := svc.Complete(ctx, "alice", req); !errors.Is(err, chat.ErrNoUserMessage) {
+		t.Errorf("Complete without a user message: %v, want ErrNoUserMessage", err)
+	}
+}
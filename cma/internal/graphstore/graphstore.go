@@ -2,7 +2,9 @@ package graphstore
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/memora/cma/configs"
 	"github.com/memora/cma/internal/models"
 )
 
@@ -31,9 +33,27 @@ type GraphStore interface {
 	// closes its validity window.
 	ResolveConflict(ctx context.Context, conflict models.ConflictRecord, decayRate float64) error
 
+	// Retract closes the validity window of the user's currently-valid
+	// relationships among relIDs, keeping them as history, and returns how
+	// many were retracted. Other users' relationships are left untouched.
+	Retract(ctx context.Context, userID string, relIDs []string) (int, error)
+
 	// GetStats retrieves statistics about the knowledge graph.
 	GetStats(ctx context.Context, userID string) (map[string]interface{}, error)
 
 	// Close releases database resources.
 	Close(ctx context.Context) error
 }
+
+// New creates the GraphStore selected by cfg.Backend.
+// Supported backends are "neo4j" (default) and "memory".
+func New(cfg configs.Neo4jConfig) (GraphStore, error) {
+	switch cfg.Backend {
+	case "", "neo4j":
+		return NewNeo4jStore(cfg)
+	case "memory":
+		return NewInMemoryStore(cfg)
+	default:
+		return nil, fmt.Errorf("unknown graph store backend %q", cfg.Backend)
+	}
+}
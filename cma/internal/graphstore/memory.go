@@ -0,0 +1,435 @@
+package graphstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/models"
+)
+
+// InMemoryStore implements GraphStore as a pure-Go in-process graph.
+//
+// It mirrors the Neo4jStore semantics: entities are merged by
+// (name, user_id), relationships carry bi-temporal metadata, conflict
+// resolution closes valid_to and decays confidence, and traversal only
+// follows currently-valid edges.
+//
+// When a snapshot path is configured, the graph is loaded from it on
+// startup and rewritten after every mutation, which is adequate for the
+// small graphs of single-node deployments.
+type InMemoryStore struct {
+	mu            sync.RWMutex
+	entities      map[entityKey]*memEntity
+	relationships map[string]*memRelationship
+	snapshotPath  string
+}
+
+type entityKey struct {
+	userID string
+	name   string
+}
+
+type memEntity struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	UserID       string    `json:"user_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastAccessed time.Time `json:"last_accessed"`
+}
+
+type memRelationship struct {
+	models.GraphRelationship
+	UserID   string `json:"user_id"`
+	FromName string `json:"from_name"`
+	ToName   string `json:"to_name"`
+}
+
+// graphSnapshot is the on-disk JSON representation of the graph.
+type graphSnapshot struct {
+	Entities      []*memEntity       `json:"entities"`
+	Relationships []*memRelationship `json:"relationships"`
+}
+
+// NewInMemoryStore creates a new in-memory GraphStore, restoring the
+// snapshot at cfg.SnapshotPath if one exists.
+func NewInMemoryStore(cfg configs.Neo4jConfig) (*InMemoryStore, error) {
+	g := &InMemoryStore{
+		entities:      make(map[entityKey]*memEntity),
+		relationships: make(map[string]*memRelationship),
+		snapshotPath:  cfg.SnapshotPath,
+	}
+
+	if g.snapshotPath != "" {
+		if err := g.load(); err != nil {
+			return nil, fmt.Errorf("graph snapshot load: %w", err)
+		}
+	}
+
+	return g, nil
+}
+
+// EnsureSchema is a no-op; the in-memory graph has no schema.
+func (g *InMemoryStore) EnsureSchema(ctx context.Context) error {
+	slog.Info("in-memory graph store ready", "snapshot", g.snapshotPath)
+	return nil
+}
+
+// InsertTriple merges the subject and object entities and creates a new
+// relationship between them with bi-temporal metadata.
+func (g *InMemoryStore) InsertTriple(ctx context.Context, userID string, triple models.Triple, sourceEpID string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now().UTC()
+	subject := g.mergeEntity(userID, triple.Subject, now)
+	object := g.mergeEntity(userID, triple.Object, now)
+
+	rel := &memRelationship{
+		GraphRelationship: models.GraphRelationship{
+			ID:              uuid.New().String(),
+			FromEntityID:    subject.ID,
+			ToEntityID:      object.ID,
+			RelationType:    triple.Predicate,
+			Confidence:      triple.Confidence,
+			ValidFrom:       now,
+			TransactionTime: now,
+			SourceEpisodeID: sourceEpID,
+			DecayRate:       1.0,
+		},
+		UserID:   userID,
+		FromName: subject.Name,
+		ToName:   object.Name,
+	}
+	g.relationships[rel.ID] = rel
+
+	return g.persist()
+}
+
+// QueryBySubject retrieves all currently-valid relationships for a subject entity.
+func (g *InMemoryStore) QueryBySubject(ctx context.Context, userID string, subject string) ([]models.GraphRelationship, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	now := time.Now().UTC()
+	var rels []models.GraphRelationship
+	for _, rel := range g.relationships {
+		if rel.UserID == userID && rel.FromName == subject && rel.validAt(now) {
+			r := rel.GraphRelationship
+			r.FromName, r.ToName = rel.FromName, rel.ToName
+			rels = append(rels, r)
+		}
+	}
+
+	sort.Slice(rels, func(i, j int) bool {
+		return rels[i].Confidence > rels[j].Confidence
+	})
+
+	return rels, nil
+}
+
+// TraverseHops returns every currently-valid relationship lying on an
+// undirected path of at most maxHops edges from one of the seed entities.
+func (g *InMemoryStore) TraverseHops(ctx context.Context, userID string, seedEntities []string, maxHops int) ([]models.RetrievalResult, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	now := time.Now().UTC()
+
+	// Adjacency over valid edges, keyed by entity name (names are unique per user).
+	adjacency := make(map[string][]*memRelationship)
+	for _, rel := range g.relationships {
+		if rel.UserID != userID || !rel.validAt(now) {
+			continue
+		}
+		adjacency[rel.FromName] = append(adjacency[rel.FromName], rel)
+		adjacency[rel.ToName] = append(adjacency[rel.ToName], rel)
+	}
+
+	// BFS from all seeds; an edge is reachable within maxHops when one of
+	// its endpoints is at most maxHops-1 hops away from a seed.
+	dist := make(map[string]int)
+	var frontier []string
+	for _, seed := range seedEntities {
+		if _, ok := g.entities[entityKey{userID: userID, name: seed}]; !ok {
+			continue
+		}
+		if _, seen := dist[seed]; !seen {
+			dist[seed] = 0
+			frontier = append(frontier, seed)
+		}
+	}
+
+	visited := make(map[string]*memRelationship)
+	for depth := 0; depth < maxHops && len(frontier) > 0; depth++ {
+		var next []string
+		for _, name := range frontier {
+			for _, rel := range adjacency[name] {
+				visited[rel.ID] = rel
+
+				neighbor := rel.ToName
+				if neighbor == name {
+					neighbor = rel.FromName
+				}
+				if _, seen := dist[neighbor]; !seen {
+					dist[neighbor] = depth + 1
+					next = append(next, neighbor)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	rels := make([]*memRelationship, 0, len(visited))
+	for _, rel := range visited {
+		rels = append(rels, rel)
+	}
+	sort.Slice(rels, func(i, j int) bool {
+		return rels[i].Confidence > rels[j].Confidence
+	})
+	if len(rels) > 50 {
+		rels = rels[:50]
+	}
+
+	results := make([]models.RetrievalResult, 0, len(rels))
+	for _, rel := range rels {
+		results = append(results, models.RetrievalResult{
+			GraphFacts: []models.Triple{
+				{
+					Subject:    rel.FromName,
+					Predicate:  rel.RelationType,
+					Object:     rel.ToName,
+					Confidence: rel.Confidence,
+				},
+			},
+			Score:  rel.Confidence,
+			Source: "graph",
+			Episode: &models.Episode{
+				Content: fmt.Sprintf("%s %s %s", rel.FromName, rel.RelationType, rel.ToName),
+			},
+		})
+	}
+
+	return results, nil
+}
+
+// FindConflicts returns currently-valid relationships with the same subject
+// and predicate as triple but a different object.
+func (g *InMemoryStore) FindConflicts(ctx context.Context, userID string, triple models.Triple) ([]models.ConflictRecord, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	now := time.Now().UTC()
+	var conflicts []models.ConflictRecord
+	for _, rel := range g.relationships {
+		if rel.UserID != userID || rel.FromName != triple.Subject || rel.RelationType != triple.Predicate {
+			continue
+		}
+		if rel.ToName == triple.Object || !rel.validAt(now) {
+			continue
+		}
+
+		conflicts = append(conflicts, models.ConflictRecord{
+			ExistingRelID: rel.ID,
+			ExistingTriple: models.Triple{
+				Subject:    rel.FromName,
+				Predicate:  rel.RelationType,
+				Object:     rel.ToName,
+				Confidence: rel.Confidence,
+			},
+			NewTriple:  triple,
+			DetectedAt: now,
+			Resolution: "",
+		})
+	}
+
+	return conflicts, nil
+}
+
+// ResolveConflict closes the existing relationship's valid_to window and
+// decays its confidence.
+func (g *InMemoryStore) ResolveConflict(ctx context.Context, conflict models.ConflictRecord, decayRate float64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	rel, ok := g.relationships[conflict.ExistingRelID]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	rel.ValidTo = &now
+	rel.DecayRate = decayRate
+	rel.Confidence *= decayRate
+
+	return g.persist()
+}
+
+// Retract closes valid_to on the user's currently-valid relationships
+// among relIDs.
+func (g *InMemoryStore) Retract(ctx context.Context, userID string, relIDs []string) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now().UTC()
+	retracted := 0
+	for _, id := range relIDs {
+		rel, ok := g.relationships[id]
+		if !ok || rel.UserID != userID || !rel.validAt(now) {
+			continue
+		}
+		closed := now
+		rel.ValidTo = &closed
+		retracted++
+	}
+	if retracted == 0 {
+		return 0, nil
+	}
+
+	return retracted, g.persist()
+}
+
+// GetStats returns the user's entity count and currently-valid edge count.
+func (g *InMemoryStore) GetStats(ctx context.Context, userID string) (map[string]interface{}, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	nodes := 0
+	for key := range g.entities {
+		if key.userID == userID {
+			nodes++
+		}
+	}
+
+	now := time.Now().UTC()
+	edges := 0
+	for _, rel := range g.relationships {
+		if rel.UserID == userID && rel.validAt(now) {
+			edges++
+		}
+	}
+
+	return map[string]interface{}{
+		"nodes": nodes,
+		"edges": edges,
+	}, nil
+}
+
+// Close writes a final snapshot if one is configured.
+func (g *InMemoryStore) Close(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.persist()
+}
+
+// --- Helpers ---
+
+// mergeEntity returns the entity for (userID, name), creating it if needed.
+// Callers must hold the write lock.
+func (g *InMemoryStore) mergeEntity(userID, name string, now time.Time) *memEntity {
+	key := entityKey{userID: userID, name: name}
+	if e, ok := g.entities[key]; ok {
+		e.LastAccessed = now
+		return e
+	}
+
+	e := &memEntity{
+		ID:           uuid.New().String(),
+		Name:         name,
+		UserID:       userID,
+		CreatedAt:    now,
+		LastAccessed: now,
+	}
+	g.entities[key] = e
+	return e
+}
+
+// validAt reports whether the relationship's validity window contains t.
+func (r *memRelationship) validAt(t time.Time) bool {
+	return r.ValidTo == nil || r.ValidTo.After(t)
+}
+
+// persist atomically rewrites the snapshot file. Callers must hold the lock.
+func (g *InMemoryStore) persist() error {
+	if g.snapshotPath == "" {
+		return nil
+	}
+
+	snap := graphSnapshot{
+		Entities:      make([]*memEntity, 0, len(g.entities)),
+		Relationships: make([]*memRelationship, 0, len(g.relationships)),
+	}
+	for _, e := range g.entities {
+		snap.Entities = append(snap.Entities, e)
+	}
+	for _, r := range g.relationships {
+		snap.Relationships = append(snap.Relationships, r)
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("graph snapshot encode: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(g.snapshotPath), filepath.Base(g.snapshotPath)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("graph snapshot write: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("graph snapshot write: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("graph snapshot write: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), g.snapshotPath); err != nil {
+		return fmt.Errorf("graph snapshot write: %w", err)
+	}
+
+	return nil
+}
+
+// load restores the graph from the snapshot file, if it exists.
+func (g *InMemoryStore) load() error {
+	data, err := os.ReadFile(g.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snap graphSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+
+	for _, e := range snap.Entities {
+		g.entities[entityKey{userID: e.UserID, name: e.Name}] = e
+	}
+	for _, r := range snap.Relationships {
+		g.relationships[r.ID] = r
+	}
+
+	slog.Info("graph snapshot loaded",
+		"path", g.snapshotPath,
+		"entities", len(snap.Entities),
+		"relationships", len(snap.Relationships),
+	)
+
+	return nil
+}
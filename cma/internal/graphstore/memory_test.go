@@ -0,0 +1,132 @@
+package graphstore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/models"
+)
+
+func TestInMemoryStoreTraverseHops(t *testing.T) {
+	ctx := context.Background()
+	g, err := NewInMemoryStore(configs.Neo4jConfig{})
+	if err != nil {
+		t.Fatalf("NewInMemoryStore: %v", err)
+	}
+
+	// Alice -> Google -> Mountain View -> California, plus another user's edge.
+	chain := []models.Triple{
+		{Subject: "Alice", Predicate: "works_at", Object: "Google", Confidence: 0.9},
+		{Subject: "Google", Predicate: "based_in", Object: "Mountain View", Confidence: 0.8},
+		{Subject: "Mountain View", Predicate: "located_in", Object: "California", Confidence: 0.7},
+	}
+	for _, tr := range chain {
+		if err := g.InsertTriple(ctx, "u1", tr, "ep"); err != nil {
+			t.Fatalf("InsertTriple: %v", err)
+		}
+	}
+	if err := g.InsertTriple(ctx, "u2", chain[0], "ep"); err != nil {
+		t.Fatalf("InsertTriple: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		userID  string
+		seeds   []string
+		maxHops int
+		want    int
+	}{
+		{"one hop", "u1", []string{"Alice"}, 1, 1},
+		{"two hops", "u1", []string{"Alice"}, 2, 2},
+		{"traverses against edge direction", "u1", []string{"California"}, 2, 2},
+		{"unknown seed", "u1", []string{"Bob"}, 2, 0},
+		{"scoped to user", "u2", []string{"Alice"}, 3, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := g.TraverseHops(ctx, tt.userID, tt.seeds, tt.maxHops)
+			if err != nil {
+				t.Fatalf("TraverseHops: %v", err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("got %d facts, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestInMemoryStoreSnapshot(t *testing.T) {
+	ctx := context.Background()
+	cfg := configs.Neo4jConfig{SnapshotPath: filepath.Join(t.TempDir(), "graph.json")}
+
+	g, err := NewInMemoryStore(cfg)
+	if err != nil {
+		t.Fatalf("NewInMemoryStore: %v", err)
+	}
+	old := models.Triple{Subject: "Alice", Predicate: "lives_in", Object: "Paris", Confidence: 0.8}
+	if err := g.InsertTriple(ctx, "u1", old, "ep1"); err != nil {
+		t.Fatalf("InsertTriple: %v", err)
+	}
+	conflicts, err := g.FindConflicts(ctx, "u1", models.Triple{Subject: "Alice", Predicate: "lives_in", Object: "Berlin"})
+	if err != nil || len(conflicts) != 1 {
+		t.Fatalf("FindConflicts = %v, %v; want one conflict", conflicts, err)
+	}
+	if err := g.ResolveConflict(ctx, conflicts[0], 0.5); err != nil {
+		t.Fatalf("ResolveConflict: %v", err)
+	}
+	if err := g.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	restored, err := NewInMemoryStore(cfg)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	stats, _ := restored.GetStats(ctx, "u1")
+	if stats["nodes"] != 2 || stats["edges"] != 0 {
+		t.Errorf("restored stats = %v, want 2 nodes and 0 valid edges", stats)
+	}
+
+	rel := restored.relationships[conflicts[0].ExistingRelID]
+	if rel == nil || rel.ValidTo == nil || rel.Confidence != 0.4 {
+		t.Errorf("restored relationship lost its resolution: %+v", rel)
+	}
+}
+
+func TestInMemoryStoreRetract(t *testing.T) {
+	ctx := context.Background()
+	g, err := NewInMemoryStore(configs.Neo4jConfig{})
+	if err != nil {
+		t.Fatalf("NewInMemoryStore: %v", err)
+	}
+
+	fact := models.Triple{Subject: "Alice", Predicate: "works_at", Object: "Google", Confidence: 0.9}
+	for _, user := range []string{"u1", "u2"} {
+		if err := g.InsertTriple(ctx, user, fact, "ep"); err != nil {
+			t.Fatalf("InsertTriple: %v", err)
+		}
+	}
+	mine, _ := g.QueryBySubject(ctx, "u1", "Alice")
+	theirs, _ := g.QueryBySubject(ctx, "u2", "Alice")
+	if len(mine) != 1 || mine[0].FromName != "Alice" || mine[0].ToName != "Google" {
+		t.Fatalf("QueryBySubject = %+v, want Alice works_at Google with names", mine)
+	}
+
+	// Another user's ID and an unknown one are not retracted.
+	n, err := g.Retract(ctx, "u1", []string{mine[0].ID, theirs[0].ID, "missing"})
+	if err != nil || n != 1 {
+		t.Fatalf("Retract = %d, %v; want 1", n, err)
+	}
+	if got, _ := g.QueryBySubject(ctx, "u1", "Alice"); len(got) != 0 {
+		t.Errorf("retracted fact still valid: %+v", got)
+	}
+	if got, _ := g.QueryBySubject(ctx, "u2", "Alice"); len(got) != 1 {
+		t.Errorf("other user's fact retracted")
+	}
+	if n, _ := g.Retract(ctx, "u1", []string{mine[0].ID}); n != 0 {
+		t.Errorf("retracting twice = %d, want 0", n)
+	}
+}
@@ -328,6 +328,37 @@ func (n *Neo4jStore) ResolveConflict(ctx context.Context, conflict models.Confli
 	return nil
 }
 
+// Retract closes the valid_to window of the user's currently-valid
+// relationships among relIDs.
+func (n *Neo4jStore) Retract(ctx context.Context, userID string, relIDs []string) (int, error) {
+	session := n.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: n.database, AccessMode: neo4j.AccessModeWrite})
+	defer session.Close(ctx)
+
+	cypher := `
+		MATCH (:Entity {user_id: $user_id})-[r:RELATES_TO]->()
+		WHERE r.id IN $rel_ids AND (r.valid_to IS NULL OR r.valid_to > datetime())
+		SET r.valid_to = datetime($now)
+		RETURN count(r) AS retracted
+	`
+
+	result, err := session.Run(ctx, cypher, map[string]any{
+		"user_id": userID,
+		"rel_ids": relIDs,
+		"now":     time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("neo4j retract: %w", err)
+	}
+
+	record, err := result.Single(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("neo4j retract: %w", err)
+	}
+	retracted, _ := record.Get("retracted")
+	count, _ := retracted.(int64)
+	return int(count), nil
+}
+
 // Close releases the Neo4j driver.
 func (n *Neo4jStore) Close(ctx context.Context) error {
 	return n.driver.Close(ctx)
@@ -344,6 +375,12 @@ func recordToRelationship(record *neo4j.Record) models.GraphRelationship {
 	if v, ok := record.Get("predicate"); ok {
 		rel.RelationType = fmt.Sprintf("%v", v)
 	}
+	if v, ok := record.Get("from_name"); ok {
+		rel.FromName = fmt.Sprintf("%v", v)
+	}
+	if v, ok := record.Get("to_name"); ok {
+		rel.ToName = fmt.Sprintf("%v", v)
+	}
 	if v, ok := record.Get("confidence"); ok {
 		if c, ok := v.(float64); ok {
 			rel.Confidence = c
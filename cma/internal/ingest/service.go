@@ -6,6 +6,8 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/memora/cma/internal/metrics"
 	"github.com/memora/cma/internal/models"
 	"github.com/memora/cma/internal/segmentation"
@@ -19,14 +21,14 @@ import (
 // All writes here are to the vector store only — graph writes are
 // strictly reserved for the consolidation (Sleep) cycle.
 type Service struct {
-	segmenter  *segmentation.SurprisalEngine
+	segmenter  segmentation.Segmenter
 	vectorDB   vectorstore.VectorStore
 	metrics    *metrics.Metrics
 }
 
 // NewService creates a new ingest pipeline service.
 func NewService(
-	segmenter *segmentation.SurprisalEngine,
+	segmenter segmentation.Segmenter,
 	vectorDB vectorstore.VectorStore,
 	m *metrics.Metrics,
 ) *Service {
@@ -37,22 +39,31 @@ func NewService(
 	}
 }
 
-// Ingest processes raw text input through the CMA ingest pipeline.
-// Returns the generated episode IDs.
-func (s *Service) Ingest(ctx context.Context, userID string, content string, role string) (*models.IngestResponse, error) {
+// Ingest processes a message through the CMA ingest pipeline. Every
+// episode records the request's session, and req.Metadata (which may be
+// nil) is copied onto each one. Returns the generated episode IDs.
+func (s *Service) Ingest(ctx context.Context, req models.IngestRequest) (*models.IngestResponse, error) {
+	userID, content, role, metadata := req.UserID, req.Content, req.Role, req.Metadata
+
 	start := time.Now()
 	defer func() {
 		s.metrics.IngestLatency.Observe(time.Since(start).Seconds())
 	}()
 
+	// Every episode cut from this message records the message ID and its
+	// byte span within content, so callers can highlight its origin.
+	messageID := uuid.New().String()
+
 	slog.Info("ingest started",
 		"user_id", userID,
+		"session_id", req.SessionID,
+		"message_id", messageID,
 		"content_length", len(content),
 		"role", role,
 	)
 
-	// Step 1: Surprisal-based segmentation.
-	// This produces episodic fragments at event boundaries where
+	// Step 1: Event segmentation.
+	// This produces episodic fragments at event boundaries, by default where
 	// S > μ + γσ (Bayesian Surprise threshold).
 	episodes, err := s.segmenter.Segment(ctx, userID, content)
 	if err != nil {
@@ -61,20 +72,30 @@ func (s *Service) Ingest(ctx context.Context, userID string, content string, rol
 
 	if len(episodes) == 0 {
 		return &models.IngestResponse{
+			MessageID:  messageID,
 			EpisodeIDs: []string{},
 			Segments:   0,
 			Message:    "no episodes generated",
 		}, nil
 	}
 
-	// Step 2: Enrich episodes with metadata.
+	// Step 2: Enrich episodes with metadata. Caller metadata goes first so
+	// it cannot overwrite the pipeline's own keys.
+	ingestedAt := time.Now().UTC().Format(time.RFC3339)
 	for i := range episodes {
 		episodes[i].UserID = userID
-		if episodes[i].Metadata == nil {
-			episodes[i].Metadata = make(map[string]any)
+		episodes[i].SessionID = req.SessionID
+		meta := make(map[string]any, len(metadata)+len(episodes[i].Metadata)+3)
+		for k, v := range metadata {
+			meta[k] = v
+		}
+		for k, v := range episodes[i].Metadata {
+			meta[k] = v
 		}
-		episodes[i].Metadata["role"] = role
-		episodes[i].Metadata["ingested_at"] = time.Now().UTC().Format(time.RFC3339)
+		meta[models.MetaMessageID] = messageID
+		meta[models.MetaRole] = role
+		meta[models.MetaIngestedAt] = ingestedAt
+		episodes[i].Metadata = meta
 	}
 
 	s.metrics.SegmentsBoundary.Add(float64(len(episodes) - 1)) // boundaries = segments - 1
@@ -99,6 +120,7 @@ func (s *Service) Ingest(ctx context.Context, userID string, content string, rol
 	)
 
 	return &models.IngestResponse{
+		MessageID:  messageID,
 		EpisodeIDs: ids,
 		Segments:   len(episodes),
 		Message:    fmt.Sprintf("ingested %d episodic fragments", len(episodes)),
@@ -0,0 +1,102 @@
+package knapsack
+
+import (
+	"sort"
+
+	"github.com/memora/cma/internal/models"
+)
+
+// allocate splits budget between the sections of shares by water-filling.
+// Each section is offered its share of the pool; one that needs less than
+// that (its demand, in tokens) gets what it needs, and the rest is split
+// again among the others until every section is satisfied or the pool is
+// spent. Sections with no demand are allocated nothing, so unused budget
+// always spills over to the sections that can use it.
+func allocate(budget int, shares map[string]float64, demand map[string]int) map[string]int {
+	alloc := make(map[string]int, len(shares))
+	var open []string
+	for section, share := range shares {
+		alloc[section] = 0
+		if share > 0 && demand[section] > 0 {
+			open = append(open, section)
+		}
+	}
+	sort.Strings(open)
+
+	pool := budget
+	for len(open) > 0 && pool > 0 {
+		total := 0.0
+		for _, section := range open {
+			total += shares[section]
+		}
+
+		offered := pool
+		var unmet []string
+		for _, section := range open {
+			quota := int(float64(offered) * shares[section] / total)
+			if demand[section] <= quota {
+				alloc[section] = demand[section]
+				pool -= demand[section]
+			} else {
+				unmet = append(unmet, section)
+			}
+		}
+
+		// No section is satisfied by its share: split the pool and stop.
+		if len(unmet) == len(open) {
+			for _, section := range open {
+				alloc[section] = int(float64(pool) * shares[section] / total)
+			}
+			break
+		}
+		open = unmet
+	}
+	return alloc
+}
+
+// sectionDemand sums the token weights of the item groups by section.
+func sectionDemand(groups ...[]models.KnapsackItem) map[string]int {
+	demand := make(map[string]int)
+	for _, items := range groups {
+		for _, item := range items {
+			demand[item.Section] += item.Weight
+		}
+	}
+	return demand
+}
+
+// newestWithin returns the longest suffix of items, oldest first, that fits
+// in limit tokens.
+func newestWithin(items []models.KnapsackItem, limit int) []models.KnapsackItem {
+	i := len(items)
+	for i > 0 && items[i-1].Weight <= limit {
+		limit -= items[i-1].Weight
+		i--
+	}
+	return items[i:]
+}
+
+// firstWithin returns the longest prefix of items that fits in limit tokens.
+func firstWithin(items []models.KnapsackItem, limit int) []models.KnapsackItem {
+	i := 0
+	for i < len(items) && items[i].Weight <= limit {
+		limit -= items[i].Weight
+		i++
+	}
+	return items[:i]
+}
+
+// sectionUsage reports the tokens selected per section with the section's
+// allocation, if any.
+func sectionUsage(selected []models.KnapsackItem, alloc map[string]int) map[string]models.SectionUsage {
+	usage := make(map[string]models.SectionUsage, len(alloc))
+	for section, budget := range alloc {
+		usage[section] = models.SectionUsage{Budget: budget}
+	}
+	for _, item := range selected {
+		u := usage[item.Section]
+		u.Used += item.Weight
+		usage[item.Section] = u
+	}
+	return usage
+}
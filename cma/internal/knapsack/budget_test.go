@@ -0,0 +1,99 @@
+package knapsack
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/models"
+)
+
+func TestAllocate(t *testing.T) {
+	shares := map[string]float64{models.SectionTurns: 0.25, models.SectionFacts: 0.25, models.SectionEpisodes: 0.5}
+
+	tests := []struct {
+		name   string
+		budget int
+		shares map[string]float64
+		demand map[string]int
+		want   map[string]int
+	}{
+		{
+			name:   "every section wants more than its share",
+			budget: 100,
+			shares: shares,
+			demand: map[string]int{models.SectionTurns: 1000, models.SectionFacts: 1000, models.SectionEpisodes: 1000},
+			want:   map[string]int{models.SectionTurns: 25, models.SectionFacts: 25, models.SectionEpisodes: 50},
+		},
+		{
+			name:   "unused share spills over by share",
+			budget: 100,
+			shares: shares,
+			demand: map[string]int{models.SectionTurns: 1000, models.SectionFacts: 10, models.SectionEpisodes: 1000},
+			want:   map[string]int{models.SectionTurns: 30, models.SectionFacts: 10, models.SectionEpisodes: 60},
+		},
+		{
+			name:   "empty section gets nothing",
+			budget: 100,
+			shares: map[string]float64{models.SectionProfile: 0.1, models.SectionEpisodes: 0.9},
+			demand: map[string]int{models.SectionEpisodes: 1000},
+			want:   map[string]int{models.SectionProfile: 0, models.SectionEpisodes: 100},
+		},
+		{
+			name:   "everything fits",
+			budget: 100,
+			shares: shares,
+			demand: map[string]int{models.SectionTurns: 40, models.SectionFacts: 5, models.SectionEpisodes: 20},
+			want:   map[string]int{models.SectionTurns: 40, models.SectionFacts: 5, models.SectionEpisodes: 20},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allocate(tt.budget, tt.shares, tt.demand); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allocate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptimizerSectionShares(t *testing.T) {
+	o := NewOptimizer(configs.KnapsackConfig{TokenBudget: 100, ForceRecentTurns: 3}, nil)
+	candidates := []models.KnapsackItem{
+		{ID: "a", Value: 0.9, Weight: 30, Section: models.SectionEpisodes},
+		{ID: "b", Value: 0.8, Weight: 30, Section: models.SectionEpisodes},
+		{ID: "c", Value: 0.7, Weight: 30, Section: models.SectionEpisodes},
+	}
+	recent := turns(strings.Repeat("x", 40), strings.Repeat("y", 40), strings.Repeat("z", 40))
+
+	res := o.Optimize(candidates, recent, Options{
+		SectionShares: map[string]float64{models.SectionProfile: 0.1, models.SectionTurns: 0.2, models.SectionEpisodes: 0.7},
+		Pinned:        []models.KnapsackItem{{ID: "profile_1", Content: "Alice is vegan", Weight: 5}},
+	})
+
+	// The profile needs half its 10 tokens; turns and episodes split the
+	// rest 2:7, and episodes also get what the 21 turn tokens leave.
+	want := map[string]models.SectionUsage{
+		models.SectionProfile:  {Budget: 5, Used: 5},
+		models.SectionTurns:    {Budget: 21, Used: 20},
+		models.SectionEpisodes: {Budget: 75, Used: 60},
+	}
+	if !reflect.DeepEqual(res.Sections, want) {
+		t.Errorf("sections = %v, want %v", res.Sections, want)
+	}
+
+	var ids []string
+	for _, item := range res.Selected {
+		ids = append(ids, item.ID+":"+item.Section)
+	}
+	if ids[0] != "profile_1:profile" || !strings.HasPrefix(ids[1], "turn_") || !strings.HasPrefix(ids[2], "turn_") {
+		t.Errorf("selected %v, want the profile then two turns first", ids)
+	}
+	if got := res.Selected[1].Content; got[0] != 'y' {
+		t.Errorf("kept turn %q, want the newest two", got)
+	}
+	if res.TotalTokens > 100 {
+		t.Errorf("total tokens = %d, over budget", res.TotalTokens)
+	}
+}
@@ -1,10 +1,12 @@
 package knapsack
 
 import (
+	"math"
 	"sort"
 
 	"github.com/memora/cma/configs"
 	"github.com/memora/cma/internal/models"
+	"github.com/memora/cma/internal/tokenizer"
 )
 
 // Optimizer implements the 0/1 Knapsack context window packing via
@@ -19,17 +21,31 @@ import (
 //
 //	x_i = 1 iff v_i / w_i ≥ λ
 //
-// This yields O(n log n) complexity via greedy density sort.
+// The greedy rule is O(n log n) via density sort but can miss the optimum
+// when a few large items are valuable; the exact DP and branch-and-bound
+// solvers close that gap for the problem sizes they can afford (see Solver).
 // The optimizer always force-includes the last K conversation turns
 // (phonological loop in Baddeley's working memory model).
+//
+// The Optimizer holds only configuration: per-request parameters travel in
+// Options, so one instance is safe for concurrent use.
 type Optimizer struct {
-	tokenBudget      int     // W: total token budget
-	forceRecentTurns int     // K: number of recent turns to always include
+	tokenBudget      int     // default W: total token budget
+	forceRecentTurns int     // default K: number of recent turns to always include
 	lambdaInit       float64 // initial Lagrange multiplier
+
+	solver     string  // SolverAuto or a fixed solver name
+	dpMaxCells int     // auto: largest n·W solved by DP
+	bnbNodes   int     // branch-and-bound node limit
+	diversity  float64 // submodular: coverage weight α
+
+	tokenizer tokenizer.Tokenizer // weighs the forced conversation turns
 }
 
-// NewOptimizer creates a new Knapsack optimizer.
-func NewOptimizer(cfg configs.KnapsackConfig) *Optimizer {
+// NewOptimizer creates a new Knapsack optimizer. tok weighs conversation
+// turns and should be the one the candidates were weighed with; nil uses
+// the bytes/4 approximation.
+func NewOptimizer(cfg configs.KnapsackConfig, tok tokenizer.Tokenizer) *Optimizer {
 	budget := cfg.TokenBudget
 	if budget == 0 {
 		budget = 4096
@@ -43,60 +59,159 @@ func NewOptimizer(cfg configs.KnapsackConfig) *Optimizer {
 		lambda = 0.001
 	}
 
+	solver := cfg.Solver
+	if solver == "" {
+		solver = SolverAuto
+	}
+	dpMaxCells := cfg.DPMaxCells
+	if dpMaxCells == 0 {
+		dpMaxCells = 1 << 21
+	}
+	bnbNodes := cfg.BnBMaxNodes
+	if bnbNodes == 0 {
+		bnbNodes = 100000
+	}
+	diversity := 0.5
+	if cfg.Diversity != nil {
+		diversity = *cfg.Diversity
+	}
+	if tok == nil {
+		tok = tokenizer.Approx{}
+	}
+
 	return &Optimizer{
 		tokenBudget:      budget,
 		forceRecentTurns: recent,
 		lambdaInit:       lambda,
+		solver:           solver,
+		dpMaxCells:       dpMaxCells,
+		bnbNodes:         bnbNodes,
+		diversity:        diversity,
+		tokenizer:        tok,
 	}
 }
 
+// Options are the parameters of one Optimize call. Zero fields fall back to
+// the optimizer's configuration.
+type Options struct {
+	// TokenBudget is the total context window budget W.
+	TokenBudget int
+
+	// ForceRecentTurns is the number of recent turns K always included;
+	// negative includes none.
+	ForceRecentTurns int
+
+	// ReservedTokens are held back from the budget for text outside the
+	// packed items, such as the system prompt and the query.
+	ReservedTokens int
+
+	// SectionCaps limits the tokens of candidates by their Section. Sections
+	// without a cap share the budget freely; forced turns are never capped.
+	SectionCaps map[string]int
+
+	// SectionShares splits the budget between sections (see allocate).
+	// Recent turns and pinned items are then held to their section's
+	// allocation, newest turns and first pinned items first, and candidates
+	// to theirs; budget a section cannot use spills over to the others.
+	// Sections without a share are not limited.
+	SectionShares map[string]float64
+
+	// Pinned items, such as a user profile, are included before candidates
+	// like recent turns. Their section defaults to SectionProfile.
+	Pinned []models.KnapsackItem
+}
+
 // SelectionResult contains the selected items and budget utilization.
 type SelectionResult struct {
 	Selected    []models.KnapsackItem `json:"selected"`
+	Rejected    []models.KnapsackItem `json:"rejected"` // candidates left out, by density
+	Lambda      float64               `json:"lambda"`   // density threshold λ
 	TotalTokens int                   `json:"total_tokens"`
 	TotalValue  float64               `json:"total_value"`
-	Utilization float64               `json:"utilization"` // tokens_used / budget
+	Utilization float64               `json:"utilization"` // tokens_used / (budget - reserved)
+
+	// Solver that packed the candidates, the LP relaxation bound on their
+	// value and the relative gap (bound - value) / bound; 0 is optimal. The
+	// submodular solver trades some of this additive value for diversity.
+	Solver        string  `json:"solver"`
+	UpperBound    float64 `json:"upper_bound"`
+	OptimalityGap float64 `json:"optimality_gap"`
+
+	// Sections reports the tokens used by each section of the selection
+	// and, with section shares, its allocated budget.
+	Sections map[string]models.SectionUsage `json:"sections"`
 }
 
-// Optimize selects the highest-value items that fit within the token budget.
-// forceItems are always included (e.g., last 3 conversation turns).
-// candidates are scored by DIG and ranked by information density.
-func (o *Optimizer) Optimize(candidates []models.KnapsackItem, recentTurns []models.ConversationTurn) SelectionResult {
-	budget := o.tokenBudget
+// Optimize selects the highest-value items that fit within the token budget
+// less opts.ReservedTokens. The last K recentTurns are always included.
+// candidates are scored by DIG and ranked by information density; the
+// caller's slice is left untouched.
+func (o *Optimizer) Optimize(candidates []models.KnapsackItem, recentTurns []models.ConversationTurn, opts Options) SelectionResult {
+	opts = o.withDefaults(opts)
+	budget := opts.TokenBudget - opts.ReservedTokens
+	if budget < 0 {
+		budget = 0
+	}
+	available := budget
 	var selected []models.KnapsackItem
 	totalTokens := 0
 	totalValue := 0.0
 
-	// Phase 1: Force-include recent conversation turns (phonological loop).
-	turnCount := o.forceRecentTurns
-	if turnCount > len(recentTurns) {
-		turnCount = len(recentTurns)
+	// Phase 1: Force-include recent conversation turns (phonological loop)
+	// and pinned items, within their allocations if the budget is split.
+	forcedTurns := o.turnItems(recentTurns, opts.ForceRecentTurns)
+	pinned := make([]models.KnapsackItem, len(opts.Pinned))
+	for i, item := range opts.Pinned {
+		if item.Section == "" {
+			item.Section = models.SectionProfile
+		}
+		item.ForceInclude = true
+		pinned[i] = item
 	}
 
-	for i := len(recentTurns) - turnCount; i < len(recentTurns); i++ {
-		turn := recentTurns[i]
-		tokenCount := len(turn.Content) / 4 // approximate
-		if tokenCount == 0 {
-			tokenCount = 1
+	var alloc map[string]int
+	caps := opts.SectionCaps
+	if len(opts.SectionShares) > 0 {
+		alloc = allocate(budget, opts.SectionShares, sectionDemand(pinned, forcedTurns, candidates))
+		if limit, ok := alloc[models.SectionTurns]; ok {
+			forcedTurns = newestWithin(forcedTurns, limit)
 		}
-
-		item := models.KnapsackItem{
-			ID:           "turn_" + turn.Role + "_" + turn.Timestamp.Format("150405"),
-			Content:      turn.Content,
-			Value:        1000.0, // maximum priority for recent turns
-			Weight:       tokenCount,
-			ForceInclude: true,
-			Density:      1000.0 / float64(tokenCount),
+		if limit, ok := alloc[models.SectionProfile]; ok {
+			pinned = firstWithin(pinned, limit)
 		}
+	}
 
+	for _, item := range append(pinned, forcedTurns...) {
 		selected = append(selected, item)
-		totalTokens += tokenCount
+		totalTokens += item.Weight
 		totalValue += item.Value
 	}
 
 	budget -= totalTokens
 
+	// What the forced sections left unused is split again between the
+	// candidate sections.
+	if alloc != nil {
+		candidateShares := make(map[string]float64, len(opts.SectionShares))
+		for section, share := range opts.SectionShares {
+			if section != models.SectionTurns && section != models.SectionProfile {
+				candidateShares[section] = share
+			}
+		}
+		caps = make(map[string]int, len(candidateShares)+len(opts.SectionCaps))
+		for section, limit := range allocate(budget, candidateShares, sectionDemand(candidates)) {
+			alloc[section] = limit
+			caps[section] = limit
+		}
+		for section, limit := range opts.SectionCaps {
+			if c, ok := caps[section]; !ok || limit < c {
+				caps[section] = limit
+			}
+		}
+	}
+
 	// Phase 2: Compute density for each candidate: v_i / w_i.
+	candidates = append([]models.KnapsackItem(nil), candidates...)
 	for i := range candidates {
 		if candidates[i].Weight > 0 {
 			candidates[i].Density = candidates[i].Value / float64(candidates[i].Weight)
@@ -110,40 +225,136 @@ func (o *Optimizer) Optimize(candidates []models.KnapsackItem, recentTurns []mod
 
 	// Phase 4: Compute optimal λ via binary search on the sorted candidates.
 	// The shadow price λ is the density threshold below which items are excluded.
-	lambda := o.findOptimalLambda(candidates, budget)
+	lambda := findOptimalLambda(candidates, budget)
 
-	// Phase 5: Select items with density ≥ λ that fit within remaining budget.
-	for _, item := range candidates {
-		if budget <= 0 {
-			break
-		}
+	// Phase 5: Pack the remaining budget with the solver for this problem size.
+	solver := o.solverFor(len(candidates), budget)
+	chosen := solver.Solve(candidates, budget)
+	if len(caps) > 0 {
+		chosen = capSections(candidates, chosen, budget, caps)
+	}
 
-		// Lagrangian decision rule: include if v_i / w_i ≥ λ.
-		if item.Density >= lambda && item.Weight <= budget {
+	var rejected []models.KnapsackItem
+	candidateValue := 0.0
+	next := 0
+	for i, item := range candidates {
+		if next < len(chosen) && chosen[next] == i {
+			next++
 			selected = append(selected, item)
 			totalTokens += item.Weight
 			totalValue += item.Value
-			budget -= item.Weight
+			candidateValue += item.Value
+		} else {
+			rejected = append(rejected, item)
 		}
 	}
 
+	bound := lpBound(candidates, budget)
+	gap := 0.0
+	if bound > 0 {
+		gap = math.Max(0, (bound-candidateValue)/bound)
+	}
+
 	utilization := 0.0
-	if o.tokenBudget > 0 {
-		utilization = float64(totalTokens) / float64(o.tokenBudget)
+	if available > 0 {
+		utilization = float64(totalTokens) / float64(available)
 	}
 
 	return SelectionResult{
 		Selected:    selected,
+		Rejected:    rejected,
+		Lambda:      lambda,
 		TotalTokens: totalTokens,
 		TotalValue:  totalValue,
 		Utilization: utilization,
+
+		Solver:        solver.Name(),
+		UpperBound:    bound,
+		OptimalityGap: gap,
+
+		Sections: sectionUsage(selected, alloc),
+	}
+}
+
+// turnItems returns the last count turns as forced knapsack items.
+func (o *Optimizer) turnItems(recentTurns []models.ConversationTurn, count int) []models.KnapsackItem {
+	if count < 0 {
+		count = 0
+	}
+	if count > len(recentTurns) {
+		count = len(recentTurns)
+	}
+
+	items := make([]models.KnapsackItem, 0, count)
+	for _, turn := range recentTurns[len(recentTurns)-count:] {
+		tokenCount := o.tokenizer.Count(turn.Content)
+		if tokenCount == 0 {
+			tokenCount = 1
+		}
+
+		items = append(items, models.KnapsackItem{
+			ID:           "turn_" + turn.Role + "_" + turn.Timestamp.Format("150405"),
+			Content:      turn.Content,
+			Value:        1000.0, // maximum priority for recent turns
+			Weight:       tokenCount,
+			ForceInclude: true,
+			Density:      1000.0 / float64(tokenCount),
+			Section:      models.SectionTurns,
+			Role:         turn.Role,
+			Timestamp:    turn.Timestamp,
+		})
+	}
+	return items
+}
+
+// withDefaults fills the zero fields of opts from the configuration.
+func (o *Optimizer) withDefaults(opts Options) Options {
+	if opts.TokenBudget <= 0 {
+		opts.TokenBudget = o.tokenBudget
+	}
+	if opts.ForceRecentTurns == 0 {
+		opts.ForceRecentTurns = o.forceRecentTurns
+	}
+	if opts.ReservedTokens < 0 {
+		opts.ReservedTokens = 0
+	}
+	return opts
+}
+
+// UsesEmbeddings reports whether the configured solver reads the
+// candidates' embeddings; only the submodular solver does.
+func (o *Optimizer) UsesEmbeddings() bool {
+	return o.solver == SolverSubmodular
+}
+
+// solverFor picks the solver: the configured one, or in auto mode exact DP
+// while n·W is affordable, then branch and bound, then greedy.
+func (o *Optimizer) solverFor(n, budget int) Solver {
+	switch o.solver {
+	case SolverGreedy:
+		return GreedySolver{}
+	case SolverDP:
+		return DPSolver{}
+	case SolverBranchAndBound:
+		return BranchAndBoundSolver{MaxNodes: o.bnbNodes}
+	case SolverSubmodular:
+		return SubmodularSolver{Diversity: o.diversity}
+	}
+
+	switch {
+	case n*budget <= o.dpMaxCells:
+		return DPSolver{}
+	case n <= bnbMaxItems:
+		return BranchAndBoundSolver{MaxNodes: o.bnbNodes}
+	default:
+		return GreedySolver{}
 	}
 }
 
 // findOptimalLambda performs binary search to find the Lagrange multiplier λ
 // such that the total weight of items with density ≥ λ is approximately
 // equal to the budget W.
-func (o *Optimizer) findOptimalLambda(candidates []models.KnapsackItem, budget int) float64 {
+func findOptimalLambda(candidates []models.KnapsackItem, budget int) float64 {
 	if len(candidates) == 0 || budget <= 0 {
 		return 0
 	}
@@ -181,9 +392,48 @@ func (o *Optimizer) findOptimalLambda(candidates []models.KnapsackItem, budget i
 	return lo
 }
 
-// SetTokenBudget allows dynamic budget override (e.g., from API request).
-func (o *Optimizer) SetTokenBudget(budget int) {
-	if budget > 0 {
-		o.tokenBudget = budget
+// capSections enforces per-section token caps on the solver's choice
+// (indices into the density-sorted candidates). It keeps chosen items in
+// density order while their section has room, then refills the freed
+// budget with the densest rejected items that fit.
+func capSections(candidates []models.KnapsackItem, chosen []int, budget int, caps map[string]int) []int {
+	used := make(map[string]int)
+	fits := func(item models.KnapsackItem, remaining int) bool {
+		if item.Weight > remaining {
+			return false
+		}
+		limit, capped := caps[item.Section]
+		return !capped || used[item.Section]+item.Weight <= limit
+	}
+
+	in := make([]bool, len(candidates))
+	remaining := budget
+	dropped := false
+	for _, i := range chosen {
+		if !fits(candidates[i], remaining) {
+			dropped = true
+			continue
+		}
+		in[i] = true
+		used[candidates[i].Section] += candidates[i].Weight
+		remaining -= candidates[i].Weight
+	}
+	if !dropped {
+		return chosen
+	}
+	for i, item := range candidates {
+		if !in[i] && fits(item, remaining) {
+			in[i] = true
+			used[item.Section] += item.Weight
+			remaining -= item.Weight
+		}
+	}
+
+	kept := make([]int, 0, len(chosen))
+	for i, ok := range in {
+		if ok {
+			kept = append(kept, i)
+		}
 	}
+	return kept
 }
@@ -0,0 +1,222 @@
+package knapsack
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/models"
+)
+
+func turns(contents ...string) []models.ConversationTurn {
+	out := make([]models.ConversationTurn, len(contents))
+	for i, c := range contents {
+		out[i] = models.ConversationTurn{Role: "user", Content: c, Timestamp: time.Now()}
+	}
+	return out
+}
+
+func TestOptimizerOptimize(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        configs.KnapsackConfig
+		candidates []models.KnapsackItem
+		recent     []models.ConversationTurn
+		wantIDs    []string
+		wantForced int
+		wantTokens int
+	}{
+		{
+			name: "selects by density within budget",
+			cfg:  configs.KnapsackConfig{TokenBudget: 100, ForceRecentTurns: 3},
+			candidates: []models.KnapsackItem{
+				{ID: "low", Value: 0.1, Weight: 50},
+				{ID: "high", Value: 0.9, Weight: 40},
+				{ID: "mid", Value: 0.5, Weight: 50},
+			},
+			wantIDs:    []string{"high", "mid"},
+			wantTokens: 90,
+		},
+		{
+			name: "force-includes only the last K turns",
+			cfg:  configs.KnapsackConfig{TokenBudget: 100, ForceRecentTurns: 2},
+			candidates: []models.KnapsackItem{
+				{ID: "a", Value: 0.9, Weight: 40},
+			},
+			recent:     turns(strings.Repeat("x", 400), strings.Repeat("y", 40), strings.Repeat("z", 40)),
+			wantIDs:    []string{"a"},
+			wantForced: 2,
+			wantTokens: 60,
+		},
+		{
+			name: "forced turns consume the budget first",
+			cfg:  configs.KnapsackConfig{TokenBudget: 50, ForceRecentTurns: 1},
+			candidates: []models.KnapsackItem{
+				{ID: "a", Value: 0.9, Weight: 40},
+			},
+			recent:     turns(strings.Repeat("y", 160)),
+			wantIDs:    []string{},
+			wantForced: 1,
+			wantTokens: 40,
+		},
+		{
+			name:       "no candidates",
+			cfg:        configs.KnapsackConfig{TokenBudget: 100},
+			wantIDs:    []string{},
+			wantTokens: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOptimizer(tt.cfg, nil)
+			res := o.Optimize(tt.candidates, tt.recent, Options{})
+
+			var gotIDs []string
+			forced := 0
+			for _, item := range res.Selected {
+				if item.ForceInclude {
+					forced++
+				} else {
+					gotIDs = append(gotIDs, item.ID)
+				}
+			}
+
+			if forced != tt.wantForced {
+				t.Errorf("forced turns = %d, want %d", forced, tt.wantForced)
+			}
+			if len(gotIDs) != len(tt.wantIDs) {
+				t.Fatalf("selected %v, want %v", gotIDs, tt.wantIDs)
+			}
+			for i := range gotIDs {
+				if gotIDs[i] != tt.wantIDs[i] {
+					t.Errorf("selected %v, want %v", gotIDs, tt.wantIDs)
+					break
+				}
+			}
+			if res.TotalTokens != tt.wantTokens {
+				t.Errorf("total tokens = %d, want %d", res.TotalTokens, tt.wantTokens)
+			}
+		})
+	}
+}
+
+func TestOptimizerReportsRejected(t *testing.T) {
+	o := NewOptimizer(configs.KnapsackConfig{TokenBudget: 100}, nil)
+	res := o.Optimize([]models.KnapsackItem{
+		{ID: "low", Value: 0.1, Weight: 50},
+		{ID: "high", Value: 0.9, Weight: 40},
+		{ID: "mid", Value: 0.5, Weight: 50},
+	}, nil, Options{})
+
+	var rejected []string
+	for _, item := range res.Rejected {
+		rejected = append(rejected, item.ID)
+	}
+	if strings.Join(rejected, ",") != "low" {
+		t.Errorf("rejected %v, want [low]", rejected)
+	}
+	if res.Rejected[0].Density == 0 {
+		t.Error("rejected item has no density")
+	}
+
+	if res.Lambda <= 0 {
+		t.Errorf("λ = %v, want > 0", res.Lambda)
+	}
+	for _, item := range res.Selected {
+		if item.Density < res.Lambda {
+			t.Errorf("kept %s with density %v below λ %v", item.ID, item.Density, res.Lambda)
+		}
+	}
+}
+
+func TestOptimizerOptions(t *testing.T) {
+	candidates := []models.KnapsackItem{
+		{ID: "ep1", Value: 0.9, Weight: 30, Section: models.SectionEpisodes},
+		{ID: "ep2", Value: 0.8, Weight: 30, Section: models.SectionEpisodes},
+		{ID: "fact", Value: 0.2, Weight: 30, Section: models.SectionFacts},
+	}
+	recent := turns(strings.Repeat("x", 40), strings.Repeat("y", 40))
+
+	tests := []struct {
+		name       string
+		opts       Options
+		wantIDs    []string
+		wantForced int
+	}{
+		{
+			name:       "configured defaults",
+			wantIDs:    []string{"ep1", "ep2", "fact"},
+			wantForced: 1,
+		},
+		{
+			name:       "per-call budget",
+			opts:       Options{TokenBudget: 70},
+			wantIDs:    []string{"ep1", "ep2"},
+			wantForced: 1,
+		},
+		{
+			name:    "reserved tokens and no turns",
+			opts:    Options{TokenBudget: 70, ForceRecentTurns: -1, ReservedTokens: 30},
+			wantIDs: []string{"ep1"},
+		},
+		{
+			name:       "section cap frees budget for other sections",
+			opts:       Options{TokenBudget: 80, ForceRecentTurns: 2, SectionCaps: map[string]int{models.SectionEpisodes: 30}},
+			wantIDs:    []string{"ep1", "fact"},
+			wantForced: 2,
+		},
+	}
+
+	o := NewOptimizer(configs.KnapsackConfig{TokenBudget: 200, ForceRecentTurns: 1}, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := o.Optimize(candidates, recent, tt.opts)
+
+			var gotIDs []string
+			forced := 0
+			for _, item := range res.Selected {
+				if item.ForceInclude {
+					forced++
+				} else {
+					gotIDs = append(gotIDs, item.ID)
+				}
+			}
+			if forced != tt.wantForced {
+				t.Errorf("forced turns = %d, want %d", forced, tt.wantForced)
+			}
+			if strings.Join(gotIDs, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("selected %v, want %v", gotIDs, tt.wantIDs)
+			}
+		})
+	}
+
+	if candidates[0].Density != 0 {
+		t.Error("Optimize modified the caller's candidates")
+	}
+}
+
+func TestOptimizerConcurrentBudgets(t *testing.T) {
+	o := NewOptimizer(configs.KnapsackConfig{TokenBudget: 4096}, nil)
+	candidates := make([]models.KnapsackItem, 40)
+	for i := range candidates {
+		candidates[i] = models.KnapsackItem{ID: fmt.Sprint(i), Value: float64(i%7) + 1, Weight: 10 + i%5}
+	}
+
+	for _, budget := range []int{20, 50, 100, 200, 400} {
+		budget := budget
+		want := o.Optimize(candidates, nil, Options{TokenBudget: budget})
+		t.Run(fmt.Sprint(budget), func(t *testing.T) {
+			t.Parallel()
+			for i := 0; i < 50; i++ {
+				got := o.Optimize(candidates, nil, Options{TokenBudget: budget})
+				if got.TotalTokens > budget || got.TotalValue != want.TotalValue {
+					t.Fatalf("budget %d: got %d tokens, value %v; want ≤ %d tokens, value %v",
+						budget, got.TotalTokens, got.TotalValue, budget, want.TotalValue)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package knapsack
+
+import (
+	"sort"
+
+	"github.com/memora/cma/internal/models"
+)
+
+// Solver names accepted by KnapsackConfig.Solver.
+const (
+	SolverAuto           = "auto"
+	SolverGreedy         = "greedy"
+	SolverDP             = "dp"
+	SolverBranchAndBound = "branch_and_bound"
+	SolverSubmodular     = "submodular"
+)
+
+// bnbMaxItems caps the candidate count the auto mode hands to branch and
+// bound; beyond it even the bounded search costs too much per node.
+const bnbMaxItems = 512
+
+// Solver chooses which candidates to pack into budget tokens. It returns
+// the indices of the chosen candidates in ascending order and must not
+// reorder or modify candidates. Densities are set by the caller.
+type Solver interface {
+	Name() string
+	Solve(candidates []models.KnapsackItem, budget int) []int
+}
+
+// --- Greedy ---
+
+// GreedySolver is the Lagrangian relaxation rule: walk the candidates by
+// density and take those with v_i / w_i ≥ λ that still fit. O(n log n), but
+// a few large, valuable items can be left out.
+type GreedySolver struct{}
+
+func (GreedySolver) Name() string { return SolverGreedy }
+
+func (GreedySolver) Solve(candidates []models.KnapsackItem, budget int) []int {
+	if budget <= 0 {
+		return nil
+	}
+	lambda := findOptimalLambda(candidates, budget)
+
+	var chosen []int
+	for _, i := range byDensity(candidates) {
+		if budget <= 0 {
+			break
+		}
+		if candidates[i].Density >= lambda && candidates[i].Weight <= budget {
+			chosen = append(chosen, i)
+			budget -= candidates[i].Weight
+		}
+	}
+	sort.Ints(chosen)
+	return chosen
+}
+
+// --- Dynamic programming ---
+
+// DPSolver solves the 0/1 knapsack exactly by dynamic programming over the
+// token budget in O(n·W) time and n·W bytes, a bool per item and capacity.
+// Only items with positive value are considered.
+type DPSolver struct{}
+
+func (DPSolver) Name() string { return SolverDP }
+
+func (DPSolver) Solve(candidates []models.KnapsackItem, budget int) []int {
+	if budget <= 0 {
+		return nil
+	}
+
+	items := profitable(candidates, budget)
+	best := make([]float64, budget+1)  // best[c]: max value within c tokens
+	take := make([][]bool, len(items)) // take[k][c]: item k used at capacity c
+	for k, i := range items {
+		w, v := candidates[i].Weight, candidates[i].Value
+		take[k] = make([]bool, budget+1)
+		for c := budget; c >= w; c-- {
+			if best[c-w]+v > best[c] {
+				best[c] = best[c-w] + v
+				take[k][c] = true
+			}
+		}
+	}
+
+	var chosen []int
+	c := budget
+	for k := len(items) - 1; k >= 0; k-- {
+		if take[k][c] {
+			chosen = append(chosen, items[k])
+			c -= candidates[items[k]].Weight
+		}
+	}
+	sort.Ints(chosen)
+	return chosen
+}
+
+// --- Branch and bound ---
+
+// BranchAndBoundSolver searches include/exclude decisions depth-first in
+// density order, pruning any branch whose Lagrangian (LP relaxation) bound
+// cannot beat the incumbent. The greedy packing seeds the incumbent; after
+// MaxNodes nodes the best packing found so far is returned.
+type BranchAndBoundSolver struct {
+	MaxNodes int
+}
+
+func (BranchAndBoundSolver) Name() string { return SolverBranchAndBound }
+
+func (s BranchAndBoundSolver) Solve(candidates []models.KnapsackItem, budget int) []int {
+	if budget <= 0 {
+		return nil
+	}
+
+	order := profitable(candidates, budget)
+	sort.SliceStable(order, func(a, b int) bool {
+		return candidates[order[a]].Density > candidates[order[b]].Density
+	})
+
+	// Incumbent: greedy by density.
+	var best []int
+	bestValue := 0.0
+	free := budget
+	for _, i := range order {
+		if candidates[i].Weight <= free {
+			best = append(best, i)
+			bestValue += candidates[i].Value
+			free -= candidates[i].Weight
+		}
+	}
+
+	nodes := 0
+	path := make([]int, 0, len(order))
+	var search func(k, free int, value float64)
+	search = func(k, free int, value float64) {
+		nodes++
+		if value > bestValue {
+			bestValue = value
+			best = append(best[:0:0], path...)
+		}
+		if k == len(order) || (s.MaxNodes > 0 && nodes >= s.MaxNodes) {
+			return
+		}
+		if value+fractionalFill(candidates, order[k:], free) <= bestValue {
+			return
+		}
+
+		i := order[k]
+		if w := candidates[i].Weight; w <= free {
+			path = append(path, i)
+			search(k+1, free-w, value+candidates[i].Value)
+			path = path[:len(path)-1]
+		}
+		search(k+1, free, value)
+	}
+	search(0, budget, 0)
+
+	sort.Ints(best)
+	return best
+}
+
+// --- Helpers ---
+
+// lpBound is the value of the LP relaxation of the knapsack: items taken by
+// density with the last one split. It bounds every 0/1 packing from above.
+func lpBound(candidates []models.KnapsackItem, budget int) float64 {
+	if budget <= 0 {
+		return 0
+	}
+	order := profitable(candidates, budget)
+	sort.SliceStable(order, func(a, b int) bool {
+		return candidates[order[a]].Density > candidates[order[b]].Density
+	})
+	return fractionalFill(candidates, order, budget)
+}
+
+// fractionalFill fills free tokens from order (sorted by density),
+// splitting the first item that does not fit.
+func fractionalFill(candidates []models.KnapsackItem, order []int, free int) float64 {
+	value := 0.0
+	for _, i := range order {
+		w := candidates[i].Weight
+		if w <= free {
+			value += candidates[i].Value
+			free -= w
+			continue
+		}
+		value += candidates[i].Value * float64(free) / float64(w)
+		break
+	}
+	return value
+}
+
+// profitable returns the indices of candidates with positive value that fit
+// within budget on their own.
+func profitable(candidates []models.KnapsackItem, budget int) []int {
+	out := make([]int, 0, len(candidates))
+	for i, c := range candidates {
+		if c.Value > 0 && c.Weight <= budget {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// byDensity returns candidate indices sorted by density, highest first.
+func byDensity(candidates []models.KnapsackItem) []int {
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return candidates[order[a]].Density > candidates[order[b]].Density
+	})
+	return order
+}
@@ -0,0 +1,145 @@
+package knapsack
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/models"
+)
+
+func withDensity(items []models.KnapsackItem) []models.KnapsackItem {
+	for i := range items {
+		items[i].Density = items[i].Value / float64(items[i].Weight)
+	}
+	return items
+}
+
+func packedValue(candidates []models.KnapsackItem, chosen []int, budget int, t *testing.T) float64 {
+	t.Helper()
+	value, weight := 0.0, 0
+	for _, i := range chosen {
+		value += candidates[i].Value
+		weight += candidates[i].Weight
+	}
+	if weight > budget {
+		t.Fatalf("packing weighs %d, over budget %d", weight, budget)
+	}
+	return value
+}
+
+// bruteForce returns the optimal value by enumerating every subset.
+func bruteForce(candidates []models.KnapsackItem, budget int) float64 {
+	best := 0.0
+	for mask := 0; mask < 1<<len(candidates); mask++ {
+		value, weight := 0.0, 0
+		for i, c := range candidates {
+			if mask&(1<<i) != 0 {
+				value += c.Value
+				weight += c.Weight
+			}
+		}
+		if weight <= budget && value > best {
+			best = value
+		}
+	}
+	return best
+}
+
+func TestExactSolversBeatGreedy(t *testing.T) {
+	// Greedy takes the dense small item and then only fits one large one;
+	// the optimum is the two medium items that fill the budget exactly.
+	candidates := withDensity([]models.KnapsackItem{
+		{ID: "small", Value: 0.2, Weight: 10},
+		{ID: "large", Value: 0.6, Weight: 60},
+		{ID: "b", Value: 0.5, Weight: 50},
+		{ID: "c", Value: 0.5, Weight: 50},
+	})
+
+	tests := []struct {
+		solver Solver
+		want   float64
+	}{
+		{GreedySolver{}, 0.8},
+		{DPSolver{}, 1.0},
+		{BranchAndBoundSolver{}, 1.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.solver.Name(), func(t *testing.T) {
+			got := packedValue(candidates, tt.solver.Solve(candidates, 100), 100, t)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("value = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExactSolversMatchBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for round := 0; round < 200; round++ {
+		candidates := make([]models.KnapsackItem, 1+rng.Intn(12))
+		for i := range candidates {
+			candidates[i] = models.KnapsackItem{Value: rng.Float64(), Weight: 1 + rng.Intn(40)}
+		}
+		withDensity(candidates)
+		budget := rng.Intn(120)
+
+		want := bruteForce(candidates, budget)
+		for _, s := range []Solver{DPSolver{}, BranchAndBoundSolver{}} {
+			got := packedValue(candidates, s.Solve(candidates, budget), budget, t)
+			if math.Abs(got-want) > 1e-9 {
+				t.Fatalf("round %d: %s value = %v, want %v", round, s.Name(), got, want)
+			}
+		}
+		if bound := lpBound(candidates, budget); bound < want-1e-9 {
+			t.Fatalf("round %d: LP bound %v below optimum %v", round, bound, want)
+		}
+	}
+}
+
+func TestOptimizerSolverSelection(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    configs.KnapsackConfig
+		n      int
+		budget int
+		want   string
+	}{
+		{"small problem uses DP", configs.KnapsackConfig{}, 50, 4096, SolverDP},
+		{"large budget uses branch and bound", configs.KnapsackConfig{DPMaxCells: 1000}, 50, 4096, SolverBranchAndBound},
+		{"many candidates use greedy", configs.KnapsackConfig{DPMaxCells: 1000}, 5000, 4096, SolverGreedy},
+		{"fixed solver", configs.KnapsackConfig{Solver: SolverGreedy}, 10, 100, SolverGreedy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewOptimizer(tt.cfg, nil).solverFor(tt.n, tt.budget).Name(); got != tt.want {
+				t.Errorf("solver = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptimizerReportsGap(t *testing.T) {
+	items := func() []models.KnapsackItem {
+		return []models.KnapsackItem{
+			{ID: "small", Value: 0.2, Weight: 10},
+			{ID: "large", Value: 0.6, Weight: 60},
+			{ID: "b", Value: 0.5, Weight: 50},
+			{ID: "c", Value: 0.5, Weight: 50},
+		}
+	}
+
+	greedy := NewOptimizer(configs.KnapsackConfig{TokenBudget: 100, Solver: SolverGreedy}, nil).Optimize(items(), nil, Options{})
+	exact := NewOptimizer(configs.KnapsackConfig{TokenBudget: 100}, nil).Optimize(items(), nil, Options{})
+
+	if exact.Solver != SolverDP || exact.TotalValue != 1.0 {
+		t.Errorf("auto: solver %s value %v, want dp with 1.0", exact.Solver, exact.TotalValue)
+	}
+	if exact.UpperBound < exact.TotalValue || greedy.UpperBound != exact.UpperBound {
+		t.Errorf("upper bounds %v / %v inconsistent with value %v", greedy.UpperBound, exact.UpperBound, exact.TotalValue)
+	}
+	if greedy.OptimalityGap <= exact.OptimalityGap {
+		t.Errorf("greedy gap %v not above exact gap %v", greedy.OptimalityGap, exact.OptimalityGap)
+	}
+}
@@ -0,0 +1,111 @@
+package knapsack
+
+import (
+	"math"
+	"sort"
+
+	"github.com/memora/cma/internal/models"
+	"github.com/memora/cma/pkg"
+)
+
+// SubmodularSolver packs for coverage as well as relevance, so that several
+// episodes saying nearly the same thing do not crowd out distinct facts.
+// It maximizes the monotone submodular objective
+//
+//	f(S) = (1-α)·Σ_{i∈S} v_i + α·Σ_{j∈C} v_j · max_{i∈S} sim(i, j)
+//
+// over the candidate pool C, where sim is the cosine similarity of the
+// embeddings clamped at 0 (1 for an item with itself, 0 without an
+// embedding) and α is Diversity. The facility-location term stops paying
+// for an item once the selection already covers what it says.
+//
+// Selection is the cost-benefit greedy on marginal gain per token, compared
+// against the best single item; together they are within (1-1/e)/2 of the
+// optimum under the budget.
+type SubmodularSolver struct {
+	Diversity float64
+}
+
+func (SubmodularSolver) Name() string { return SolverSubmodular }
+
+func (s SubmodularSolver) Solve(candidates []models.KnapsackItem, budget int) []int {
+	if budget <= 0 {
+		return nil
+	}
+	items := profitable(candidates, budget)
+	if len(items) == 0 {
+		return nil
+	}
+	alpha := math.Min(math.Max(s.Diversity, 0), 1)
+
+	sim := make([][]float64, len(items))
+	for a := range items {
+		sim[a] = make([]float64, len(items))
+		for b := range items {
+			switch {
+			case a == b:
+				sim[a][b] = 1
+			case b < a:
+				sim[a][b] = sim[b][a]
+			default:
+				cos := pkg.CosineSimilarity(candidates[items[a]].Embedding, candidates[items[b]].Embedding)
+				sim[a][b] = math.Max(cos, 0)
+			}
+		}
+	}
+
+	// gain is f(S ∪ {a}) - f(S), where cover[b] = max_{i∈S} sim(i, b).
+	gain := func(a int, cover []float64) float64 {
+		g := (1 - alpha) * candidates[items[a]].Value
+		for b := range items {
+			if d := sim[a][b] - cover[b]; d > 0 {
+				g += alpha * candidates[items[b]].Value * d
+			}
+		}
+		return g
+	}
+
+	cover := make([]float64, len(items))
+	taken := make([]bool, len(items))
+	var chosen []int
+	value := 0.0
+	free := budget
+	for {
+		best, bestRatio, bestGain := -1, 0.0, 0.0
+		for a, i := range items {
+			if taken[a] || candidates[i].Weight > free {
+				continue
+			}
+			g := gain(a, cover)
+			if g <= 0 {
+				continue
+			}
+			if ratio := g / math.Max(float64(candidates[i].Weight), 1); best < 0 || ratio > bestRatio {
+				best, bestRatio, bestGain = a, ratio, g
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		taken[best] = true
+		chosen = append(chosen, items[best])
+		value += bestGain
+		free -= candidates[items[best]].Weight
+		for b := range items {
+			cover[b] = math.Max(cover[b], sim[best][b])
+		}
+	}
+
+	// A single large item can beat everything the per-token greedy packs.
+	empty := make([]float64, len(items))
+	for a, i := range items {
+		if g := gain(a, empty); g > value {
+			value = g
+			chosen = []int{i}
+		}
+	}
+
+	sort.Ints(chosen)
+	return chosen
+}
@@ -0,0 +1,60 @@
+package knapsack
+
+import (
+	"testing"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/models"
+)
+
+func TestSubmodularSkipsNearDuplicates(t *testing.T) {
+	job := []float32{1, 0.05, 0}
+	candidates := func() []models.KnapsackItem {
+		return []models.KnapsackItem{
+			{ID: "job-1", Value: 0.9, Weight: 40, Embedding: job},
+			{ID: "job-2", Value: 0.88, Weight: 40, Embedding: []float32{1, 0, 0}},
+			{ID: "job-3", Value: 0.85, Weight: 40, Embedding: []float32{1, 0, 0.05}},
+			{ID: "home", Value: 0.5, Weight: 40, Embedding: []float32{0, 1, 0}},
+		}
+	}
+
+	zero, low := 0.0, 0.01
+	tests := []struct {
+		name string
+		cfg  configs.KnapsackConfig
+		want string
+	}{
+		{"additive value packs duplicates", configs.KnapsackConfig{TokenBudget: 80, Solver: SolverDP}, "job-1,job-2"},
+		{"diversity covers distinct facts", configs.KnapsackConfig{TokenBudget: 80, Solver: SolverSubmodular}, "job-1,home"},
+		{"low diversity favours relevance", configs.KnapsackConfig{TokenBudget: 80, Solver: SolverSubmodular, Diversity: &low}, "job-1,job-2"},
+		{"zero diversity is pure relevance", configs.KnapsackConfig{TokenBudget: 80, Solver: SolverSubmodular, Diversity: &zero}, "job-1,job-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := NewOptimizer(tt.cfg, nil).Optimize(candidates(), nil, Options{})
+			var got string
+			for _, item := range res.Selected {
+				if got != "" {
+					got += ","
+				}
+				got += item.ID
+			}
+			if got != tt.want {
+				t.Errorf("selected %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubmodularWithoutEmbeddings(t *testing.T) {
+	// Items without embeddings are all distinct: plain relevance per token.
+	candidates := withDensity([]models.KnapsackItem{
+		{ID: "a", Value: 0.9, Weight: 40},
+		{ID: "b", Value: 0.5, Weight: 50},
+		{ID: "c", Value: 0.1, Weight: 50},
+	})
+	got := SubmodularSolver{Diversity: 0.5}.Solve(candidates, 100)
+	if len(got) != 2 || got[0] != 0 || got[1] != 1 {
+		t.Errorf("chosen %v, want [0 1]", got)
+	}
+}
@@ -0,0 +1,508 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/models"
+	"github.com/memora/cma/internal/tokenizer"
+)
+
+const (
+	anthropicDefaultBaseURL = "https://api.anthropic.com"
+	anthropicAPIVersion     = "2023-06-01"
+	anthropicTimeout        = 60 * time.Second
+)
+
+// AnthropicProvider implements Provider using the Anthropic Messages API.
+//
+// The Messages API has no embeddings endpoint and no token logprobs, so:
+//   - Embed and EmbedBatch are delegated to a separate Embedder
+//   - GetTokenProbabilities uses the synthetic surprisal heuristic
+//   - ScoreDIG asks the model to estimate P(y|x) and P(y|x,d) directly
+type AnthropicProvider struct {
+	httpClient   *http.Client
+	streamClient *http.Client // no total timeout; streams end with ctx
+	baseURL      string
+	apiKey       string
+	model        string
+	maxTokens    int
+	temperature  float64
+	embedder     Embedder
+	tokenizer    tokenizer.Tokenizer
+}
+
+// NewAnthropicProvider creates a new Anthropic-backed LLM provider.
+// embedder serves all embedding requests.
+func NewAnthropicProvider(cfg configs.LLMConfig, embedder Embedder) *AnthropicProvider {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = anthropicDefaultBaseURL
+	}
+	model := cfg.Model
+	if model == "" {
+		model = "claude-sonnet-4-5"
+	}
+	maxTokens := cfg.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = 1024
+	}
+
+	return &AnthropicProvider{
+		httpClient:   &http.Client{Timeout: anthropicTimeout},
+		streamClient: newStreamClient(),
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		apiKey:       cfg.APIKey,
+		model:        model,
+		maxTokens:    maxTokens,
+		temperature:  cfg.Temperature,
+		embedder:     embedder,
+		tokenizer:    modelTokenizer(cfg, model),
+	}
+}
+
+// --- Messages API wire types ---
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type anthropicRequest struct {
+	Model       string               `json:"model"`
+	MaxTokens   int                  `json:"max_tokens"`
+	System      string               `json:"system,omitempty"`
+	Messages    []anthropicMessage   `json:"messages"`
+	Temperature *float64             `json:"temperature,omitempty"`
+	Tools       []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Stream      bool                 `json:"stream,omitempty"`
+}
+
+type anthropicContentBlock struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+type anthropicResponse struct {
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+}
+
+// anthropicStreamEvent is the data of one server-sent event of a streamed
+// response; only text deltas and errors are read.
+type anthropicStreamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type anthropicError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Embed delegates to the configured embedding backend.
+func (a *AnthropicProvider) Embed(ctx context.Context, text string) ([]float32, error) {
+	if a.embedder == nil {
+		return nil, fmt.Errorf("anthropic embed: no embedding backend configured")
+	}
+	return a.embedder.Embed(ctx, text)
+}
+
+// EmbedBatch delegates to the configured embedding backend.
+func (a *AnthropicProvider) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	if a.embedder == nil {
+		return nil, fmt.Errorf("anthropic embed batch: no embedding backend configured")
+	}
+	return a.embedder.EmbedBatch(ctx, texts)
+}
+
+// GetTokenProbabilities returns heuristic token probabilities; the Messages
+// API does not expose logprobs.
+func (a *AnthropicProvider) GetTokenProbabilities(ctx context.Context, text string) ([]TokenProb, error) {
+	return syntheticTokenProbs(text), nil
+}
+
+// ExtractTriples extracts atomic (Subject, Predicate, Object) triples using a
+// forced tool call, so the output is schema-checked structured JSON.
+func (a *AnthropicProvider) ExtractTriples(ctx context.Context, content string) ([]models.Triple, error) {
+	tool := anthropicTool{
+		Name:        "record_triples",
+		Description: "Record the atomic factual triples stated in the text.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"triples": map[string]any{
+					"type": "array",
+					"items": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"subject":    map[string]any{"type": "string", "description": "the entity performing or being described"},
+							"predicate":  map[string]any{"type": "string", "description": "the relationship or action"},
+							"object":     map[string]any{"type": "string", "description": "the target entity or value"},
+							"confidence": map[string]any{"type": "number", "minimum": 0, "maximum": 1},
+						},
+						"required": []string{"subject", "predicate", "object", "confidence"},
+					},
+				},
+			},
+			"required": []string{"triples"},
+		},
+	}
+
+	prompt := fmt.Sprintf(`Extract all factual relationships from the following text as atomic triples.
+Only extract clearly stated facts. Do not infer or hallucinate relationships.
+
+Text:
+%s`, content)
+
+	zero := 0.0
+	resp, err := a.messages(ctx, anthropicRequest{
+		Model:       a.model,
+		MaxTokens:   a.maxTokens,
+		System:      extractTriplesSystemPrompt,
+		Messages:    []anthropicMessage{{Role: "user", Content: prompt}},
+		Temperature: &zero, // deterministic extraction
+		Tools:       []anthropicTool{tool},
+		ToolChoice:  &anthropicToolChoice{Type: "tool", Name: tool.Name},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("anthropic extract triples: %w", err)
+	}
+
+	input, ok := resp.toolInput(tool.Name)
+	if !ok {
+		return nil, fmt.Errorf("anthropic extract triples: no tool call in response")
+	}
+
+	var out struct {
+		Triples []models.Triple `json:"triples"`
+	}
+	if err := json.Unmarshal(input, &out); err != nil {
+		return nil, fmt.Errorf("anthropic extract triples parse: %w (raw: %s)", err, input)
+	}
+
+	return out.Triples, nil
+}
+
+// Synthesize generates a gist proposition from a cluster of episodes.
+func (a *AnthropicProvider) Synthesize(ctx context.Context, episodes []models.Episode) (string, error) {
+	temp := 0.1
+	resp, err := a.messages(ctx, anthropicRequest{
+		Model:       a.model,
+		MaxTokens:   256,
+		System:      synthesizeSystemPrompt,
+		Messages:    []anthropicMessage{{Role: "user", Content: synthesizePrompt(episodes)}},
+		Temperature: &temp,
+	})
+	if err != nil {
+		return "", fmt.Errorf("anthropic synthesize: %w", err)
+	}
+
+	text := resp.text()
+	if text == "" {
+		return "", fmt.Errorf("anthropic synthesize: no response")
+	}
+
+	return strings.TrimSpace(text), nil
+}
+
+// ScoreDIG approximates the Document Information Gain without logprobs:
+//
+//	DIG(d|x) ≈ log p̂(y|x,d) - log p̂(y|x)
+//
+// where p̂ are the model's own estimates, returned via a forced tool call, of
+// the probability that it can answer the query correctly with and without
+// the document.
+func (a *AnthropicProvider) ScoreDIG(ctx context.Context, query string, document string) (float64, error) {
+	tool := anthropicTool{
+		Name:        "score_information_gain",
+		Description: "Report how likely a correct answer to the question is, with and without the document.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"p_without_document": map[string]any{"type": "number", "minimum": 0, "maximum": 1},
+				"p_with_document":    map[string]any{"type": "number", "minimum": 0, "maximum": 1},
+			},
+			"required": []string{"p_without_document", "p_with_document"},
+		},
+	}
+
+	prompt := fmt.Sprintf(`Estimate the probability that you would answer the question correctly
+(1) using only your own knowledge, and (2) when also given the document.
+A misleading or irrelevant document should not raise the second probability.
+
+Document:
+%s
+
+Question: %s`, document, query)
+
+	zero := 0.0
+	resp, err := a.messages(ctx, anthropicRequest{
+		Model:       a.model,
+		MaxTokens:   128,
+		Messages:    []anthropicMessage{{Role: "user", Content: prompt}},
+		Temperature: &zero,
+		Tools:       []anthropicTool{tool},
+		ToolChoice:  &anthropicToolChoice{Type: "tool", Name: tool.Name},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("dig: %w", err)
+	}
+
+	input, ok := resp.toolInput(tool.Name)
+	if !ok {
+		return 0, fmt.Errorf("dig: no tool call in response")
+	}
+
+	var est struct {
+		Without float64 `json:"p_without_document"`
+		With    float64 `json:"p_with_document"`
+	}
+	if err := json.Unmarshal(input, &est); err != nil {
+		return 0, fmt.Errorf("dig parse: %w", err)
+	}
+
+	// Clamp away from 0 and 1 so the log-ratio stays finite.
+	clamp := func(p float64) float64 { return math.Min(math.Max(p, 0.01), 0.99) }
+
+	return math.Log(clamp(est.With)) - math.Log(clamp(est.Without)), nil
+}
+
+// Generate produces a completion for general-purpose use.
+func (a *AnthropicProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	temp := a.temperature
+	resp, err := a.messages(ctx, anthropicRequest{
+		Model:       a.model,
+		MaxTokens:   a.maxTokens,
+		Messages:    []anthropicMessage{{Role: "user", Content: prompt}},
+		Temperature: &temp,
+	})
+	if err != nil {
+		return "", fmt.Errorf("anthropic generate: %w", err)
+	}
+
+	text := resp.text()
+	if text == "" {
+		return "", fmt.Errorf("anthropic generate: no response")
+	}
+
+	return text, nil
+}
+
+// Chat answers a conversation, streaming the reply to onDelta if set.
+func (a *AnthropicProvider) Chat(ctx context.Context, messages []models.ChatMessage, onDelta func(delta string) error) (string, error) {
+	system, msgs := chatMessages(messages)
+	temp := a.temperature
+	req := anthropicRequest{
+		Model:       a.model,
+		MaxTokens:   a.maxTokens,
+		System:      system,
+		Messages:    msgs,
+		Temperature: &temp,
+	}
+
+	if onDelta != nil {
+		text, err := a.stream(ctx, req, onDelta)
+		if err != nil {
+			return text, fmt.Errorf("anthropic chat: %w", err)
+		}
+		return text, nil
+	}
+
+	resp, err := a.messages(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("anthropic chat: %w", err)
+	}
+	return resp.text(), nil
+}
+
+// CountTokens counts tokens with the tokenizer configured for the model
+// (cl100k_base unless overridden, an approximation for Claude models).
+func (a *AnthropicProvider) CountTokens(text string) int {
+	return a.tokenizer.Count(text)
+}
+
+// Tokenizer returns the tokenizer of the configured model.
+func (a *AnthropicProvider) Tokenizer() tokenizer.Tokenizer {
+	return a.tokenizer
+}
+
+// --- Helpers ---
+
+// messages performs a single POST /v1/messages call.
+func (a *AnthropicProvider) messages(ctx context.Context, req anthropicRequest) (*anthropicResponse, error) {
+	httpResp, err := a.post(ctx, a.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	var resp anthropicResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// stream performs a streaming POST /v1/messages call, passing each text
+// delta of the server-sent events to onDelta, and returns the full text.
+func (a *AnthropicProvider) stream(ctx context.Context, req anthropicRequest, onDelta func(delta string) error) (string, error) {
+	req.Stream = true
+	httpResp, err := a.post(ctx, a.streamClient, req)
+	if err != nil {
+		return "", err
+	}
+	defer httpResp.Body.Close()
+
+	var text strings.Builder
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return text.String(), fmt.Errorf("decode event: %w", err)
+		}
+		switch event.Type {
+		case "content_block_delta":
+			if event.Delta.Type != "text_delta" {
+				continue
+			}
+			text.WriteString(event.Delta.Text)
+			if err := onDelta(event.Delta.Text); err != nil {
+				return text.String(), err
+			}
+		case "error":
+			return text.String(), fmt.Errorf("stream: %s: %s", event.Error.Type, event.Error.Message)
+		case "message_stop":
+			return text.String(), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return text.String(), err
+	}
+	return text.String(), fmt.Errorf("stream ended before message_stop")
+}
+
+// post sends req to /v1/messages with client and returns the response if
+// its status is 200; the caller closes the body.
+func (a *AnthropicProvider) post(ctx context.Context, client *http.Client, req anthropicRequest) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("content-type", "application/json")
+	httpReq.Header.Set("x-api-key", a.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicAPIVersion)
+
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode == http.StatusOK {
+		return httpResp, nil
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var apiErr anthropicError
+	if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+		return nil, fmt.Errorf("status %d: %s: %s", httpResp.StatusCode, apiErr.Error.Type, apiErr.Error.Message)
+	}
+	return nil, fmt.Errorf("status %d: %s", httpResp.StatusCode, strings.TrimSpace(string(data)))
+}
+
+// newStreamClient returns a client for streamed responses: it bounds the
+// wait for the response headers, but not reading the body, which stays open
+// for as long as the model generates.
+func newStreamClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = anthropicTimeout
+	return &http.Client{Transport: transport}
+}
+
+// chatMessages converts messages to the Messages API form: system messages
+// join the system prompt and consecutive messages of one role are merged,
+// since the API expects user and assistant turns to alternate.
+func chatMessages(messages []models.ChatMessage) (string, []anthropicMessage) {
+	var system []string
+	var out []anthropicMessage
+	for _, m := range messages {
+		if m.Role == "system" {
+			system = append(system, m.Content)
+			continue
+		}
+		if n := len(out); n > 0 && out[n-1].Role == m.Role {
+			out[n-1].Content += "\n\n" + m.Content
+			continue
+		}
+		out = append(out, anthropicMessage{Role: m.Role, Content: m.Content})
+	}
+	return strings.Join(system, "\n\n"), out
+}
+
+// text concatenates all text blocks of the response.
+func (r *anthropicResponse) text() string {
+	var sb strings.Builder
+	for _, block := range r.Content {
+		if block.Type == "text" {
+			sb.WriteString(block.Text)
+		}
+	}
+	return sb.String()
+}
+
+// toolInput returns the input of the first tool_use block for the named tool.
+func (r *anthropicResponse) toolInput(name string) (json.RawMessage, bool) {
+	for _, block := range r.Content {
+		if block.Type == "tool_use" && block.Name == name {
+			return block.Input, true
+		}
+	}
+	return nil, false
+}
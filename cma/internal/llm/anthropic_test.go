@@ -0,0 +1,242 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/models"
+)
+
+// anthropicStandIn serves /v1/messages, replying with handler's content blocks.
+func anthropicStandIn(t *testing.T, handler func(req anthropicRequest) (int, any)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("x-api-key"); got != "test-key" {
+			t.Errorf("x-api-key = %q", got)
+		}
+		if got := r.Header.Get("anthropic-version"); got != anthropicAPIVersion {
+			t.Errorf("anthropic-version = %q", got)
+		}
+
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+			return
+		}
+
+		status, body := handler(req)
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func toolUse(name string, input any) map[string]any {
+	return map[string]any{"content": []map[string]any{{"type": "tool_use", "name": name, "input": input}}}
+}
+
+func TestAnthropicProvider(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		handler func(req anthropicRequest) (int, any)
+		call    func(p *AnthropicProvider) (any, error)
+		want    any
+		wantErr string
+	}{
+		{
+			name: "generate returns text blocks",
+			handler: func(req anthropicRequest) (int, any) {
+				return 200, map[string]any{"content": []map[string]any{
+					{"type": "text", "text": "Hello, "},
+					{"type": "text", "text": "world"},
+				}}
+			},
+			call: func(p *AnthropicProvider) (any, error) { return p.Generate(ctx, "hi") },
+			want: "Hello, world",
+		},
+		{
+			name: "extract triples forces the tool",
+			handler: func(req anthropicRequest) (int, any) {
+				if req.ToolChoice == nil || req.ToolChoice.Name != "record_triples" {
+					t.Errorf("tool_choice = %+v", req.ToolChoice)
+				}
+				return 200, toolUse("record_triples", map[string]any{"triples": []map[string]any{
+					{"subject": "Alice", "predicate": "works_at", "object": "Google", "confidence": 0.9},
+				}})
+			},
+			call: func(p *AnthropicProvider) (any, error) {
+				triples, err := p.ExtractTriples(ctx, "Alice works at Google.")
+				if err != nil {
+					return nil, err
+				}
+				return triples[0].Subject + " " + triples[0].Predicate + " " + triples[0].Object, nil
+			},
+			want: "Alice works_at Google",
+		},
+		{
+			name: "dig is the log ratio of estimated probabilities",
+			handler: func(req anthropicRequest) (int, any) {
+				return 200, toolUse("score_information_gain", map[string]any{
+					"p_without_document": 0.2,
+					"p_with_document":    0.8,
+				})
+			},
+			call: func(p *AnthropicProvider) (any, error) { return p.ScoreDIG(ctx, "q", "d") },
+			want: math.Log(0.8) - math.Log(0.2),
+		},
+		{
+			name: "dig clamps certainty to keep the score finite",
+			handler: func(req anthropicRequest) (int, any) {
+				return 200, toolUse("score_information_gain", map[string]any{
+					"p_without_document": 0,
+					"p_with_document":    1,
+				})
+			},
+			call: func(p *AnthropicProvider) (any, error) { return p.ScoreDIG(ctx, "q", "d") },
+			want: math.Log(0.99) - math.Log(0.01),
+		},
+		{
+			name: "api errors are surfaced",
+			handler: func(req anthropicRequest) (int, any) {
+				return 429, map[string]any{"type": "error", "error": map[string]any{
+					"type": "rate_limit_error", "message": "slow down",
+				}}
+			},
+			call:    func(p *AnthropicProvider) (any, error) { return p.Synthesize(ctx, nil) },
+			wantErr: "rate_limit_error: slow down",
+		},
+		{
+			name: "missing tool call is an error",
+			handler: func(req anthropicRequest) (int, any) {
+				return 200, map[string]any{"content": []map[string]any{{"type": "text", "text": "no"}}}
+			},
+			call:    func(p *AnthropicProvider) (any, error) { return p.ExtractTriples(ctx, "x") },
+			wantErr: "no tool call",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := anthropicStandIn(t, tt.handler)
+			p := NewAnthropicProvider(configs.LLMConfig{APIKey: "test-key", BaseURL: srv.URL}, NewFakeProvider(8))
+
+			got, err := tt.call(p)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if f, ok := got.(float64); ok {
+				if math.Abs(f-tt.want.(float64)) > 1e-9 {
+					t.Errorf("got %v, want %v", f, tt.want)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnthropicProviderDelegatesEmbeddings(t *testing.T) {
+	p := NewAnthropicProvider(configs.LLMConfig{}, NewFakeProvider(8))
+	vec, err := p.Embed(context.Background(), "hello")
+	if err != nil || len(vec) != 8 {
+		t.Fatalf("Embed = %d dims, %v; want 8 dims from the embedder", len(vec), err)
+	}
+
+	if _, err := NewAnthropicProvider(configs.LLMConfig{}, nil).Embed(context.Background(), "x"); err == nil {
+		t.Error("Embed without an embedder should fail")
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	for provider, wantErr := range map[string]bool{"": false, "openai": false, "anthropic": false, "bogus": true} {
+		_, err := NewProvider(configs.LLMConfig{Provider: provider})
+		if (err != nil) != wantErr {
+			t.Errorf("NewProvider(%q) error = %v, wantErr %v", provider, err, wantErr)
+		}
+	}
+}
+
+func TestAnthropicProviderChatStream(t *testing.T) {
+	var got anthropicRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("content-type", "text/event-stream")
+		for _, event := range []string{
+			`{"type":"message_start"}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"At "}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Google."}}`,
+			`{"type":"message_stop"}`,
+		} {
+			fmt.Fprintf(w, "event: x\ndata: %s\n\n", event)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewAnthropicProvider(configs.LLMConfig{BaseURL: srv.URL}, nil)
+	var deltas []string
+	reply, err := p.Chat(context.Background(), []models.ChatMessage{
+		{Role: "system", Content: "Be brief."},
+		{Role: "system", Content: "Memories: Alice works at Google."},
+		{Role: "user", Content: "Hi"},
+		{Role: "user", Content: "Where does Alice work?"},
+	}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if reply != "At Google." || len(deltas) != 2 {
+		t.Errorf("reply %q from deltas %q", reply, deltas)
+	}
+	if !got.Stream || got.System != "Be brief.\n\nMemories: Alice works at Google." {
+		t.Errorf("request stream=%v system=%q", got.Stream, got.System)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Content != "Hi\n\nWhere does Alice work?" {
+		t.Errorf("consecutive user messages not merged: %+v", got.Messages)
+	}
+}
+
+func TestAnthropicProviderChatStreamOutlivesRequestTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "text/event-stream")
+		fmt.Fprintf(w, "data: %s\n\n", `{"type":"content_block_delta","delta":{"type":"text_delta","text":"At "}}`)
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprintf(w, "data: %s\n\n", `{"type":"content_block_delta","delta":{"type":"text_delta","text":"Google."}}`)
+		fmt.Fprintf(w, "data: %s\n\n", `{"type":"message_stop"}`)
+	}))
+	defer srv.Close()
+
+	// The total timeout of non-streamed calls must not cut a stream short.
+	p := NewAnthropicProvider(configs.LLMConfig{BaseURL: srv.URL}, nil)
+	p.httpClient.Timeout = 20 * time.Millisecond
+	reply, err := p.Chat(context.Background(), []models.ChatMessage{{Role: "user", Content: "Where does Alice work?"}},
+		func(string) error { return nil })
+	if err != nil || reply != "At Google." {
+		t.Errorf("Chat = %q, %v; want the full stream", reply, err)
+	}
+}
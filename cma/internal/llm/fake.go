@@ -0,0 +1,245 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/memora/cma/internal/models"
+	"github.com/memora/cma/internal/tokenizer"
+)
+
+// FakeProvider is a deterministic, network-free Provider for tests and demos.
+//
+//   - Embed: hashed bag-of-words vectors, so texts sharing words are close in cosine space
+//   - GetTokenProbabilities: scripted per input text, otherwise whitespace tokens at LogProb -1
+//   - ExtractTriples: one (first word, second word, rest) triple per sentence
+//   - Synthesize: the distinct sentences of the cluster, in order
+//   - ScoreDIG: fraction of the query's content words that occur in the document
+//   - Generate: scripted per prompt, otherwise a fixed placeholder
+//   - Chat: Generate of the last message, streamed word by word
+type FakeProvider struct {
+	// Dim is the embedding dimensionality.
+	Dim int
+
+	// TokenProbs maps an exact input text to the token probabilities returned for it.
+	TokenProbs map[string][]TokenProb
+
+	// Generations maps an exact prompt to the completion returned for it.
+	Generations map[string]string
+
+	// TokenProbErr, when set, is returned by GetTokenProbabilities.
+	TokenProbErr error
+
+	// DIGErr, when set, is returned by ScoreDIG.
+	DIGErr error
+}
+
+// NewFakeProvider creates a FakeProvider producing dim-dimensional embeddings.
+func NewFakeProvider(dim int) *FakeProvider {
+	if dim <= 0 {
+		dim = 64
+	}
+	return &FakeProvider{
+		Dim:         dim,
+		TokenProbs:  make(map[string][]TokenProb),
+		Generations: make(map[string]string),
+	}
+}
+
+// Embed returns an L2-normalized hashed bag-of-words vector.
+func (f *FakeProvider) Embed(ctx context.Context, text string) ([]float32, error) {
+	vec := make([]float32, f.Dim)
+	for _, w := range fakeWords(text) {
+		h := fnv.New32a()
+		h.Write([]byte(w))
+		sum := h.Sum32()
+
+		sign := float32(1)
+		if sum&(1<<31) != 0 {
+			sign = -1
+		}
+		vec[int(sum%uint32(f.Dim))] += sign
+	}
+
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range vec {
+			vec[i] *= scale
+		}
+	}
+
+	return vec, nil
+}
+
+// EmbedBatch embeds each text independently.
+func (f *FakeProvider) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		vec, err := f.Embed(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = vec
+	}
+	return out, nil
+}
+
+// GetTokenProbabilities returns the scripted probabilities for text, or one
+// token per whitespace-separated word with a flat LogProb of -1.
+func (f *FakeProvider) GetTokenProbabilities(ctx context.Context, text string) ([]TokenProb, error) {
+	if f.TokenProbErr != nil {
+		return nil, f.TokenProbErr
+	}
+	if probs, ok := f.TokenProbs[text]; ok {
+		return probs, nil
+	}
+
+	probs := whitespaceTokens(text)
+	for i := range probs {
+		probs[i].LogProb = -1
+	}
+
+	return probs, nil
+}
+
+// ExtractTriples emits one triple per sentence with at least three words:
+// the first word is the subject, the second the predicate, the rest the object.
+func (f *FakeProvider) ExtractTriples(ctx context.Context, content string) ([]models.Triple, error) {
+	var triples []models.Triple
+	for _, sentence := range fakeSentences(content) {
+		words := strings.Fields(sentence)
+		if len(words) < 3 {
+			continue
+		}
+		triples = append(triples, models.Triple{
+			Subject:    words[0],
+			Predicate:  words[1],
+			Object:     strings.Join(words[2:], " "),
+			Confidence: 0.9,
+		})
+	}
+	return triples, nil
+}
+
+// Synthesize joins the distinct sentences of the episodes in order.
+func (f *FakeProvider) Synthesize(ctx context.Context, episodes []models.Episode) (string, error) {
+	seen := make(map[string]bool)
+	var gist []string
+	for _, ep := range episodes {
+		for _, sentence := range fakeSentences(ep.Content) {
+			if !seen[sentence] {
+				seen[sentence] = true
+				gist = append(gist, sentence+".")
+			}
+		}
+	}
+	return strings.Join(gist, " "), nil
+}
+
+// ScoreDIG returns the fraction of the query's content words found in the document.
+func (f *FakeProvider) ScoreDIG(ctx context.Context, query string, document string) (float64, error) {
+	if f.DIGErr != nil {
+		return 0, f.DIGErr
+	}
+
+	docWords := make(map[string]bool)
+	for _, w := range fakeWords(document) {
+		docWords[w] = true
+	}
+
+	queryWords := fakeWords(query)
+	if len(queryWords) == 0 {
+		return 0, nil
+	}
+
+	hits := 0
+	for _, w := range queryWords {
+		if docWords[w] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(queryWords)), nil
+}
+
+// Generate returns the scripted completion for prompt, or a fixed placeholder.
+func (f *FakeProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	if out, ok := f.Generations[prompt]; ok {
+		return out, nil
+	}
+	return fmt.Sprintf("fake completion for %d-token prompt", f.CountTokens(prompt)), nil
+}
+
+// Chat answers with Generate of the last message, streaming it to onDelta
+// one word at a time.
+func (f *FakeProvider) Chat(ctx context.Context, messages []models.ChatMessage, onDelta func(delta string) error) (string, error) {
+	if len(messages) == 0 {
+		return "", fmt.Errorf("fake chat: no messages")
+	}
+	reply, err := f.Generate(ctx, messages[len(messages)-1].Content)
+	if err != nil || onDelta == nil {
+		return reply, err
+	}
+	for _, delta := range strings.SplitAfter(reply, " ") {
+		if err := onDelta(delta); err != nil {
+			return reply, err
+		}
+	}
+	return reply, nil
+}
+
+// CountTokens uses the bytes/4 approximation providers fall back to without
+// a vocabulary.
+func (f *FakeProvider) CountTokens(text string) int {
+	return tokenizer.Approx{}.Count(text)
+}
+
+// Tokenizer returns the bytes/4 approximation.
+func (f *FakeProvider) Tokenizer() tokenizer.Tokenizer {
+	return tokenizer.Approx{}
+}
+
+// --- Helpers ---
+
+var fakeStopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "is": true, "are": true, "was": true,
+	"of": true, "to": true, "in": true, "at": true, "on": true, "and": true,
+	"or": true, "does": true, "do": true, "what": true, "where": true, "who": true,
+}
+
+// fakeWords lowercases text and returns its content words.
+func fakeWords(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	words := fields[:0]
+	for _, w := range fields {
+		if !fakeStopWords[w] {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// fakeSentences splits text on sentence-ending punctuation.
+func fakeSentences(text string) []string {
+	parts := strings.FieldsFunc(text, func(r rune) bool {
+		return r == '.' || r == '!' || r == '?' || r == '\n'
+	})
+
+	sentences := parts[:0]
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			sentences = append(sentences, p)
+		}
+	}
+	return sentences
+}
@@ -2,8 +2,12 @@ package llm
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 
+	"github.com/memora/cma/configs"
 	"github.com/memora/cma/internal/models"
+	"github.com/memora/cma/internal/tokenizer"
 )
 
 // Provider defines the interface for LLM operations required by the CMA system.
@@ -34,11 +38,91 @@ type Provider interface {
 	// Generate produces a completion given a prompt (for general-purpose use).
 	Generate(ctx context.Context, prompt string) (string, error)
 
-	// CountTokens returns the approximate token count for the given text.
+	// Chat answers a conversation. With onDelta set the reply is streamed:
+	// onDelta receives each chunk as it arrives, and an error it returns
+	// aborts the call. The full reply is returned either way.
+	Chat(ctx context.Context, messages []models.ChatMessage, onDelta func(delta string) error) (string, error)
+
+	// CountTokens returns the token count of text under the model's tokenizer.
 	CountTokens(text string) int
+
+	// Tokenizer returns the tokenizer CountTokens uses, so token budgets
+	// elsewhere are measured the same way.
+	Tokenizer() tokenizer.Tokenizer
+}
+
+// DIGBaseliner is implemented by providers whose ScoreDIG spends a separate
+// completion on the query-only baseline log P(y|x). Rerankers compute the
+// baseline once per query and score every document against it.
+type DIGBaseliner interface {
+	// DIGBaseline returns log P(y|x) for the query alone.
+	DIGBaseline(ctx context.Context, query string) (float64, error)
+
+	// ScoreDIGAgainst returns log P(y|x,d) - baseline.
+	ScoreDIGAgainst(ctx context.Context, query, document string, baseline float64) (float64, error)
+}
+
+// Embedder generates dense vector embeddings. Providers whose API has no
+// embeddings endpoint delegate to a separate Embedder.
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+	EmbedBatch(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// NewProvider creates the Provider selected by cfg.Provider.
+// Supported providers are "openai" (default), "anthropic" and "local"
+// (OpenAI-compatible servers such as Ollama, vLLM and llama.cpp).
+func NewProvider(cfg configs.LLMConfig) (Provider, error) {
+	switch cfg.Surprisal {
+	case "", "synthetic", "sliding_window":
+	default:
+		return nil, fmt.Errorf("unknown llm surprisal scorer %q", cfg.Surprisal)
+	}
+
+	switch cfg.Provider {
+	case "", "openai":
+		return NewOpenAIProvider(cfg), nil
+	case "local":
+		return NewLocalProvider(cfg), nil
+	case "anthropic":
+		embedder, err := newEmbedder(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewAnthropicProvider(cfg, embedder), nil
+	default:
+		return nil, fmt.Errorf("unknown llm provider %q", cfg.Provider)
+	}
+}
+
+// newEmbedder creates the embedding backend selected by cfg.EmbeddingProvider,
+// for chat providers that cannot embed themselves.
+func newEmbedder(cfg configs.LLMConfig) (Embedder, error) {
+	switch cfg.EmbeddingProvider {
+	case "", "openai":
+		return NewOpenAIProvider(configs.LLMConfig{
+			APIKey:         cfg.EmbeddingAPIKey,
+			BaseURL:        cfg.EmbeddingBaseURL,
+			EmbeddingModel: cfg.EmbeddingModel,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q", cfg.EmbeddingProvider)
+	}
+}
+
+// modelTokenizer returns the tokenizer for model, falling back to the
+// bytes/4 estimate when its vocabulary cannot be loaded.
+func modelTokenizer(cfg configs.LLMConfig, model string) tokenizer.Tokenizer {
+	tok, err := tokenizer.ForModel(cfg.Tokenizer, model)
+	if err != nil {
+		slog.Warn("tokenizer unavailable, estimating tokens", "model", model, "error", err)
+		return tokenizer.Approx{}
+	}
+	return tok
 }
 
 // TokenProb holds a token and its log probability.
+// Offset is the token's byte offset in the scored text.
 type TokenProb struct {
 	Token  string  `json:"token"`
 	LogProb float64 `json:"log_prob"`
@@ -0,0 +1,45 @@
+package llm
+
+import (
+	"github.com/memora/cma/configs"
+)
+
+const (
+	localDefaultBaseURL        = "http://localhost:11434/v1" // Ollama
+	localDefaultModel          = "llama3.1"
+	localDefaultEmbeddingModel = "nomic-embed-text"
+)
+
+// LocalProvider implements Provider against OpenAI-compatible local
+// inference servers such as Ollama, vLLM and the llama.cpp server, so no
+// memory content leaves the host.
+//
+// Chat and embedding requests can target different servers (base_url and
+// embedding_base_url). The chat model doubles as the surprisal model, so
+// GetTokenProbabilities scores the input text via echoed prompt logprobs
+// wherever the server supports echo.
+type LocalProvider struct {
+	*OpenAIProvider
+}
+
+// NewLocalProvider creates a new provider for an OpenAI-compatible local server.
+func NewLocalProvider(cfg configs.LLMConfig) *LocalProvider {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = localDefaultBaseURL
+	}
+	if cfg.EmbeddingBaseURL == "" {
+		cfg.EmbeddingBaseURL = cfg.BaseURL
+	}
+	if cfg.Model == "" {
+		cfg.Model = localDefaultModel
+	}
+	if cfg.EmbeddingModel == "" {
+		cfg.EmbeddingModel = localDefaultEmbeddingModel
+	}
+	if cfg.SurprisalModel == "" {
+		// Local servers serve /completions for the chat model itself.
+		cfg.SurprisalModel = cfg.Model
+	}
+
+	return &LocalProvider{OpenAIProvider: NewOpenAIProvider(cfg)}
+}
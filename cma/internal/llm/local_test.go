@@ -0,0 +1,140 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/memora/cma/configs"
+)
+
+// echoCompletion builds a /completions response echoing tokens with the
+// given logprobs and character offsets, followed by one generated token.
+func echoCompletion(tokens []string, logprobs []any, offsets []int) map[string]any {
+	return map[string]any{
+		"choices": []map[string]any{{
+			"text": "",
+			"logprobs": map[string]any{
+				"tokens":         tokens,
+				"token_logprobs": logprobs,
+				"text_offset":    offsets,
+			},
+		}},
+	}
+}
+
+func TestLocalProviderGetTokenProbabilities(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		status      int
+		body        any
+		wantTokens  []string
+		wantOffsets []int
+		wantLogProb []float64
+	}{
+		{
+			name:   "echoed prompt logprobs",
+			text:   "Hi there.",
+			status: 200,
+			// Last token is generated and must be dropped.
+			body: echoCompletion(
+				[]string{"Hi", " there", ".", " How"},
+				[]any{nil, -2.5, -0.5, -1.0},
+				[]int{0, 2, 8, 9},
+			),
+			wantTokens:  []string{"Hi", " there", "."},
+			wantOffsets: []int{0, 2, 8},
+			wantLogProb: []float64{0, -2.5, -0.5},
+		},
+		{
+			name:   "character offsets map to bytes",
+			text:   "café ok",
+			status: 200,
+			body: echoCompletion(
+				[]string{"café", " ok"},
+				[]any{nil, -3.0},
+				[]int{0, 4},
+			),
+			wantTokens:  []string{"café", " ok"},
+			wantOffsets: []int{0, 5},
+			wantLogProb: []float64{0, -3.0},
+		},
+		{
+			name:        "no echo support falls back to synthetic",
+			text:        "one two",
+			status:      404,
+			body:        map[string]any{"error": map[string]any{"message": "not found"}},
+			wantTokens:  []string{"one", "two"},
+			wantOffsets: []int{0, 4},
+			wantLogProb: []float64{-1, -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Without echo support the provider falls back to the
+				// synthetic scorer, not to per-word chat requests.
+				if r.URL.Path != "/v1/completions" {
+					t.Errorf("unexpected request to %s", r.URL.Path)
+				}
+				var req map[string]any
+				json.NewDecoder(r.Body).Decode(&req)
+				if req["echo"] != true || req["prompt"] != tt.text || req["model"] != localDefaultModel {
+					t.Errorf("request did not echo the prompt: %v", req)
+				}
+				w.Header().Set("content-type", "application/json")
+				w.WriteHeader(tt.status)
+				json.NewEncoder(w).Encode(tt.body)
+			}))
+			defer chat.Close()
+
+			p := NewLocalProvider(configs.LLMConfig{BaseURL: chat.URL + "/v1"})
+			probs, err := p.GetTokenProbabilities(context.Background(), tt.text)
+			if err != nil {
+				t.Fatalf("GetTokenProbabilities: %v", err)
+			}
+
+			if len(probs) != len(tt.wantTokens) {
+				t.Fatalf("got %d tokens %+v, want %d", len(probs), probs, len(tt.wantTokens))
+			}
+			for i, tp := range probs {
+				if tp.Token != tt.wantTokens[i] || tp.Offset != tt.wantOffsets[i] || tp.LogProb != tt.wantLogProb[i] {
+					t.Errorf("token %d = %+v, want {%q %v %d}", i, tp, tt.wantTokens[i], tt.wantLogProb[i], tt.wantOffsets[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLocalProviderSeparateEmbeddingEndpoint(t *testing.T) {
+	chat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("embedding request sent to chat server: %s", r.URL.Path)
+	}))
+	defer chat.Close()
+
+	embed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["model"] != localDefaultEmbeddingModel {
+			t.Errorf("embedding model = %v", req["model"])
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": []map[string]any{{"embedding": []float32{0.1, 0.2, 0.3}, "index": 0}},
+		})
+	}))
+	defer embed.Close()
+
+	p := NewLocalProvider(configs.LLMConfig{BaseURL: chat.URL + "/v1", EmbeddingBaseURL: embed.URL + "/v1"})
+	vec, err := p.Embed(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vec) != 3 {
+		t.Errorf("got %d dims, want 3", len(vec))
+	}
+}
@@ -0,0 +1,201 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// echoTokenProbs scores text with a legacy /completions request using
+// echo=true, which makes the server return the log probability of every
+// prompt token, log P(x_t | x_<t), rather than of the generated reply.
+//
+// The first token has no left context and is reported with LogProb 0.
+// Offsets are byte offsets into text. An error is returned when the
+// backend does not echo prompt logprobs.
+func echoTokenProbs(ctx context.Context, client *openai.Client, model, text string) ([]TokenProb, error) {
+	resp, err := client.CreateCompletion(ctx, openai.CompletionRequest{
+		Model:     model,
+		Prompt:    text,
+		MaxTokens: 1,
+		LogProbs:  1,
+		Echo:      true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("echo logprobs: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("echo logprobs: no choices")
+	}
+
+	lp := resp.Choices[0].LogProbs
+	if len(lp.Tokens) == 0 || len(lp.TokenLogprobs) != len(lp.Tokens) {
+		return nil, fmt.Errorf("echo logprobs: backend returned no prompt logprobs")
+	}
+
+	// text_offset is a character offset; map it onto bytes. Servers that
+	// omit it get offsets accumulated from the token texts instead.
+	runeToByte := make([]int, 0, len(text)+1)
+	for i := range text {
+		runeToByte = append(runeToByte, i)
+	}
+	runeToByte = append(runeToByte, len(text))
+	promptRunes := utf8.RuneCountInString(text)
+
+	probs := make([]TokenProb, 0, len(lp.Tokens))
+	cursor := 0
+	for i, tok := range lp.Tokens {
+		offset := cursor
+		if i < len(lp.TextOffset) {
+			if lp.TextOffset[i] >= promptRunes {
+				break // generated token, not part of the prompt
+			}
+			offset = runeToByte[lp.TextOffset[i]]
+		} else if cursor >= len(text) {
+			break
+		}
+
+		logProb := float64(lp.TokenLogprobs[i])
+		if i == 0 {
+			logProb = 0
+		}
+
+		probs = append(probs, TokenProb{Token: tok, LogProb: logProb, Offset: offset})
+		cursor = offset + len(tok)
+	}
+
+	if len(probs) == 0 {
+		return nil, fmt.Errorf("echo logprobs: no prompt tokens in response")
+	}
+
+	return probs, nil
+}
+
+// slidingWindowTokenProbs estimates log P(x_t | x_<t) for every word of text
+// on backends that only expose completion logprobs. Each word x_t costs one
+// next-token request whose prompt is the preceding window words; the word's
+// log probability is read from the top alternatives of the first generated
+// token. Words whose first sub-token is not among the alternatives get the
+// least likely alternative's log probability, an upper bound on the truth.
+//
+// Requests run with at most concurrency in flight. The first word has no
+// left context and is reported with LogProb 0. Offsets are byte offsets.
+func slidingWindowTokenProbs(ctx context.Context, client *openai.Client, model, text string, window, concurrency int) ([]TokenProb, error) {
+	probs := whitespaceTokens(text)
+	if len(probs) < 2 {
+		return probs, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		sem      = make(chan struct{}, concurrency)
+	)
+
+	for t := 1; t < len(probs); t++ {
+		if ctx.Err() != nil {
+			break
+		}
+
+		start := t - window
+		if start < 0 {
+			start = 0
+		}
+		prefix := text[probs[start].Offset:probs[t].Offset]
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(t int, prefix string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			lp, err := nextWordLogProb(ctx, client, model, prefix, probs[t].Token)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			probs[t].LogProb = lp
+		}(t, prefix)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, fmt.Errorf("sliding window logprobs: %w", firstErr)
+	}
+
+	return probs, nil
+}
+
+// nextWordLogProb returns the model's log probability that word follows prefix.
+func nextWordLogProb(ctx context.Context, client *openai.Client, model, prefix, word string) (float64, error) {
+	resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "Continue the user's text verbatim. Reply with the next word only."},
+			{Role: openai.ChatMessageRoleUser, Content: prefix},
+		},
+		MaxTokens:   1,
+		LogProbs:    true,
+		TopLogProbs: 20,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].LogProbs == nil || len(resp.Choices[0].LogProbs.Content) == 0 {
+		return 0, fmt.Errorf("no logprobs returned")
+	}
+
+	first := resp.Choices[0].LogProbs.Content[0]
+	alternatives := first.TopLogProbs // includes the sampled token
+	if len(alternatives) == 0 {
+		alternatives = []openai.TopLogProbs{{Token: first.Token, LogProb: first.LogProb}}
+	}
+
+	best := math.Inf(-1)
+	floor := 0.0
+	for _, alt := range alternatives {
+		floor = math.Min(floor, alt.LogProb)
+		tok := strings.TrimSpace(alt.Token)
+		if tok != "" && strings.HasPrefix(word, tok) && alt.LogProb > best {
+			best = alt.LogProb
+		}
+	}
+
+	if math.IsInf(best, -1) {
+		return floor, nil
+	}
+	return best, nil
+}
+
+// whitespaceTokens splits text into whitespace-separated words with byte offsets.
+func whitespaceTokens(text string) []TokenProb {
+	var tokens []TokenProb
+	start := -1
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				tokens = append(tokens, TokenProb{Token: text[start:i], Offset: start})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, TokenProb{Token: text[start:], Offset: start})
+	}
+	return tokens
+}
@@ -3,7 +3,10 @@ package llm
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"math"
 	"strings"
 
@@ -11,20 +14,41 @@ import (
 
 	"github.com/memora/cma/configs"
 	"github.com/memora/cma/internal/models"
+	"github.com/memora/cma/internal/tokenizer"
 )
 
 // OpenAIProvider implements Provider using the OpenAI API.
 type OpenAIProvider struct {
 	client         *openai.Client
+	embedClient    *openai.Client // same as client unless embedding_base_url is set
 	model          string
 	embeddingModel string
 	maxTokens      int
 	temperature    float64
+
+	// Prompt-token surprisal scoring, see GetTokenProbabilities.
+	surprisal            string
+	surprisalModel       string
+	surprisalWindow      int
+	surprisalConcurrency int
+
+	tokenizer tokenizer.Tokenizer
 }
 
 // NewOpenAIProvider creates a new OpenAI-backed LLM provider.
 func NewOpenAIProvider(cfg configs.LLMConfig) *OpenAIProvider {
-	client := openai.NewClient(cfg.APIKey)
+	clientCfg := openai.DefaultConfig(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		clientCfg.BaseURL = cfg.BaseURL
+	}
+	client := openai.NewClientWithConfig(clientCfg)
+
+	embedClient := client
+	if cfg.EmbeddingBaseURL != "" && cfg.EmbeddingBaseURL != cfg.BaseURL {
+		embedCfg := openai.DefaultConfig(cfg.APIKey)
+		embedCfg.BaseURL = cfg.EmbeddingBaseURL
+		embedClient = openai.NewClientWithConfig(embedCfg)
+	}
 
 	model := cfg.Model
 	if model == "" {
@@ -34,19 +58,33 @@ func NewOpenAIProvider(cfg configs.LLMConfig) *OpenAIProvider {
 	if embModel == "" {
 		embModel = "text-embedding-3-small"
 	}
+	window := cfg.SurprisalWindow
+	if window <= 0 {
+		window = 64
+	}
+	concurrency := cfg.SurprisalConcurrency
+	if concurrency <= 0 {
+		concurrency = 8
+	}
 
 	return &OpenAIProvider{
-		client:         client,
-		model:          model,
-		embeddingModel: embModel,
-		maxTokens:      cfg.MaxTokens,
-		temperature:    cfg.Temperature,
+		client:               client,
+		embedClient:          embedClient,
+		model:                model,
+		embeddingModel:       embModel,
+		maxTokens:            cfg.MaxTokens,
+		temperature:          cfg.Temperature,
+		surprisal:            cfg.Surprisal,
+		surprisalModel:       cfg.SurprisalModel,
+		surprisalWindow:      window,
+		surprisalConcurrency: concurrency,
+		tokenizer:            modelTokenizer(cfg, model),
 	}
 }
 
 // Embed generates a dense vector embedding for the given text.
 func (o *OpenAIProvider) Embed(ctx context.Context, text string) ([]float32, error) {
-	resp, err := o.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+	resp, err := o.embedClient.CreateEmbeddings(ctx, openai.EmbeddingRequest{
 		Model: openai.EmbeddingModel(o.embeddingModel),
 		Input: []string{text},
 	})
@@ -63,7 +101,7 @@ func (o *OpenAIProvider) Embed(ctx context.Context, text string) ([]float32, err
 
 // EmbedBatch generates embeddings for multiple texts in a single API call.
 func (o *OpenAIProvider) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
-	resp, err := o.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+	resp, err := o.embedClient.CreateEmbeddings(ctx, openai.EmbeddingRequest{
 		Model: openai.EmbeddingModel(o.embeddingModel),
 		Input: texts,
 	})
@@ -79,44 +117,37 @@ func (o *OpenAIProvider) EmbedBatch(ctx context.Context, texts []string) ([][]fl
 	return embeddings, nil
 }
 
-// GetTokenProbabilities returns per-token log probabilities using the chat completions
-// API with logprobs enabled. Used by the surprisal segmentation engine for
-// Surprisal(x_t) = -log P(x_t | x_<t).
+// GetTokenProbabilities returns Surprisal(x_t) = -log P(x_t | x_<t) inputs
+// for the tokens of text itself, used by the surprisal segmentation engine.
+// Sources, in order of preference:
+//
+//  1. echoed prompt logprobs from surprisal_model via /completions, when set
+//  2. sliding-window next-token scoring of each word with the chat model,
+//     when surprisal is "sliding_window"
+//  3. the synthetic heuristic
+//
+// Sliding-window scoring costs one chat request per word, so it is opt-in.
+// Offsets are byte offsets into text.
 func (o *OpenAIProvider) GetTokenProbabilities(ctx context.Context, text string) ([]TokenProb, error) {
-	logprobs := true
-	resp, err := o.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model: o.model,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: text,
-			},
-		},
-		MaxTokens:   1,
-		LogProbs:    logprobs,
-		TopLogProbs: 1,
-	})
-	if err != nil {
-		// Fallback: generate synthetic probabilities based on word frequency heuristic.
-		return o.syntheticTokenProbs(text), nil
-	}
-
-	var probs []TokenProb
-	if resp.Choices != nil && len(resp.Choices) > 0 {
-		choice := resp.Choices[0]
-		if choice.LogProbs != nil {
-			for _, tokenLP := range choice.LogProbs.Content {
-				probs = append(probs, TokenProb{
-					Token:   tokenLP.Token,
-					LogProb: float64(tokenLP.LogProb),
-				})
-			}
+	if o.surprisalModel != "" {
+		probs, err := echoTokenProbs(ctx, o.client, o.surprisalModel, text)
+		if err == nil {
+			return probs, nil
 		}
+		slog.Debug("prompt logprobs unavailable", "model", o.surprisalModel, "error", err)
 	}
 
-	// If logprobs not available from the API, fall back to synthetic.
-	if len(probs) == 0 {
-		return o.syntheticTokenProbs(text), nil
+	if o.surprisal != "sliding_window" {
+		return syntheticTokenProbs(text), nil
+	}
+
+	probs, err := slidingWindowTokenProbs(ctx, o.client, o.model, text, o.surprisalWindow, o.surprisalConcurrency)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("openai token probabilities: %w", ctx.Err())
+		}
+		slog.Debug("next-token logprobs unavailable, using synthetic surprisal", "model", o.model, "error", err)
+		return syntheticTokenProbs(text), nil
 	}
 
 	return probs, nil
@@ -125,18 +156,19 @@ func (o *OpenAIProvider) GetTokenProbabilities(ctx context.Context, text string)
 // syntheticTokenProbs generates heuristic-based token probabilities when
 // real logprobs are unavailable. Uses sentence boundary and punctuation
 // signals as a proxy for surprisal.
-func (o *OpenAIProvider) syntheticTokenProbs(text string) []TokenProb {
-	words := strings.Fields(text)
-	probs := make([]TokenProb, 0, len(words))
+func syntheticTokenProbs(text string) []TokenProb {
+	probs := whitespaceTokens(text)
+
+	for i := range probs {
+		word := probs[i].Token
 
-	for i, word := range words {
 		// Heuristic: shorter common words get higher probability (lower surprisal).
 		// Sentence starters and words after punctuation get lower probability (higher surprisal).
 		logProb := -1.0 // baseline
 
 		// Increase surprisal at sentence boundaries.
 		if i > 0 {
-			prev := words[i-1]
+			prev := probs[i-1].Token
 			if strings.HasSuffix(prev, ".") || strings.HasSuffix(prev, "!") || strings.HasSuffix(prev, "?") {
 				logProb = -4.0 // high surprisal after sentence boundary
 			}
@@ -152,11 +184,7 @@ func (o *OpenAIProvider) syntheticTokenProbs(text string) []TokenProb {
 			logProb -= 2.0
 		}
 
-		probs = append(probs, TokenProb{
-			Token:   word,
-			LogProb: logProb,
-			Offset:  i,
-		})
+		probs[i].LogProb = logProb
 	}
 
 	return probs
@@ -183,7 +211,7 @@ Text:
 		Messages: []openai.ChatCompletionMessage{
 			{
 				Role:    openai.ChatMessageRoleSystem,
-				Content: "You are a precise knowledge extraction engine. Extract atomic facts as (Subject, Predicate, Object) triples with confidence scores. Return only valid JSON.",
+				Content: extractTriplesSystemPrompt,
 			},
 			{
 				Role:    openai.ChatMessageRoleUser,
@@ -219,24 +247,14 @@ Text:
 
 // Synthesize generates a gist proposition from a cluster of episodes.
 func (o *OpenAIProvider) Synthesize(ctx context.Context, episodes []models.Episode) (string, error) {
-	var sb strings.Builder
-	for i, ep := range episodes {
-		sb.WriteString(fmt.Sprintf("Episode %d (t=%s): %s\n", i+1, ep.Timestamp.Format("2006-01-02T15:04"), ep.Content))
-	}
-
-	prompt := fmt.Sprintf(`Synthesize the following episodic memory fragments into a single concise semantic proposition.
-The proposition should capture the core factual knowledge that persists across episodes.
-Be atomic and precise. Return only the proposition text.
-
-Fragments:
-%s`, sb.String())
+	prompt := synthesizePrompt(episodes)
 
 	resp, err := o.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
 		Model: o.model,
 		Messages: []openai.ChatCompletionMessage{
 			{
 				Role:    openai.ChatMessageRoleSystem,
-				Content: "You are a memory consolidation engine. Distill episodic fragments into a single semantic fact.",
+				Content: synthesizeSystemPrompt,
 			},
 			{
 				Role:    openai.ChatMessageRoleUser,
@@ -263,8 +281,17 @@ Fragments:
 //
 // This measures how much a document reduces uncertainty about the answer.
 func (o *OpenAIProvider) ScoreDIG(ctx context.Context, query string, document string) (float64, error) {
-	// Step 1: Get log probability of answer without context.
-	baselineResp, err := o.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+	baseline, err := o.DIGBaseline(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return o.ScoreDIGAgainst(ctx, query, document, baseline)
+}
+
+// DIGBaseline returns log P(y|x): the average log probability of the
+// answer to the query without context.
+func (o *OpenAIProvider) DIGBaseline(ctx context.Context, query string) (float64, error) {
+	resp, err := o.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
 		Model: o.model,
 		Messages: []openai.ChatCompletionMessage{
 			{Role: openai.ChatMessageRoleUser, Content: query},
@@ -276,10 +303,14 @@ func (o *OpenAIProvider) ScoreDIG(ctx context.Context, query string, document st
 	if err != nil {
 		return 0, fmt.Errorf("dig baseline: %w", err)
 	}
+	return avgLogProb(resp), nil
+}
 
-	// Step 2: Get log probability of answer with context document.
+// ScoreDIGAgainst returns log P(y|x,d) - baseline for a baseline from
+// DIGBaseline.
+func (o *OpenAIProvider) ScoreDIGAgainst(ctx context.Context, query, document string, baseline float64) (float64, error) {
 	contextPrompt := fmt.Sprintf("Context:\n%s\n\nQuestion: %s", document, query)
-	contextResp, err := o.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+	resp, err := o.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
 		Model: o.model,
 		Messages: []openai.ChatCompletionMessage{
 			{Role: openai.ChatMessageRoleUser, Content: contextPrompt},
@@ -292,12 +323,8 @@ func (o *OpenAIProvider) ScoreDIG(ctx context.Context, query string, document st
 		return 0, fmt.Errorf("dig context: %w", err)
 	}
 
-	baselineLP := avgLogProb(baselineResp)
-	contextLP := avgLogProb(contextResp)
-
 	// DIG = log P(y|x,d) - log P(y|x)
-	dig := contextLP - baselineLP
-	return dig, nil
+	return avgLogProb(resp) - baseline, nil
 }
 
 // Generate produces a completion for general-purpose use.
@@ -321,15 +348,64 @@ func (o *OpenAIProvider) Generate(ctx context.Context, prompt string) (string, e
 	return resp.Choices[0].Message.Content, nil
 }
 
-// CountTokens returns an approximate token count using the ~4 chars per token heuristic.
-// For production, integrate tiktoken.
-func (o *OpenAIProvider) CountTokens(text string) int {
-	// Reasonable approximation: 1 token ≈ 4 characters for English text.
-	count := len(text) / 4
-	if count == 0 && len(text) > 0 {
-		count = 1
+// Chat answers a conversation, streaming the reply to onDelta if set.
+func (o *OpenAIProvider) Chat(ctx context.Context, messages []models.ChatMessage, onDelta func(delta string) error) (string, error) {
+	req := openai.ChatCompletionRequest{
+		Model:       o.model,
+		Messages:    make([]openai.ChatCompletionMessage, len(messages)),
+		MaxTokens:   o.maxTokens,
+		Temperature: float32(o.temperature),
+	}
+	for i, m := range messages {
+		req.Messages[i] = openai.ChatCompletionMessage{Role: m.Role, Content: m.Content}
 	}
-	return count
+
+	if onDelta == nil {
+		resp, err := o.client.CreateChatCompletion(ctx, req)
+		if err != nil {
+			return "", fmt.Errorf("openai chat: %w", err)
+		}
+		if len(resp.Choices) == 0 {
+			return "", fmt.Errorf("openai chat: no response")
+		}
+		return resp.Choices[0].Message.Content, nil
+	}
+
+	stream, err := o.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("openai chat: %w", err)
+	}
+	defer stream.Close()
+
+	var reply strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return reply.String(), nil
+		}
+		if err != nil {
+			return reply.String(), fmt.Errorf("openai chat stream: %w", err)
+		}
+		if len(resp.Choices) == 0 || resp.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		delta := resp.Choices[0].Delta.Content
+		reply.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			return reply.String(), err
+		}
+	}
+}
+
+// CountTokens counts tokens with the model's tokenizer.
+func (o *OpenAIProvider) CountTokens(text string) int {
+	return o.tokenizer.Count(text)
+}
+
+// Tokenizer returns the tokenizer of the configured model.
+func (o *OpenAIProvider) Tokenizer() tokenizer.Tokenizer {
+	return o.tokenizer
 }
 
 // --- Helpers ---
@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/models"
+)
+
+// nextTokenStandIn serves /v1/chat/completions, answering each prompt with
+// the scripted top-logprob alternatives for its first generated token.
+func nextTokenStandIn(t *testing.T, alternatives map[string]map[string]float64) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+			LogProbs bool `json:"logprobs"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.LogProbs || len(req.Messages) == 0 {
+			t.Errorf("request without logprobs or messages: %+v", req)
+		}
+
+		prefix := req.Messages[len(req.Messages)-1].Content
+		alts, ok := alternatives[prefix]
+		if !ok {
+			t.Errorf("unexpected prefix %q", prefix)
+		}
+
+		var top []map[string]any
+		for tok, lp := range alts {
+			top = append(top, map[string]any{"token": tok, "logprob": lp})
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{
+				"message":  map[string]any{"role": "assistant", "content": ""},
+				"logprobs": map[string]any{"content": []map[string]any{{"token": "", "logprob": 0.0, "top_logprobs": top}}},
+			}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOpenAIProviderSlidingWindowSurprisal(t *testing.T) {
+	// A window of one word: each request sees only the previous word.
+	srv := nextTokenStandIn(t, map[string]map[string]float64{
+		"The  ": {" cat": -0.5, " dog": -1.5},
+		"cat ":  {" on": -0.3, " mat": -4.0}, // "sat" is absent: least likely alternative
+		"sat\n": {" down": -0.2, " still": -2.0},
+	})
+
+	p := NewOpenAIProvider(configs.LLMConfig{BaseURL: srv.URL + "/v1", Surprisal: "sliding_window", SurprisalWindow: 1})
+	probs, err := p.GetTokenProbabilities(context.Background(), "The  cat sat\ndown")
+	if err != nil {
+		t.Fatalf("GetTokenProbabilities: %v", err)
+	}
+
+	want := []TokenProb{
+		{Token: "The", LogProb: 0, Offset: 0},
+		{Token: "cat", LogProb: -0.5, Offset: 5},
+		{Token: "sat", LogProb: -4.0, Offset: 9},
+		{Token: "down", LogProb: -0.2, Offset: 13},
+	}
+	if len(probs) != len(want) {
+		t.Fatalf("got %d tokens %+v, want %d", len(probs), probs, len(want))
+	}
+	for i := range want {
+		if probs[i] != want[i] {
+			t.Errorf("token %d = %+v, want %+v", i, probs[i], want[i])
+		}
+	}
+}
+
+func TestOpenAIProviderPrefersEchoedLogProbs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/completions" {
+			t.Errorf("sliding window used despite echo support: %s", r.URL.Path)
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(echoCompletion([]string{"a", " b"}, []any{nil, -2.0}, []int{0, 1}))
+	}))
+	defer srv.Close()
+
+	p := NewOpenAIProvider(configs.LLMConfig{BaseURL: srv.URL + "/v1", SurprisalModel: "davinci-002"})
+	probs, err := p.GetTokenProbabilities(context.Background(), "a b")
+	if err != nil {
+		t.Fatalf("GetTokenProbabilities: %v", err)
+	}
+	if len(probs) != 2 || probs[1].LogProb != -2.0 {
+		t.Errorf("got %+v, want echoed logprobs", probs)
+	}
+}
+
+func TestOpenAIProviderChatStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Stream   bool                 `json:"stream"`
+			Messages []models.ChatMessage `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream || len(req.Messages) != 2 || req.Messages[0].Role != "system" {
+			t.Errorf("request = %+v", req)
+		}
+
+		w.Header().Set("content-type", "text/event-stream")
+		for _, delta := range []string{"At ", "Google."} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", delta)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	p := NewOpenAIProvider(configs.LLMConfig{BaseURL: srv.URL + "/v1"})
+	var deltas []string
+	reply, err := p.Chat(context.Background(), []models.ChatMessage{
+		{Role: "system", Content: "Memories: Alice works at Google."},
+		{Role: "user", Content: "Where does Alice work?"},
+	}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if reply != "At Google." || len(deltas) != 2 {
+		t.Errorf("reply %q from deltas %q", reply, deltas)
+	}
+}
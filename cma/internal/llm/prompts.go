@@ -0,0 +1,29 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/memora/cma/internal/models"
+)
+
+// Prompts shared by every chat-based Provider implementation.
+
+const extractTriplesSystemPrompt = "You are a precise knowledge extraction engine. Extract atomic facts as (Subject, Predicate, Object) triples with confidence scores. Return only valid JSON."
+
+const synthesizeSystemPrompt = "You are a memory consolidation engine. Distill episodic fragments into a single semantic fact."
+
+// synthesizePrompt lists a cluster's episodes for gist synthesis.
+func synthesizePrompt(episodes []models.Episode) string {
+	var sb strings.Builder
+	for i, ep := range episodes {
+		sb.WriteString(fmt.Sprintf("Episode %d (t=%s): %s\n", i+1, ep.Timestamp.Format("2006-01-02T15:04"), ep.Content))
+	}
+
+	return fmt.Sprintf(`Synthesize the following episodic memory fragments into a single concise semantic proposition.
+The proposition should capture the core factual knowledge that persists across episodes.
+Be atomic and precise. Return only the proposition text.
+
+Fragments:
+%s`, sb.String())
+}
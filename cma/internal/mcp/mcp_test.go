@@ -0,0 +1,315 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/consolidation"
+	"github.com/memora/cma/internal/dig"
+	"github.com/memora/cma/internal/graphstore"
+	"github.com/memora/cma/internal/ingest"
+	"github.com/memora/cma/internal/knapsack"
+	"github.com/memora/cma/internal/llm"
+	"github.com/memora/cma/internal/metrics"
+	"github.com/memora/cma/internal/models"
+	"github.com/memora/cma/internal/retrieval"
+	"github.com/memora/cma/internal/segmentation"
+	"github.com/memora/cma/internal/vectorstore"
+	"github.com/memora/cma/internal/workspace"
+)
+
+var testMetrics = metrics.New()
+
+// newTestServer wires the server over in-memory stores and the fake LLM.
+func newTestServer(t *testing.T, cfg configs.MCPConfig) *Server {
+	t.Helper()
+
+	const dim = 64
+	provider := llm.NewFakeProvider(dim)
+	vectorDB := vectorstore.NewInMemoryStore(configs.QdrantConfig{VectorSize: dim})
+	graphDB, err := graphstore.NewInMemoryStore(configs.Neo4jConfig{})
+	if err != nil {
+		t.Fatalf("graph store: %v", err)
+	}
+
+	segmenter := segmentation.NewSurprisalEngine(provider, nil, configs.SegmentationConfig{
+		Gamma:            1.5,
+		WindowSize:       50,
+		MinEpisodeTokens: 5,
+		MaxEpisodeTokens: 200,
+	})
+	knapsackCfg := configs.KnapsackConfig{TokenBudget: 512, ForceRecentTurns: 2}
+	retriever := retrieval.NewService(vectorDB, graphDB, provider, configs.RetrievalConfig{
+		VectorTopK:   10,
+		GraphMaxHops: 2,
+		Timeout:      5 * time.Second,
+	}, testMetrics)
+	ws := workspace.NewWorkspace(
+		retriever,
+		dig.NewReranker(dig.NewLLMScorer(provider, 0), dig.NewLRUCache(0), nil, configs.DIGConfig{MinScore: 0}),
+		knapsack.NewOptimizer(knapsackCfg, provider.Tokenizer()),
+		workspace.NewMemoryTurnStore(configs.WorkspaceConfig{}),
+		provider.Tokenizer(),
+		knapsackCfg,
+		testMetrics,
+	)
+	consolCfg := configs.ConsolidationConfig{DecayRate: 0.5, MaxUnconsolidated: 10}
+	worker := consolidation.NewWorker(
+		vectorDB,
+		provider,
+		consolidation.NewDBSCAN(0.3, 2),
+		consolidation.NewConflictResolver(graphDB, consolCfg.DecayRate),
+		consolCfg,
+		testMetrics,
+	)
+	scheduler := consolidation.NewScheduler(worker, vectorDB, nil, nil, consolCfg)
+
+	return NewServer(ingest.NewService(segmenter, vectorDB, testMetrics), ws, graphDB, vectorDB, scheduler, "test", cfg)
+}
+
+// toolResult is the decoded result of a tools/call.
+type toolResult struct {
+	Content []struct {
+		Text string `json:"text"`
+	} `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent"`
+	IsError           bool            `json:"isError"`
+}
+
+// stdioSession runs lines through ServeStdio and returns the replies by id.
+func stdioSession(t *testing.T, s *Server, lines ...string) map[int]json.RawMessage {
+	t.Helper()
+
+	var out bytes.Buffer
+	if err := s.ServeStdio(context.Background(), strings.NewReader(strings.Join(lines, "\n")), &out); err != nil {
+		t.Fatalf("ServeStdio: %v", err)
+	}
+
+	replies := make(map[int]json.RawMessage)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var resp struct {
+			ID     int             `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  *rpcError       `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("reply %q: %v", line, err)
+		}
+		if resp.Error != nil {
+			replies[resp.ID], _ = json.Marshal(resp.Error)
+			continue
+		}
+		replies[resp.ID] = resp.Result
+	}
+	return replies
+}
+
+func call(id int, name string, args any) string {
+	data, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  "tools/call",
+		"params":  map[string]any{"name": name, "arguments": args},
+	})
+	return string(data)
+}
+
+func decodeResult(t *testing.T, raw json.RawMessage) toolResult {
+	t.Helper()
+	var r toolResult
+	if err := json.Unmarshal(raw, &r); err != nil || len(r.Content) == 0 {
+		t.Fatalf("not a tool result: %s", raw)
+	}
+	return r
+}
+
+func TestInputSchema(t *testing.T) {
+	schema := inputSchema(models.QueryRequest{}, "user_id")
+	props := schema["properties"].(map[string]any)
+
+	if _, ok := props["user_id"]; ok {
+		t.Error("user_id is in the schema")
+	}
+	if got := schema["required"]; !reflect.DeepEqual(got, []string{"query"}) {
+		t.Errorf("required = %v, want [query]", got)
+	}
+	if got := props["scope"].(map[string]any)["enum"]; !reflect.DeepEqual(got, []string{"user", "session"}) {
+		t.Errorf("scope enum = %v", got)
+	}
+	if got := props["profile"]; !reflect.DeepEqual(got, map[string]any{"type": "array", "items": map[string]any{"type": "string"}}) {
+		t.Errorf("profile = %v", got)
+	}
+	if got := props["token_budget"].(map[string]any)["type"]; got != "integer" {
+		t.Errorf("token_budget type = %v", got)
+	}
+
+	// Only user_id is required, so nothing is once it is omitted.
+	if _, ok := inputSchema(models.ConsolidateRequest{}, "user_id")["required"]; ok {
+		t.Error("consolidate schema has required properties")
+	}
+}
+
+func TestStdioTools(t *testing.T) {
+	s := newTestServer(t, configs.MCPConfig{UserID: "alice"})
+
+	replies := stdioSession(t, s,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		call(3, "remember", map[string]any{"content": "Alice works at Google as a senior engineer.", "role": "user"}),
+		call(4, "remember", map[string]any{"content": "Alice lives in Paris near the river.", "role": "user"}),
+		call(5, "recall", map[string]any{"query": "Where does Alice work?"}),
+		call(6, "consolidate", nil),
+		call(7, "list_facts", map[string]any{"subject": "Alice"}),
+		call(8, "remember", map[string]any{"content": "no role"}),
+		call(9, "recall", map[string]any{"query": "x", "user": "bob"}),
+		call(10, "fly", nil),
+	)
+
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if err := json.Unmarshal(replies[1], &init); err != nil || init.ProtocolVersion != "2025-03-26" {
+		t.Errorf("initialize = %s", replies[1])
+	}
+	if len(replies) != 10 {
+		t.Errorf("%d replies, want one per request and none for the notification", len(replies))
+	}
+
+	var list struct {
+		Tools []struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+	}
+	json.Unmarshal(replies[2], &list)
+	var names []string
+	for _, tool := range list.Tools {
+		names = append(names, tool.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"remember", "recall", "list_facts", "forget", "consolidate"}) {
+		t.Errorf("tools = %v", names)
+	}
+
+	if r := decodeResult(t, replies[5]); r.IsError || !strings.Contains(r.Content[0].Text, "] Alice works at Google") {
+		t.Errorf("recall = %+v", r)
+	}
+	var consolidated map[string]int
+	json.Unmarshal(decodeResult(t, replies[6]).StructuredContent, &consolidated)
+	if consolidated["episodes_consolidated"] != 2 || consolidated["pending"] != 0 {
+		t.Errorf("consolidate = %v", consolidated)
+	}
+	if r := decodeResult(t, replies[7]); !strings.Contains(r.Content[0].Text, "Alice works at Google") {
+		t.Errorf("list_facts = %q", r.Content[0].Text)
+	}
+
+	// Invalid arguments are tool errors; unknown tools protocol errors.
+	for _, id := range []int{8, 9} {
+		if r := decodeResult(t, replies[id]); !r.IsError || !strings.Contains(r.Content[0].Text, "invalid arguments") {
+			t.Errorf("call %d = %+v, want an invalid arguments error", id, r)
+		}
+	}
+	if !strings.Contains(string(replies[10]), "unknown tool") {
+		t.Errorf("unknown tool = %s", replies[10])
+	}
+}
+
+func TestForgetIsTenantScoped(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, configs.MCPConfig{})
+	alice := &Session{UserID: "alice"}
+	bob := &Session{UserID: "bob"}
+
+	out, err := s.remember(ctx, alice.UserID, json.RawMessage(`{"content":"Alice works at Google as a senior engineer.","role":"user"}`))
+	if err != nil {
+		t.Fatalf("remember: %v", err)
+	}
+	ids := out.structured.(*models.IngestResponse).EpisodeIDs
+	args, _ := json.Marshal(models.ForgetRequest{EpisodeIDs: ids})
+
+	// Bob cannot forget Alice's episode; Alice can.
+	for _, tt := range []struct {
+		sess *Session
+		want int
+	}{{bob, 0}, {alice, len(ids)}} {
+		result := s.callTool(ctx, tt.sess, s.tool("forget"), args)
+		resp := result["structuredContent"].(models.ForgetResponse)
+		if resp.EpisodesDeleted != tt.want {
+			t.Errorf("%s forgot %d episodes, want %d", tt.sess.UserID, resp.EpisodesDeleted, tt.want)
+		}
+	}
+	if n, _ := s.vectorDB.CountUnconsolidated(ctx, "alice"); n != 0 {
+		t.Errorf("alice has %d episodes left, want 0", n)
+	}
+}
+
+func TestHTTPSessions(t *testing.T) {
+	srv := httptest.NewServer(newTestServer(t, configs.MCPConfig{}))
+	defer srv.Close()
+
+	post := func(sessionID, tenant, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if sessionID != "" {
+			req.Header.Set(HeaderSessionID, sessionID)
+		}
+		if tenant != "" {
+			req.Header.Set(HeaderTenantID, tenant)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`
+	ping := `{"jsonrpc":"2.0","id":2,"method":"ping"}`
+
+	if resp := post("", "", initialize); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("initialize without tenant: %d, want 400", resp.StatusCode)
+	}
+	resp := post("", "alice", initialize)
+	sessionID := resp.Header.Get(HeaderSessionID)
+	if resp.StatusCode != http.StatusOK || sessionID == "" {
+		t.Fatalf("initialize: %d, session %q", resp.StatusCode, sessionID)
+	}
+
+	tests := []struct {
+		name      string
+		sessionID string
+		tenant    string
+		body      string
+		want      int
+	}{
+		{"request in session", sessionID, "", ping, http.StatusOK},
+		{"notification", sessionID, "alice", `{"jsonrpc":"2.0","method":"notifications/initialized"}`, http.StatusAccepted},
+		{"no session", "", "alice", ping, http.StatusBadRequest},
+		{"unknown session", "nope", "", ping, http.StatusNotFound},
+		{"other tenant", sessionID, "bob", ping, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := post(tt.sessionID, tt.tenant, tt.body); resp.StatusCode != tt.want {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL, nil)
+	req.Header.Set(HeaderSessionID, sessionID)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete: %v", err)
+	}
+	if resp := post(sessionID, "", ping); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("closed session: %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,103 @@
+package mcp
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// inputSchema derives a tool's JSON Schema from a models request type, so
+// tools accept exactly what the HTTP API binds: json tags name the
+// properties, binding:"required" marks them required and oneof lists their
+// values. Properties named in omit, such as the session's user_id, are
+// left out.
+func inputSchema(req any, omit ...string) map[string]any {
+	schema := typeSchema(reflect.TypeOf(req))
+	props := schema["properties"].(map[string]any)
+	required, _ := schema["required"].([]string)
+	for _, name := range omit {
+		delete(props, name)
+		for i, r := range required {
+			if r == name {
+				required = append(required[:i], required[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(required) == 0 {
+		delete(schema, "required")
+	} else {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// typeSchema returns the JSON Schema of a Go type as encoding/json
+// marshals it.
+func typeSchema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.Interface {
+			return map[string]any{"type": "object"}
+		}
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	default:
+		return map[string]any{}
+	}
+}
+
+// structSchema returns the object schema of a struct's exported, json
+// encoded fields.
+func structSchema(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := typeSchema(f.Type)
+		for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+			switch {
+			case rule == "required":
+				required = append(required, name)
+			case strings.HasPrefix(rule, "oneof="):
+				prop["enum"] = strings.Fields(strings.TrimPrefix(rule, "oneof="))
+			}
+		}
+		props[name] = prop
+	}
+
+	schema := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
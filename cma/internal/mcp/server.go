@@ -0,0 +1,214 @@
+// Package mcp serves the memory system as Model Context Protocol tools, so
+// agent runtimes can remember, recall and forget through their tool calls.
+//
+// Messages are JSON-RPC 2.0 over stdio (one per line) or over the
+// Streamable HTTP transport with plain JSON responses. Every session is
+// bound to one tenant when it is initialized, and all tool calls of the
+// session are scoped to it.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/consolidation"
+	"github.com/memora/cma/internal/graphstore"
+	"github.com/memora/cma/internal/ingest"
+	"github.com/memora/cma/internal/vectorstore"
+	"github.com/memora/cma/internal/workspace"
+)
+
+// ProtocolVersions are the MCP revisions the server speaks, newest first.
+var ProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// Server answers MCP messages with the memory tools.
+type Server struct {
+	ingest    *ingest.Service
+	workspace *workspace.Workspace
+	graphDB   graphstore.GraphStore
+	vectorDB  vectorstore.VectorStore
+	scheduler *consolidation.Scheduler
+	version   string
+	cfg       configs.MCPConfig
+
+	tools []tool
+
+	mu       sync.Mutex
+	sessions map[string]*Session // http transport
+}
+
+// Session is one MCP connection. UserID scopes its tool calls.
+type Session struct {
+	ID       string
+	UserID   string
+	lastSeen time.Time
+}
+
+// NewServer creates an MCP server; version is reported to clients.
+func NewServer(
+	ingestSvc *ingest.Service,
+	ws *workspace.Workspace,
+	graphDB graphstore.GraphStore,
+	vectorDB vectorstore.VectorStore,
+	scheduler *consolidation.Scheduler,
+	version string,
+	cfg configs.MCPConfig,
+) *Server {
+	if cfg.SessionTTL == 0 {
+		cfg.SessionTTL = 24 * time.Hour
+	}
+	s := &Server{
+		ingest:    ingestSvc,
+		workspace: ws,
+		graphDB:   graphDB,
+		vectorDB:  vectorDB,
+		scheduler: scheduler,
+		version:   version,
+		cfg:       cfg,
+		sessions:  make(map[string]*Session),
+	}
+	s.tools = s.memoryTools()
+	return s
+}
+
+// --- JSON-RPC ---
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"` // absent for notifications
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// isNotification reports whether req expects no response. Responses from
+// the client, which this server never solicits, count as notifications.
+func (r *request) isNotification() bool {
+	return len(r.ID) == 0 || r.Method == ""
+}
+
+// Handle answers one JSON-RPC message of sess. It returns nil for
+// notifications.
+func (s *Server) Handle(ctx context.Context, sess *Session, msg []byte) []byte {
+	var req request
+	if err := json.Unmarshal(msg, &req); err != nil {
+		return encode(errorResponse(json.RawMessage("null"), codeParseError, "parse error: "+err.Error()))
+	}
+	if req.isNotification() {
+		return nil
+	}
+
+	return encode(s.dispatch(ctx, sess, &req))
+}
+
+// dispatch routes a request to its method.
+func (s *Server) dispatch(ctx context.Context, sess *Session, req *request) response {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		_ = json.Unmarshal(req.Params, &params)
+		return result(req.ID, map[string]any{
+			"protocolVersion": negotiate(params.ProtocolVersion),
+			"capabilities":    map[string]any{"tools": map[string]any{"listChanged": false}},
+			"serverInfo":      map[string]any{"name": "memora-cma", "version": s.version},
+			"instructions": "Long-term memory of user " + sess.UserID + ". Call recall before answering questions " +
+				"that may depend on the past, and remember facts worth keeping.",
+		})
+
+	case "ping":
+		return result(req.ID, map[string]any{})
+
+	case "tools/list":
+		return result(req.ID, map[string]any{"tools": s.tools})
+
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return errorResponse(req.ID, codeInvalidParams, "invalid params: "+err.Error())
+		}
+		t := s.tool(params.Name)
+		if t == nil {
+			return errorResponse(req.ID, codeInvalidParams, "unknown tool: "+params.Name)
+		}
+		return result(req.ID, s.callTool(ctx, sess, t, params.Arguments))
+
+	default:
+		return errorResponse(req.ID, codeMethodNotFound, "method not found: "+req.Method)
+	}
+}
+
+// callTool runs a tool. Failures are reported in the result, where the
+// model can see them, rather than as protocol errors.
+func (s *Server) callTool(ctx context.Context, sess *Session, t *tool, args json.RawMessage) map[string]any {
+	out, err := t.call(ctx, sess.UserID, args)
+	if err != nil {
+		slog.Warn("mcp tool call failed", "tool", t.Name, "user_id", sess.UserID, "error", err)
+		return map[string]any{
+			"content": []map[string]any{{"type": "text", "text": err.Error()}},
+			"isError": true,
+		}
+	}
+
+	return map[string]any{
+		"content":           []map[string]any{{"type": "text", "text": out.text}},
+		"structuredContent": out.structured,
+		"isError":           false,
+	}
+}
+
+// --- Helpers ---
+
+// negotiate returns the client's protocol version if supported, else the
+// newest one.
+func negotiate(version string) string {
+	for _, v := range ProtocolVersions {
+		if v == version {
+			return v
+		}
+	}
+	return ProtocolVersions[0]
+}
+
+func result(id json.RawMessage, v any) response {
+	return response{JSONRPC: "2.0", ID: id, Result: v}
+}
+
+func errorResponse(id json.RawMessage, code int, message string) response {
+	return response{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message}}
+}
+
+func encode(resp response) []byte {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		data, _ = json.Marshal(errorResponse(resp.ID, codeInvalidRequest, "encode response: "+err.Error()))
+	}
+	return data
+}
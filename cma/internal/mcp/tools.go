@@ -0,0 +1,214 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/memora/cma/internal/models"
+)
+
+// tool is an MCP tool definition with its handler.
+type tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+
+	call func(ctx context.Context, userID string, args json.RawMessage) (toolOutput, error)
+}
+
+// toolOutput is a tool result: text for the model and the same result as
+// structured content.
+type toolOutput struct {
+	text       string
+	structured any
+}
+
+// memoryTools returns the tools the server exposes. Their inputs are the
+// HTTP API's request types without user_id, which the session supplies.
+func (s *Server) memoryTools() []tool {
+	return []tool{
+		{
+			Name: "remember",
+			Description: "Store a message in long-term episodic memory. role is who said it, " +
+				`"user" or "assistant"; session_id groups messages into a conversation.`,
+			InputSchema: inputSchema(models.IngestRequest{}, "user_id"),
+			call:        s.remember,
+		},
+		{
+			Name: "recall",
+			Description: "Retrieve the memories most useful for answering query, packed into token_budget " +
+				`tokens. Memories are numbered [Memory N]; format selects markdown (default), xml, json or messages.`,
+			InputSchema: inputSchema(models.QueryRequest{}, "user_id"),
+			call:        s.recall,
+		},
+		{
+			Name:        "list_facts",
+			Description: "List the currently valid facts consolidated about an entity, e.g. a person or company, with their IDs.",
+			InputSchema: inputSchema(models.ListFactsRequest{}, "user_id"),
+			call:        s.listFacts,
+		},
+		{
+			Name: "forget",
+			Description: "Delete episodes by ID (from recall sources) and retract facts by ID (from list_facts). " +
+				"Retracted facts stop being valid but stay in the graph's history.",
+			InputSchema: inputSchema(models.ForgetRequest{}, "user_id"),
+			call:        s.forget,
+		},
+		{
+			Name:        "consolidate",
+			Description: "Run the sleep cycle now: cluster pending episodes and consolidate them into facts.",
+			InputSchema: inputSchema(models.ConsolidateRequest{}, "user_id"),
+			call:        s.consolidate,
+		},
+	}
+}
+
+// tool returns the tool called name, or nil.
+func (s *Server) tool(name string) *tool {
+	for i := range s.tools {
+		if s.tools[i].Name == name {
+			return &s.tools[i]
+		}
+	}
+	return nil
+}
+
+// --- Tools ---
+
+func (s *Server) remember(ctx context.Context, userID string, args json.RawMessage) (toolOutput, error) {
+	var req models.IngestRequest
+	if err := bindArgs(args, &req, userID); err != nil {
+		return toolOutput{}, err
+	}
+
+	if err := s.workspace.AddTurn(ctx, req.UserID, req.SessionID, req.Role, req.Content); err != nil {
+		slog.Warn("add turn failed", "user_id", req.UserID, "error", err)
+	}
+
+	resp, err := s.ingest.Ingest(ctx, req)
+	if err != nil {
+		return toolOutput{}, fmt.Errorf("remember: %w", err)
+	}
+	return jsonOutput(resp)
+}
+
+func (s *Server) recall(ctx context.Context, userID string, args json.RawMessage) (toolOutput, error) {
+	var req models.QueryRequest
+	if err := bindArgs(args, &req, userID); err != nil {
+		return toolOutput{}, err
+	}
+
+	resp, err := s.workspace.Query(ctx, req)
+	if err != nil {
+		return toolOutput{}, fmt.Errorf("recall: %w", err)
+	}
+	return toolOutput{text: resp.Context, structured: resp}, nil
+}
+
+func (s *Server) listFacts(ctx context.Context, userID string, args json.RawMessage) (toolOutput, error) {
+	var req models.ListFactsRequest
+	if err := bindArgs(args, &req, userID); err != nil {
+		return toolOutput{}, err
+	}
+
+	facts, err := s.graphDB.QueryBySubject(ctx, req.UserID, req.Subject)
+	if err != nil {
+		return toolOutput{}, fmt.Errorf("list facts: %w", err)
+	}
+	if facts == nil {
+		facts = []models.GraphRelationship{}
+	}
+
+	var sb strings.Builder
+	if len(facts) == 0 {
+		sb.WriteString("No facts about " + req.Subject + ".")
+	}
+	for _, f := range facts {
+		fmt.Fprintf(&sb, "%s: %s %s %s (confidence %.2f)\n", f.ID, f.FromName, f.RelationType, f.ToName, f.Confidence)
+	}
+	return toolOutput{text: strings.TrimSpace(sb.String()), structured: map[string]any{"facts": facts}}, nil
+}
+
+func (s *Server) forget(ctx context.Context, userID string, args json.RawMessage) (toolOutput, error) {
+	var req models.ForgetRequest
+	if err := bindArgs(args, &req, userID); err != nil {
+		return toolOutput{}, err
+	}
+
+	var resp models.ForgetResponse
+	var err error
+	if len(req.EpisodeIDs) > 0 {
+		if resp.EpisodesDeleted, err = s.vectorDB.DeleteUserEpisodes(ctx, req.UserID, req.EpisodeIDs); err != nil {
+			return toolOutput{}, fmt.Errorf("forget episodes: %w", err)
+		}
+	}
+	if len(req.FactIDs) > 0 {
+		if resp.FactsRetracted, err = s.graphDB.Retract(ctx, req.UserID, req.FactIDs); err != nil {
+			return toolOutput{}, fmt.Errorf("forget facts: %w", err)
+		}
+	}
+
+	slog.Info("mcp forget", "user_id", req.UserID, "episodes_deleted", resp.EpisodesDeleted, "facts_retracted", resp.FactsRetracted)
+	return jsonOutput(resp)
+}
+
+func (s *Server) consolidate(ctx context.Context, userID string, args json.RawMessage) (toolOutput, error) {
+	var req models.ConsolidateRequest
+	if err := bindArgs(args, &req, userID); err != nil {
+		return toolOutput{}, err
+	}
+
+	before, err := s.vectorDB.CountUnconsolidated(ctx, req.UserID)
+	if err != nil {
+		return toolOutput{}, fmt.Errorf("consolidate: %w", err)
+	}
+
+	// The scheduler's per-user lock keeps this from racing another
+	// consolidation of the same episodes.
+	if err := s.scheduler.Run(ctx, req.UserID); err != nil {
+		return toolOutput{}, fmt.Errorf("consolidate: %w", err)
+	}
+
+	after, err := s.vectorDB.CountUnconsolidated(ctx, req.UserID)
+	if err != nil {
+		return toolOutput{}, fmt.Errorf("consolidate: %w", err)
+	}
+	return jsonOutput(map[string]int{"episodes_consolidated": before - after, "pending": after})
+}
+
+// --- Helpers ---
+
+// bindArgs decodes tool arguments into req, scopes it to the session's
+// tenant and validates it as the HTTP API's ShouldBindJSON does. Unknown
+// arguments are rejected; a user_id argument is overridden.
+func bindArgs(args json.RawMessage, req any, userID string) error {
+	if len(bytes.TrimSpace(args)) > 0 && !bytes.Equal(bytes.TrimSpace(args), []byte("null")) {
+		dec := json.NewDecoder(bytes.NewReader(args))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(req); err != nil {
+			return fmt.Errorf("invalid arguments: %w", err)
+		}
+	}
+
+	reflect.ValueOf(req).Elem().FieldByName("UserID").SetString(userID)
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+// jsonOutput returns v as indented JSON text and as structured content.
+func jsonOutput(v any) (toolOutput, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return toolOutput{}, fmt.Errorf("encode result: %w", err)
+	}
+	return toolOutput{text: string(data), structured: v}, nil
+}
@@ -0,0 +1,194 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Header names of the Streamable HTTP transport.
+const (
+	HeaderSessionID = "Mcp-Session-Id"
+	HeaderTenantID  = "X-Tenant-ID"
+)
+
+// maxMessageBytes bounds one JSON-RPC message.
+const maxMessageBytes = 4 << 20
+
+// --- stdio ---
+
+// ServeStdio serves one session over newline-delimited JSON-RPC until in
+// is closed. The session's tenant is the configured user_id.
+func (s *Server) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	if s.cfg.UserID == "" {
+		return errors.New("mcp stdio: mcp.user_id is required")
+	}
+	sess := &Session{ID: "stdio", UserID: s.cfg.UserID}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageBytes)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var reply []byte
+		if line[0] == '[' {
+			reply = encode(errorResponse(json.RawMessage("null"), codeInvalidRequest, "batches are not supported"))
+		} else {
+			reply = s.Handle(ctx, sess, line)
+		}
+		if reply == nil {
+			continue
+		}
+		if _, err := out.Write(append(reply, '\n')); err != nil {
+			return fmt.Errorf("mcp stdio write: %w", err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("mcp stdio read: %w", err)
+	}
+	return nil
+}
+
+// --- Streamable HTTP ---
+
+// ServeHTTP implements the Streamable HTTP transport with JSON responses.
+// initialize opens a session for the X-Tenant-ID header's tenant (or the
+// configured user_id) and returns its Mcp-Session-Id, which every later
+// request must carry; DELETE closes it. The server sends no requests of
+// its own, so GET streams are not offered.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		s.servePost(w, r)
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.sessions, r.Header.Get(HeaderSessionID))
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) servePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageBytes))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse(json.RawMessage("null"), codeInvalidRequest, err.Error()))
+		return
+	}
+
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse(json.RawMessage("null"), codeParseError, "parse error: "+err.Error()))
+		return
+	}
+
+	var sess *Session
+	if req.Method == "initialize" {
+		userID := r.Header.Get(HeaderTenantID)
+		if userID == "" {
+			userID = s.cfg.UserID
+		}
+		if userID == "" {
+			writeJSON(w, http.StatusBadRequest, errorResponse(req.ID, codeInvalidRequest, "set the "+HeaderTenantID+" header"))
+			return
+		}
+		sess = s.openSession(userID)
+		w.Header().Set(HeaderSessionID, sess.ID)
+	} else {
+		id := r.Header.Get(HeaderSessionID)
+		if id == "" {
+			writeJSON(w, http.StatusBadRequest, errorResponse(req.ID, codeInvalidRequest, "missing "+HeaderSessionID+" header"))
+			return
+		}
+		if sess = s.session(id); sess == nil {
+			writeJSON(w, http.StatusNotFound, errorResponse(req.ID, codeInvalidRequest, "unknown or expired session"))
+			return
+		}
+		if tenant := r.Header.Get(HeaderTenantID); tenant != "" && tenant != sess.UserID {
+			writeJSON(w, http.StatusForbidden, errorResponse(req.ID, codeInvalidRequest, "session belongs to another tenant"))
+			return
+		}
+	}
+
+	reply := s.Handle(r.Context(), sess, body)
+	if reply == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(reply)
+}
+
+// openSession creates a session for userID, expiring idle ones.
+func (s *Server) openSession(userID string) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, sess := range s.sessions {
+		if now.Sub(sess.lastSeen) > s.cfg.SessionTTL {
+			delete(s.sessions, id)
+		}
+	}
+
+	sess := &Session{ID: uuid.NewString(), UserID: userID, lastSeen: now}
+	s.sessions[sess.ID] = sess
+	return sess
+}
+
+// session returns the live session id, or nil.
+func (s *Server) session(id string) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	if now.Sub(sess.lastSeen) > s.cfg.SessionTTL {
+		delete(s.sessions, id)
+		return nil
+	}
+	sess.lastSeen = now
+	return sess
+}
+
+// --- Helpers ---
+
+// sameOrigin rejects browser requests from other origins, which could
+// otherwise reach a local server through DNS rebinding.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func writeJSON(w http.ResponseWriter, status int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(encode(resp))
+}
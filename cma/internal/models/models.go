@@ -25,6 +25,38 @@ const (
 	MemorySemantic MemoryType = "semantic"
 )
 
+// Episode metadata keys set by the ingest pipeline. Role and source are
+// indexed for filtering in the vector store.
+const (
+	MetaRole       = "role"   // "user" or "assistant"
+	MetaSource     = "source" // caller-defined origin, e.g. "api" or "import"
+	MetaIngestedAt = "ingested_at"
+)
+
+// Query scopes: whether retrieval stays within the request's session or
+// searches the user's whole memory, favouring the session's episodes.
+const (
+	ScopeUser    = "user"
+	ScopeSession = "session"
+)
+
+// Context formats a query's assembled context can be rendered in.
+const (
+	FormatMarkdown = "markdown" // headed sections with [Memory N] prefixes
+	FormatXML      = "xml"      // tagged blocks with source IDs and timestamps
+	FormatJSON     = "json"     // one JSON object per section
+	FormatMessages = "messages" // chat messages; recent turns keep their roles
+)
+
+// Episode metadata keys locating an episode in the message it was cut from:
+// Content == message[span_start:span_end], offsets in bytes.
+const (
+	MetaMessageID = "message_id"
+	MetaSpanStart = "span_start"
+	MetaSpanEnd   = "span_end"
+	MetaSegmenter = "segmenter" // segmentation strategy that cut the episode
+)
+
 // --- Core Domain Types ---
 
 // Episode represents a segmented episodic memory fragment produced by the
@@ -32,6 +64,7 @@ const (
 type Episode struct {
 	ID                  string              `json:"id"`
 	UserID              string              `json:"user_id"`
+	SessionID           string              `json:"session_id,omitempty"`
 	Content             string              `json:"content"`
 	Embedding           []float32           `json:"embedding"`
 	Timestamp           time.Time           `json:"timestamp"`
@@ -102,6 +135,10 @@ type GraphRelationship struct {
 	SourceEpisodeID string    `json:"source_ep_id"`
 	DecayRate       float64   `json:"decay_rate"`
 	Properties      map[string]any `json:"properties,omitempty"`
+
+	// Entity names, filled by queries that return them.
+	FromName string `json:"from_name,omitempty"`
+	ToName   string `json:"to_name,omitempty"`
 }
 
 // --- Consolidation Types ---
@@ -152,7 +189,48 @@ type RetrievalResult struct {
 type DIGCandidate struct {
 	Result   RetrievalResult `json:"result"`
 	DIGScore float64         `json:"dig_score"`
+	Scorer   string          `json:"scorer"` // scorer that produced DIGScore
 	Content  string          `json:"content"`
+
+	// Probability is the calibrated P(helpful) of DIGScore for the tenant;
+	// nil until the tenant's feedback has calibrated the scorer.
+	Probability *float64 `json:"probability,omitempty"`
+}
+
+// DIGScore is a candidate's score in QueryResponse.DIGScores with the
+// scorer that produced it; fallback scores report "heuristic".
+type DIGScore struct {
+	Score       float64  `json:"score"`
+	Scorer      string   `json:"scorer"`
+	Probability *float64 `json:"probability,omitempty"` // calibrated P(helpful)
+}
+
+// DIGFeedback is one labelled reranking outcome: the score a candidate got
+// for a query and whether it turned out to be helpful.
+type DIGFeedback struct {
+	Query       string    `json:"query"`
+	CandidateID string    `json:"candidate_id"`
+	Score       float64   `json:"score"`
+	Scorer      string    `json:"scorer"`
+	Helpful     bool      `json:"helpful"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// DIGCalibration maps a tenant's raw scores from one scorer to P(helpful).
+// It is the isotonic (monotone) regression of their feedback: Probs is
+// non-decreasing over the ascending Scores knots and interpolated between
+// them.
+type DIGCalibration struct {
+	UserID  string    `json:"user_id"`
+	Scorer  string    `json:"scorer"`
+	Samples int       `json:"samples"`
+	Scores  []float64 `json:"scores"`
+	Probs   []float64 `json:"probs"`
+
+	// Threshold is the lowest score whose P(helpful) reaches the configured
+	// minimum; nil if no score does.
+	Threshold *float64  `json:"threshold"`
+	FittedAt  time.Time `json:"fitted_at"`
 }
 
 // KnapsackItem represents a candidate memory fragment for context
@@ -164,6 +242,32 @@ type KnapsackItem struct {
 	Weight     int     `json:"weight"`      // Token count
 	ForceInclude bool  `json:"force_include"` // For recent turns
 	Density    float64 `json:"density"`     // value / weight
+	Section    string  `json:"section,omitempty"` // context section, e.g. SectionEpisodes
+
+	// Role of a conversation turn, and when the turn or episode happened,
+	// for renderers that show them.
+	Role      string    `json:"role,omitempty"`
+	Timestamp time.Time `json:"-"`
+
+	// Embedding of the content, when known, for redundancy-aware packing.
+	Embedding []float32 `json:"-"`
+}
+
+// Context sections a knapsack item is packed into. The query is reported
+// as a section of its own but is reserved rather than packed.
+const (
+	SectionProfile  = "profile" // user profile and pinned notes
+	SectionTurns    = "turns"
+	SectionFacts    = "facts"
+	SectionEpisodes = "episodes"
+	SectionQuery    = "query"
+)
+
+// SectionUsage is the tokens a context section used and, when the budget
+// is split between sections, the budget it was allocated after spillover.
+type SectionUsage struct {
+	Budget int `json:"budget,omitempty"`
+	Used   int `json:"used"`
 }
 
 // --- Workspace Types ---
@@ -179,6 +283,35 @@ type WorkspaceContext struct {
 	TokenBudget    int             `json:"token_budget"`
 }
 
+// WorkspaceSelection records the knapsack decision of a conversation's last
+// query: every candidate kept or rejected, and the density threshold λ.
+type WorkspaceSelection struct {
+	UserID        string          `json:"user_id"`
+	SessionID     string          `json:"session_id,omitempty"`
+	Query         string          `json:"query"`
+	Items         []WorkspaceItem `json:"items"` // kept items first, then rejected
+	Lambda        float64         `json:"lambda"`
+	TotalTokens   int             `json:"total_tokens"`
+	TokenBudget   int             `json:"token_budget"`
+	Utilization   float64         `json:"utilization"`
+	Solver        string          `json:"solver"`
+	OptimalityGap float64         `json:"optimality_gap"`
+	Timestamp     time.Time       `json:"timestamp"`
+}
+
+// WorkspaceItem is a knapsack item with its selection outcome. For
+// retrieved memories Value is the DIG score.
+type WorkspaceItem struct {
+	KnapsackItem
+	Status string `json:"status"` // ItemKept or ItemRejected
+}
+
+// Workspace item statuses.
+const (
+	ItemKept     = "kept"
+	ItemRejected = "rejected"
+)
+
 // ConversationTurn holds a single user/assistant exchange.
 type ConversationTurn struct {
 	Role      string    `json:"role"` // "user" or "assistant"
@@ -190,13 +323,20 @@ type ConversationTurn struct {
 
 // IngestRequest is the API payload for ingesting new memory.
 type IngestRequest struct {
-	UserID  string `json:"user_id" binding:"required"`
-	Content string `json:"content" binding:"required"`
-	Role    string `json:"role" binding:"required"` // "user" or "assistant"
+	UserID    string `json:"user_id" binding:"required"`
+	SessionID string `json:"session_id,omitempty"` // conversation; empty is the user's default
+	Content   string `json:"content" binding:"required"`
+	Role      string `json:"role" binding:"required"` // "user" or "assistant"
+
+	// Metadata is stored with every episode of the message, e.g.
+	// {"source": "import"}. Keys set by the pipeline
+	// (role, message_id, span offsets, ...) take precedence.
+	Metadata map[string]any `json:"metadata,omitempty"`
 }
 
 // IngestResponse returns metadata about the ingested episodes.
 type IngestResponse struct {
+	MessageID  string   `json:"message_id"`
 	EpisodeIDs []string `json:"episode_ids"`
 	Segments   int      `json:"segments"`
 	Message    string   `json:"message"`
@@ -207,6 +347,44 @@ type QueryRequest struct {
 	UserID     string `json:"user_id" binding:"required"`
 	Query      string `json:"query" binding:"required"`
 	TokenBudget int   `json:"token_budget,omitempty"`
+
+	// Profile holds the user's profile or pinned notes, packed ahead of
+	// retrieved memories within the profile section's budget.
+	Profile []string `json:"profile,omitempty"`
+
+	// SessionID selects the conversation whose recent turns are included
+	// and whose episodes are favoured (or, with Scope "session", required).
+	SessionID string `json:"session_id,omitempty" binding:"required_if=Scope session"`
+	Scope     string `json:"scope,omitempty" binding:"omitempty,oneof=user session"` // ScopeUser (default) or ScopeSession
+
+	// ExcludeTurns leaves the stored recent turns out of the context, for
+	// callers that send the conversation to the model themselves.
+	ExcludeTurns bool `json:"exclude_turns,omitempty"`
+
+	// Format selects how the context is rendered (default FormatMarkdown).
+	Format string `json:"format,omitempty" binding:"omitempty,oneof=markdown xml json messages"`
+}
+
+// ChatMessage is one message of a chat completion conversation.
+type ChatMessage struct {
+	Role    string `json:"role"` // "system", "user" or "assistant"
+	Content string `json:"content"`
+}
+
+// FeedbackRequest reports which memories of a query's context were helpful,
+// echoing their dig_scores from the query response.
+type FeedbackRequest struct {
+	UserID string         `json:"user_id" binding:"required"`
+	Query  string         `json:"query" binding:"required"`
+	Items  []FeedbackItem `json:"items" binding:"required,min=1,dive"`
+}
+
+// FeedbackItem labels one memory of a query response.
+type FeedbackItem struct {
+	ID      string  `json:"id" binding:"required"`
+	Score   float64 `json:"score"`                     // dig_scores[id].score
+	Scorer  string  `json:"scorer" binding:"required"` // dig_scores[id].scorer
+	Helpful bool    `json:"helpful"`                   // used in the answer or rated helpful
 }
 
 // QueryResponse returns the assembled context and metadata.
@@ -215,7 +393,66 @@ type QueryResponse struct {
 	Sources       []RetrievalResult `json:"sources"`
 	TokensUsed    int               `json:"tokens_used"`
 	TokenBudget   int               `json:"token_budget"`
-	DIGScores     map[string]float64 `json:"dig_scores,omitempty"`
+	DIGScores     map[string]DIGScore `json:"dig_scores,omitempty"`
+	Sections      map[string]SectionUsage `json:"sections,omitempty"` // tokens per context section
+
+	// Format the context was rendered in; with FormatMessages, Messages
+	// holds the conversation that Context encodes as JSON.
+	Format   string        `json:"format"`
+	Messages []ChatMessage `json:"messages,omitempty"`
+
+	// MemoryIDs are the episode IDs of the context's memories in
+	// [Memory N] order; graph facts have none and are "".
+	MemoryIDs []string `json:"memory_ids,omitempty"`
+}
+
+// ChatRequest is a user message answered from memory by POST /api/v1/chat.
+type ChatRequest struct {
+	UserID      string   `json:"user_id" binding:"required"`
+	SessionID   string   `json:"session_id,omitempty"`
+	Message     string   `json:"message" binding:"required"`
+	TokenBudget int      `json:"token_budget,omitempty"`
+	Profile     []string `json:"profile,omitempty"`
+	Scope       string   `json:"scope,omitempty" binding:"omitempty,oneof=user session"`
+}
+
+// Citation links a [Memory N] marker of an answer to its episode.
+type Citation struct {
+	Memory    int    `json:"memory"` // N
+	EpisodeID string `json:"episode_id"`
+}
+
+// ChatResponse is the answer to a ChatRequest with the memories it cites.
+type ChatResponse struct {
+	Answer     string            `json:"answer"`
+	Citations  []Citation        `json:"citations"`
+	Sources    []RetrievalResult `json:"sources"`
+	TokensUsed int               `json:"tokens_used"` // context tokens sent to the model
+}
+
+// ListFactsRequest asks for the currently valid facts about a subject.
+type ListFactsRequest struct {
+	UserID  string `json:"user_id" binding:"required"`
+	Subject string `json:"subject" binding:"required"` // entity name, e.g. "Alice"
+}
+
+// ForgetRequest removes episodes and retracts graph facts of a user.
+type ForgetRequest struct {
+	UserID     string   `json:"user_id" binding:"required"`
+	EpisodeIDs []string `json:"episode_ids,omitempty" binding:"required_without=FactIDs"`
+	FactIDs    []string `json:"fact_ids,omitempty" binding:"required_without=EpisodeIDs"` // relationship IDs
+}
+
+// ForgetResponse reports what a ForgetRequest removed. IDs that are
+// unknown or belong to other users are not counted.
+type ForgetResponse struct {
+	EpisodesDeleted int `json:"episodes_deleted"`
+	FactsRetracted  int `json:"facts_retracted"`
+}
+
+// ConsolidateRequest runs a user's Sleep cycle.
+type ConsolidateRequest struct {
+	UserID string `json:"user_id" binding:"required"`
 }
 
 // HealthResponse is returned by the health check endpoint.
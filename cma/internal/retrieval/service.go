@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -25,12 +26,17 @@ import (
 //
 // Both routines execute concurrently via goroutines, and results are
 // merged and deduplicated before being passed to DIG reranking.
+//
+// Episodic search honours the query's session scope; semantic memory is
+// consolidated per user and always spans all sessions.
 type Service struct {
 	vectorDB    vectorstore.VectorStore
 	graphDB     graphstore.GraphStore
 	llmProvider llm.Provider
 	cfg         configs.RetrievalConfig
 	metrics     *metrics.Metrics
+
+	sessionBoost float64
 }
 
 // NewService creates a new hybrid retrieval service.
@@ -41,17 +47,25 @@ func NewService(
 	cfg configs.RetrievalConfig,
 	m *metrics.Metrics,
 ) *Service {
+	sessionBoost := 0.1
+	if cfg.SessionBoost != nil {
+		sessionBoost = *cfg.SessionBoost
+	}
 	return &Service{
-		vectorDB:    vectorDB,
-		graphDB:     graphDB,
-		llmProvider: llmProvider,
-		cfg:         cfg,
-		metrics:     m,
+		vectorDB:     vectorDB,
+		graphDB:      graphDB,
+		llmProvider:  llmProvider,
+		cfg:          cfg,
+		metrics:      m,
+		sessionBoost: sessionBoost,
 	}
 }
 
-// Retrieve executes concurrent hybrid retrieval and returns merged results.
-func (s *Service) Retrieve(ctx context.Context, userID string, query string) ([]models.RetrievalResult, error) {
+// Retrieve executes concurrent hybrid retrieval for req and returns merged
+// results. Episodes carry their embeddings only with withVectors.
+func (s *Service) Retrieve(ctx context.Context, req models.QueryRequest, withVectors bool) ([]models.RetrievalResult, error) {
+	userID, query := req.UserID, req.Query
+
 	start := time.Now()
 	defer func() {
 		s.metrics.RetrievalLatency.Observe(time.Since(start).Seconds())
@@ -83,7 +97,7 @@ func (s *Service) Retrieve(ctx context.Context, userID string, query string) ([]
 	go func() {
 		defer wg.Done()
 		s.metrics.VectorSearchCount.Inc()
-		vectorResults, vectorErr = s.vectorDB.Search(ctx, userID, queryEmbedding, s.cfg.VectorTopK)
+		vectorResults, vectorErr = s.searchEpisodes(ctx, req, queryEmbedding, withVectors)
 		if vectorErr != nil {
 			slog.Error("vector search failed", "error", vectorErr)
 		}
@@ -114,6 +128,7 @@ func (s *Service) Retrieve(ctx context.Context, userID string, query string) ([]
 
 	slog.Info("retrieval completed",
 		"user_id", userID,
+		"session_id", req.SessionID,
 		"vector_results", len(vectorResults),
 		"graph_results", len(graphResults),
 		"merged_results", len(merged),
@@ -122,6 +137,50 @@ func (s *Service) Retrieve(ctx context.Context, userID string, query string) ([]
 	return merged, nil
 }
 
+// searchEpisodes runs the vector search in the query's scope. Session scope
+// filters on the session. User scope searches both the whole memory and the
+// session, so session episodes outside the global top-K still compete, and
+// adds the session boost to the session's hits before re-ranking.
+func (s *Service) searchEpisodes(ctx context.Context, req models.QueryRequest, queryEmbedding []float32, withVectors bool) ([]models.RetrievalResult, error) {
+	topK := s.cfg.VectorTopK
+	if req.SessionID == "" {
+		return s.vectorDB.Search(ctx, req.UserID, "", queryEmbedding, topK, withVectors)
+	}
+	if req.Scope == models.ScopeSession {
+		return s.vectorDB.Search(ctx, req.UserID, req.SessionID, queryEmbedding, topK, withVectors)
+	}
+
+	session, err := s.vectorDB.Search(ctx, req.UserID, req.SessionID, queryEmbedding, topK, withVectors)
+	if err != nil {
+		return nil, err
+	}
+	all, err := s.vectorDB.Search(ctx, req.UserID, "", queryEmbedding, topK, withVectors)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(session)+len(all))
+	results := make([]models.RetrievalResult, 0, len(session)+len(all))
+	for _, r := range append(session, all...) {
+		if r.Episode == nil || seen[r.Episode.ID] {
+			continue
+		}
+		seen[r.Episode.ID] = true
+		if r.Episode.SessionID == req.SessionID {
+			r.Score += s.sessionBoost
+		}
+		results = append(results, r)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results, nil
+}
+
 // mergeResults combines vector and graph results, deduplicating by content.
 func (s *Service) mergeResults(vectorResults, graphResults []models.RetrievalResult) []models.RetrievalResult {
 	seen := make(map[string]bool)
@@ -180,9 +239,11 @@ func (s *Service) extractEntities(query string) []string {
 	return entities
 }
 
-// contentKey generates a deduplication key from a retrieval result.
+// contentKey generates a deduplication key from a retrieval result. Graph
+// results carry an episode without an ID for their text, so they are keyed
+// by their facts.
 func contentKey(r models.RetrievalResult) string {
-	if r.Episode != nil {
+	if r.Episode != nil && r.Episode.ID != "" {
 		return "ep:" + r.Episode.ID
 	}
 	if len(r.GraphFacts) > 0 {
@@ -0,0 +1,79 @@
+package retrieval
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/graphstore"
+	"github.com/memora/cma/internal/llm"
+	"github.com/memora/cma/internal/metrics"
+	"github.com/memora/cma/internal/models"
+	"github.com/memora/cma/internal/vectorstore"
+)
+
+var testMetrics = metrics.New()
+
+func TestRetrieveSessionScope(t *testing.T) {
+	ctx := context.Background()
+	provider := llm.NewFakeProvider(256)
+	vectorDB := vectorstore.NewInMemoryStore(configs.QdrantConfig{VectorSize: 256})
+	graphDB, err := graphstore.NewInMemoryStore(configs.Neo4jConfig{})
+	if err != nil {
+		t.Fatalf("graph store: %v", err)
+	}
+
+	// The other session's episode is the closer match to the query.
+	var episodes []models.Episode
+	for session, content := range map[string]string{
+		"s1": "alice trip kyoto hotel",
+		"s2": "alice trip plans tokyo",
+	} {
+		vec, _ := provider.Embed(ctx, content)
+		ep := models.NewEpisode("alice", content, vec, 1)
+		ep.SessionID = session
+		episodes = append(episodes, *ep)
+	}
+	if err := vectorDB.Upsert(ctx, episodes); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	service := func(boost float64) *Service {
+		return NewService(vectorDB, graphDB, provider, configs.RetrievalConfig{
+			VectorTopK:   1,
+			Timeout:      time.Second,
+			SessionBoost: &boost,
+		}, testMetrics)
+	}
+
+	tests := []struct {
+		name      string
+		boost     float64
+		sessionID string
+		scope     string
+		want      string
+	}{
+		{"no session", 0.5, "", "", "s2"},
+		{"user scope boosts own session", 0.5, "s1", models.ScopeUser, "s1"},
+		{"user scope is the default", 0.5, "s1", "", "s1"},
+		{"session scope", 0.5, "s1", models.ScopeSession, "s1"},
+		{"zero boost is off", 0, "s1", models.ScopeUser, "s2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service(tt.boost).Retrieve(ctx, models.QueryRequest{
+				UserID:    "alice",
+				Query:     "alice trip plans",
+				SessionID: tt.sessionID,
+				Scope:     tt.scope,
+			}, false)
+			if err != nil {
+				t.Fatalf("Retrieve: %v", err)
+			}
+			if len(got) != 1 || got[0].Episode.SessionID != tt.want {
+				t.Fatalf("results = %+v, want one episode from %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package segmentation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/llm"
+	"github.com/memora/cma/internal/models"
+	"github.com/memora/cma/pkg"
+)
+
+// DriftSegmenter places event boundaries where the topic drifts, using only
+// sentence embeddings, so it works with providers that expose no logprobs.
+//
+// Between sentences i-1 and i it compares the w sentences on either side:
+//
+//	D_i = 1 - cos(E(s_{i-w} … s_{i-1}), E(s_i … s_{i+w-1}))
+//
+// and cuts when D_i > μ + γσ over the user's recent drift values, the same
+// adaptive rule SurprisalEngine applies to token surprisal.
+type DriftSegmenter struct {
+	llmProvider llm.Provider
+	gamma       float64 // sensitivity parameter, typically ∈ [1, 2]
+	windowSize  int     // rolling stats window τ
+	minTokens   int     // minimum tokens per episode
+	maxTokens   int     // maximum tokens per episode, 0 for no limit
+	sentences   int     // sentences per side of each comparison
+
+	// Per-user rolling statistics for adaptive thresholding.
+	stats StatsStore
+}
+
+// NewDriftSegmenter creates a new embedding-drift segmentation engine.
+// Rolling statistics live in stats; nil keeps them in process memory.
+func NewDriftSegmenter(provider llm.Provider, stats StatsStore, cfg configs.SegmentationConfig) *DriftSegmenter {
+	sentences := cfg.DriftWindow
+	if sentences <= 0 {
+		sentences = 2
+	}
+	windowSize := cfg.WindowSize
+	if windowSize <= 0 {
+		windowSize = 50
+	}
+	if stats == nil {
+		stats = NewMemoryStatsStore()
+	}
+
+	return &DriftSegmenter{
+		llmProvider: provider,
+		gamma:       cfg.Gamma,
+		windowSize:  windowSize,
+		minTokens:   cfg.MinEpisodeTokens,
+		maxTokens:   cfg.MaxEpisodeTokens,
+		sentences:   sentences,
+		stats:       stats,
+	}
+}
+
+// Segment splits text at sentence boundaries with anomalous embedding drift.
+func (d *DriftSegmenter) Segment(ctx context.Context, userID string, text string) ([]models.Episode, error) {
+	sentences := sentenceSpans(text)
+	if len(sentences) < 2 {
+		return singleEpisode(ctx, d.llmProvider, StrategyEmbeddingDrift, userID, text)
+	}
+
+	// Embed the left and right window of every candidate boundary in one batch.
+	n := len(sentences)
+	windows := make([]string, 0, 2*(n-1))
+	for i := 1; i < n; i++ {
+		lo := max(0, i-d.sentences)
+		hi := min(n, i+d.sentences)
+		windows = append(windows,
+			text[sentences[lo].start:sentences[i-1].end],
+			text[sentences[i].start:sentences[hi-1].end],
+		)
+	}
+	vecs, err := d.llmProvider.EmbedBatch(ctx, windows)
+	if err != nil {
+		return nil, fmt.Errorf("drift embed: %w", err)
+	}
+	if len(vecs) != len(windows) {
+		return nil, fmt.Errorf("drift embed: got %d embeddings for %d windows", len(vecs), len(windows))
+	}
+
+	// Load the user's rolling stats; new values are persisted on success.
+	key := statsKey(StrategyEmbeddingDrift, userID)
+	stats := loadStats(ctx, d.stats, key, d.windowSize)
+
+	var episodes []models.Episode
+	spanStart := 0 // byte offset where the current episode begins
+	tokenCount := d.llmProvider.CountTokens(text[sentences[0].start:sentences[0].end])
+	maxDrift := 0.0
+
+	for i := 1; i < n; i++ {
+		drift := 1 - pkg.CosineSimilarity(vecs[2*(i-1)], vecs[2*(i-1)+1])
+
+		// Update rolling statistics, then check D > μ + γσ.
+		stats.update(drift)
+		isBoundary := drift > stats.threshold(d.gamma) && tokenCount >= d.minTokens
+
+		// Force a boundary at the max token limit.
+		if d.maxTokens > 0 && tokenCount >= d.maxTokens {
+			isBoundary = true
+		}
+
+		if isBoundary {
+			ep, err := spanEpisode(ctx, d.llmProvider, StrategyEmbeddingDrift, userID, text, spanStart, sentences[i].start, maxDrift)
+			if err != nil {
+				return nil, err
+			}
+			episodes = append(episodes, *ep)
+
+			spanStart = sentences[i].start
+			tokenCount = 0
+			maxDrift = 0
+		}
+
+		tokenCount += d.llmProvider.CountTokens(text[sentences[i].start:sentences[i].end])
+		if drift > maxDrift {
+			maxDrift = drift
+		}
+	}
+
+	ep, err := spanEpisode(ctx, d.llmProvider, StrategyEmbeddingDrift, userID, text, spanStart, len(text), maxDrift)
+	if err != nil {
+		return nil, err
+	}
+	episodes = append(episodes, *ep)
+
+	saveStats(ctx, d.stats, key, stats)
+
+	return episodes, nil
+}
+
+// BoundaryStats returns the user's current drift threshold.
+func (d *DriftSegmenter) BoundaryStats(ctx context.Context, userID string) (*BoundaryStats, error) {
+	return boundaryStats(ctx, d.stats, StrategyEmbeddingDrift, userID, d.windowSize, d.gamma)
+}
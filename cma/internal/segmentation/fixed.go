@@ -0,0 +1,60 @@
+package segmentation
+
+import (
+	"context"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/llm"
+	"github.com/memora/cma/internal/models"
+)
+
+// FixedWindowSegmenter cuts text every window words, regardless of content.
+// It costs one embedding per episode and no model scoring, and serves as a
+// baseline for the adaptive strategies. It keeps no rolling statistics.
+type FixedWindowSegmenter struct {
+	llmProvider llm.Provider
+	window      int // words per episode
+}
+
+// NewFixedWindowSegmenter creates a new fixed-window segmenter.
+func NewFixedWindowSegmenter(provider llm.Provider, cfg configs.SegmentationConfig) *FixedWindowSegmenter {
+	window := cfg.FixedWindowWords
+	if window <= 0 {
+		window = cfg.MaxEpisodeTokens
+	}
+	if window <= 0 {
+		window = 200
+	}
+
+	return &FixedWindowSegmenter{
+		llmProvider: provider,
+		window:      window,
+	}
+}
+
+// Segment splits text into consecutive windows of at most window words.
+func (f *FixedWindowSegmenter) Segment(ctx context.Context, userID string, text string) ([]models.Episode, error) {
+	words := wordSpans(text)
+	if len(words) <= f.window {
+		return singleEpisode(ctx, f.llmProvider, StrategyFixedWindow, userID, text)
+	}
+
+	var episodes []models.Episode
+	for i := 0; i < len(words); i += f.window {
+		start, end := 0, len(text)
+		if i > 0 {
+			start = words[i].start
+		}
+		if next := i + f.window; next < len(words) {
+			end = words[next].start
+		}
+
+		ep, err := spanEpisode(ctx, f.llmProvider, StrategyFixedWindow, userID, text, start, end, 1.0)
+		if err != nil {
+			return nil, err
+		}
+		episodes = append(episodes, *ep)
+	}
+
+	return episodes, nil
+}
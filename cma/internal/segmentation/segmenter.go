@@ -0,0 +1,204 @@
+package segmentation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/llm"
+	"github.com/memora/cma/internal/models"
+)
+
+// Segmenter splits an incoming message into episodic fragments.
+//
+// Every episode's Content is an exact substring of the message, located by
+// the span metadata, and records the strategy that produced it.
+type Segmenter interface {
+	Segment(ctx context.Context, userID string, text string) ([]models.Episode, error)
+}
+
+// Segmentation strategies selectable in SegmentationConfig.
+const (
+	StrategySurprisal      = "surprisal"       // LLM token surprisal, see SurprisalEngine
+	StrategyEmbeddingDrift = "embedding_drift" // sentence embedding drift, see DriftSegmenter
+	StrategyFixedWindow    = "fixed_window"    // fixed word windows, see FixedWindowSegmenter
+)
+
+// New creates the Segmenter configured by cfg: cfg.Strategy for all users,
+// except those listed in cfg.TenantStrategies. Adaptive strategies keep
+// their rolling statistics in stats; nil keeps them in process memory.
+func New(provider llm.Provider, stats StatsStore, cfg configs.SegmentationConfig) (Segmenter, error) {
+	if stats == nil {
+		stats = NewMemoryStatsStore()
+	}
+
+	def, err := newStrategy(cfg.Strategy, provider, stats, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.TenantStrategies) == 0 {
+		return def, nil
+	}
+
+	// Tenants sharing a strategy share its instance and rolling statistics.
+	byName := map[string]Segmenter{strategyName(cfg.Strategy): def}
+	router := &tenantRouter{def: def, tenants: make(map[string]Segmenter, len(cfg.TenantStrategies))}
+	for tenant, name := range cfg.TenantStrategies {
+		seg, ok := byName[strategyName(name)]
+		if !ok {
+			seg, err = newStrategy(name, provider, stats, cfg)
+			if err != nil {
+				return nil, fmt.Errorf("segmentation tenant %q: %w", tenant, err)
+			}
+			byName[strategyName(name)] = seg
+		}
+		router.tenants[tenant] = seg
+	}
+
+	return router, nil
+}
+
+func newStrategy(name string, provider llm.Provider, stats StatsStore, cfg configs.SegmentationConfig) (Segmenter, error) {
+	switch strategyName(name) {
+	case StrategySurprisal:
+		return NewSurprisalEngine(provider, stats, cfg), nil
+	case StrategyEmbeddingDrift:
+		return NewDriftSegmenter(provider, stats, cfg), nil
+	case StrategyFixedWindow:
+		return NewFixedWindowSegmenter(provider, cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown segmentation strategy %q", name)
+	}
+}
+
+func strategyName(name string) string {
+	if name == "" {
+		return StrategySurprisal
+	}
+	return name
+}
+
+// tenantRouter dispatches each user to its configured strategy.
+type tenantRouter struct {
+	def     Segmenter
+	tenants map[string]Segmenter // by user_id
+}
+
+func (r *tenantRouter) Segment(ctx context.Context, userID string, text string) ([]models.Episode, error) {
+	if seg, ok := r.tenants[userID]; ok {
+		return seg.Segment(ctx, userID, text)
+	}
+	return r.def.Segment(ctx, userID, text)
+}
+
+func (r *tenantRouter) BoundaryStats(ctx context.Context, userID string) (*BoundaryStats, error) {
+	seg, ok := r.tenants[userID]
+	if !ok {
+		seg = r.def
+	}
+	if reporter, ok := seg.(StatsReporter); ok {
+		return reporter.BoundaryStats(ctx, userID)
+	}
+	return nil, nil
+}
+
+// --- Helpers ---
+
+// span is a half-open byte range [start, end) of the input text.
+type span struct {
+	start, end int
+}
+
+// spanEpisode builds an episode whose content is text[start:end] without
+// surrounding whitespace, recording that exact byte span and the producing
+// strategy in its metadata.
+func spanEpisode(ctx context.Context, provider llm.Provider, strategy, userID, text string, start, end int, surprisal float64) (*models.Episode, error) {
+	segment := text[start:end]
+	start += len(segment) - len(strings.TrimLeftFunc(segment, unicode.IsSpace))
+	end -= len(segment) - len(strings.TrimRightFunc(segment, unicode.IsSpace))
+	if end < start {
+		end = start
+	}
+	content := text[start:end]
+
+	embedding, err := provider.Embed(ctx, content)
+	if err != nil {
+		return nil, err
+	}
+
+	ep := models.NewEpisode(userID, content, embedding, surprisal)
+	ep.TokenCount = provider.CountTokens(content)
+	ep.Metadata[models.MetaSegmenter] = strategy
+	ep.Metadata[models.MetaSpanStart] = start
+	ep.Metadata[models.MetaSpanEnd] = end
+	return ep, nil
+}
+
+// singleEpisode treats the entire input as one episode (fallback).
+func singleEpisode(ctx context.Context, provider llm.Provider, strategy, userID, text string) ([]models.Episode, error) {
+	ep, err := spanEpisode(ctx, provider, strategy, userID, text, 0, len(text), 1.0)
+	if err != nil {
+		return nil, err
+	}
+	return []models.Episode{*ep}, nil
+}
+
+// wordSpans returns the whitespace-separated words of text.
+func wordSpans(text string) []span {
+	var spans []span
+	start := -1
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				spans = append(spans, span{start, i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, span{start, len(text)})
+	}
+	return spans
+}
+
+// sentenceSpans returns the sentences of text, split after terminal
+// punctuation followed by whitespace and at line breaks.
+func sentenceSpans(text string) []span {
+	var spans []span
+	start := -1
+	emit := func(end int) {
+		end = start + len(strings.TrimRightFunc(text[start:end], unicode.IsSpace))
+		spans = append(spans, span{start, end})
+		start = -1
+	}
+
+	for i, r := range text {
+		if start < 0 {
+			if !unicode.IsSpace(r) {
+				start = i
+			}
+			continue
+		}
+
+		switch r {
+		case '\n':
+			emit(i)
+		case '.', '!', '?':
+			next := i + utf8.RuneLen(r)
+			if next == len(text) {
+				emit(next)
+			} else if nr, _ := utf8.DecodeRuneInString(text[next:]); unicode.IsSpace(nr) {
+				emit(next)
+			}
+		}
+	}
+	if start >= 0 {
+		emit(len(text))
+	}
+	return spans
+}
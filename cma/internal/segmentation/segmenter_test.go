@@ -0,0 +1,117 @@
+package segmentation
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/llm"
+	"github.com/memora/cma/internal/models"
+)
+
+func TestSentenceSpans(t *testing.T) {
+	text := "  Hi there. Version 1.5 works!\nNo period here  \n\nWhat?"
+
+	var got []string
+	for _, sp := range sentenceSpans(text) {
+		got = append(got, text[sp.start:sp.end])
+	}
+
+	want := []string{"Hi there.", "Version 1.5 works!", "No period here", "What?"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("sentences = %q, want %q", got, want)
+	}
+}
+
+func TestSegmenters(t *testing.T) {
+	text := "Alice likes green tea. Alice drinks green tea daily. Alice brews green tea often. " +
+		"Rockets launch from Florida. Rockets need fuel."
+
+	tests := []struct {
+		name     string
+		cfg      configs.SegmentationConfig
+		want     []string
+		strategy string
+	}{
+		{
+			name:     "embedding drift cuts at the topic change",
+			cfg:      configs.SegmentationConfig{Strategy: StrategyEmbeddingDrift, Gamma: 1, DriftWindow: 1},
+			want:     []string{"Alice likes green tea. Alice drinks green tea daily. Alice brews green tea often.", "Rockets launch from Florida. Rockets need fuel."},
+			strategy: StrategyEmbeddingDrift,
+		},
+		{
+			name:     "embedding drift respects max tokens",
+			cfg:      configs.SegmentationConfig{Strategy: StrategyEmbeddingDrift, Gamma: 100, MaxEpisodeTokens: 10},
+			want:     []string{"Alice likes green tea. Alice drinks green tea daily.", "Alice brews green tea often. Rockets launch from Florida.", "Rockets need fuel."},
+			strategy: StrategyEmbeddingDrift,
+		},
+		{
+			name:     "fixed window cuts every n words",
+			cfg:      configs.SegmentationConfig{Strategy: StrategyFixedWindow, FixedWindowWords: 8},
+			want:     []string{"Alice likes green tea. Alice drinks green tea", "daily. Alice brews green tea often. Rockets launch", "from Florida. Rockets need fuel."},
+			strategy: StrategyFixedWindow,
+		},
+		{
+			name:     "fixed window keeps short input whole",
+			cfg:      configs.SegmentationConfig{Strategy: StrategyFixedWindow},
+			want:     []string{text},
+			strategy: StrategyFixedWindow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seg, err := New(llm.NewFakeProvider(256), nil, tt.cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			episodes, err := seg.Segment(context.Background(), "alice", text)
+			if err != nil {
+				t.Fatalf("Segment: %v", err)
+			}
+
+			var got []string
+			for _, ep := range episodes {
+				got = append(got, ep.Content)
+				if ep.Metadata[models.MetaSegmenter] != tt.strategy {
+					t.Errorf("episode %q produced by %v, want %s", ep.Content, ep.Metadata[models.MetaSegmenter], tt.strategy)
+				}
+				start, end := ep.Metadata[models.MetaSpanStart].(int), ep.Metadata[models.MetaSpanEnd].(int)
+				if text[start:end] != ep.Content {
+					t.Errorf("span [%d:%d] = %q, content %q", start, end, text[start:end], ep.Content)
+				}
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("episodes = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRoutesTenants(t *testing.T) {
+	seg, err := New(llm.NewFakeProvider(16), nil, configs.SegmentationConfig{
+		TenantStrategies: map[string]string{"bob": StrategyFixedWindow},
+		MaxEpisodeTokens: 100,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	for user, want := range map[string]string{"alice": StrategySurprisal, "bob": StrategyFixedWindow} {
+		episodes, err := seg.Segment(context.Background(), user, "Hello there, friend.")
+		if err != nil {
+			t.Fatalf("Segment(%s): %v", user, err)
+		}
+		if got := episodes[0].Metadata[models.MetaSegmenter]; got != want {
+			t.Errorf("%s segmented by %v, want %s", user, got, want)
+		}
+	}
+
+	if _, err := New(llm.NewFakeProvider(16), nil, configs.SegmentationConfig{
+		TenantStrategies: map[string]string{"bob": "bogus"},
+	}); err == nil {
+		t.Error("unknown tenant strategy should fail")
+	}
+}
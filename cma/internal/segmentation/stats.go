@@ -0,0 +1,215 @@
+package segmentation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/memora/cma/configs"
+)
+
+// StatsStore persists each user's rolling window of boundary signal values
+// (token surprisal, embedding drift), so every replica and restart derives
+// the same μ, σ and threshold.
+//
+// A segmentation run loads the window once, updates it locally token by
+// token, and appends what it observed in one atomic call. Concurrent runs
+// for the same user never lose each other's values.
+type StatsStore interface {
+	// Window returns the most recent values under key, oldest first.
+	Window(ctx context.Context, key string) ([]float64, error)
+
+	// Append atomically adds values under key, keeping only the last size.
+	Append(ctx context.Context, key string, values []float64, size int) error
+}
+
+// BoundaryStats is a snapshot of a user's adaptive boundary threshold.
+type BoundaryStats struct {
+	Strategy  string  `json:"strategy"`
+	Samples   int     `json:"samples"`
+	Mu        float64 `json:"mu"`
+	Sigma     float64 `json:"sigma"`
+	Gamma     float64 `json:"gamma"`
+	Threshold float64 `json:"threshold"` // μ + γσ
+}
+
+// StatsReporter is implemented by segmenters with adaptive thresholds.
+type StatsReporter interface {
+	// BoundaryStats returns the user's current statistics, or nil if the
+	// user's strategy has no adaptive threshold.
+	BoundaryStats(ctx context.Context, userID string) (*BoundaryStats, error)
+}
+
+// NewStatsStore creates the stats store selected by cfg.StatsBackend:
+// "redis" (the configs default), which requires client, or "memory". An
+// empty backend, left by configs not read through configs.Load, is "memory".
+func NewStatsStore(cfg configs.SegmentationConfig, client *redis.Client) (StatsStore, error) {
+	switch cfg.StatsBackend {
+	case "", "memory":
+		return NewMemoryStatsStore(), nil
+	case "redis":
+		if client == nil {
+			return nil, fmt.Errorf("redis stats store: no redis client")
+		}
+		return NewRedisStatsStore(client, cfg.StatsTTL), nil
+	default:
+		return nil, fmt.Errorf("unknown segmentation stats backend %q", cfg.StatsBackend)
+	}
+}
+
+// statsKey scopes a rolling window to a strategy and user.
+func statsKey(strategy, userID string) string {
+	return strategy + ":" + userID
+}
+
+// loadStats seeds a rolling window from the store. A store failure starts
+// the window cold rather than failing the ingest.
+func loadStats(ctx context.Context, store StatsStore, key string, windowSize int) *rollingStats {
+	r := newRollingStats(windowSize)
+
+	values, err := store.Window(ctx, key)
+	if err != nil {
+		slog.Warn("segmentation stats unavailable, starting cold", "key", key, "error", err)
+	}
+	for _, v := range values {
+		r.update(v)
+	}
+	r.pending = nil
+
+	return r
+}
+
+// saveStats persists the values r observed since loadStats.
+func saveStats(ctx context.Context, store StatsStore, key string, r *rollingStats) {
+	if err := store.Append(ctx, key, r.pending, r.size); err != nil {
+		slog.Warn("segmentation stats not persisted", "key", key, "error", err)
+	}
+	r.pending = nil
+}
+
+// boundaryStats reports the threshold the next segmentation run starts from.
+func boundaryStats(ctx context.Context, store StatsStore, strategy, userID string, windowSize int, gamma float64) (*BoundaryStats, error) {
+	values, err := store.Window(ctx, statsKey(strategy, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	r := newRollingStats(windowSize)
+	for _, v := range values {
+		r.update(v)
+	}
+	n := len(values)
+	if n > windowSize {
+		n = windowSize
+	}
+
+	return &BoundaryStats{
+		Strategy:  strategy,
+		Samples:   n,
+		Mu:        r.mu,
+		Sigma:     r.sigma,
+		Gamma:     gamma,
+		Threshold: r.threshold(gamma),
+	}, nil
+}
+
+// --- Redis ---
+
+// RedisStatsStore keeps each window in a Redis list that expires once its
+// user has been idle for ttl.
+type RedisStatsStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisStatsStore creates a Redis-backed stats store. A zero ttl
+// defaults to 30 days.
+func NewRedisStatsStore(client *redis.Client, ttl time.Duration) *RedisStatsStore {
+	if ttl <= 0 {
+		ttl = 30 * 24 * time.Hour
+	}
+	return &RedisStatsStore{client: client, ttl: ttl}
+}
+
+func (r *RedisStatsStore) redisKey(key string) string {
+	return "cma:segmentation:stats:" + key
+}
+
+// Window returns the stored window.
+func (r *RedisStatsStore) Window(ctx context.Context, key string) ([]float64, error) {
+	raw, err := r.client.LRange(ctx, r.redisKey(key), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis stats window: %w", err)
+	}
+
+	values := make([]float64, 0, len(raw))
+	for _, s := range raw {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis stats window: %w", err)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// Append pushes values, trims the list and refreshes its TTL in one
+// MULTI/EXEC transaction.
+func (r *RedisStatsStore) Append(ctx context.Context, key string, values []float64, size int) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	args := make([]any, len(values))
+	for i, v := range values {
+		args[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+
+	k := r.redisKey(key)
+	pipe := r.client.TxPipeline()
+	pipe.RPush(ctx, k, args...)
+	pipe.LTrim(ctx, k, int64(-size), -1)
+	pipe.Expire(ctx, k, r.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis stats append: %w", err)
+	}
+	return nil
+}
+
+// --- In-memory ---
+
+// MemoryStatsStore keeps windows in process memory (tests, single node).
+type MemoryStatsStore struct {
+	mu      sync.Mutex
+	windows map[string][]float64
+}
+
+// NewMemoryStatsStore creates an empty in-memory stats store.
+func NewMemoryStatsStore() *MemoryStatsStore {
+	return &MemoryStatsStore{windows: make(map[string][]float64)}
+}
+
+// Window returns a copy of the stored window.
+func (m *MemoryStatsStore) Window(ctx context.Context, key string) ([]float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]float64(nil), m.windows[key]...), nil
+}
+
+// Append adds values and drops all but the last size.
+func (m *MemoryStatsStore) Append(ctx context.Context, key string, values []float64, size int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w := append(m.windows[key], values...)
+	if len(w) > size {
+		w = append([]float64(nil), w[len(w)-size:]...)
+	}
+	m.windows[key] = w
+	return nil
+}
@@ -0,0 +1,57 @@
+package segmentation
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/llm"
+)
+
+func TestStatsSharedAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	cfg := configs.SegmentationConfig{Gamma: 1.5, WindowSize: 4, MaxEpisodeTokens: 100}
+
+	provider := llm.NewFakeProvider(8)
+	provider.TokenProbs["a b"] = []llm.TokenProb{{Token: "a", LogProb: -1, Offset: 0}, {Token: "b", LogProb: -3, Offset: 2}}
+	provider.TokenProbs["c d e"] = []llm.TokenProb{
+		{Token: "c", LogProb: -2, Offset: 0}, {Token: "d", LogProb: -2, Offset: 2}, {Token: "e", LogProb: -2, Offset: 4},
+	}
+
+	// Two engines over one store stand in for two replicas.
+	store := NewMemoryStatsStore()
+	replicaA := NewSurprisalEngine(provider, store, cfg)
+	replicaB := NewSurprisalEngine(provider, store, cfg)
+
+	if _, err := replicaA.Segment(ctx, "alice", "a b"); err != nil {
+		t.Fatalf("Segment: %v", err)
+	}
+
+	got, err := replicaB.BoundaryStats(ctx, "alice")
+	if err != nil {
+		t.Fatalf("BoundaryStats: %v", err)
+	}
+	want := BoundaryStats{Strategy: StrategySurprisal, Samples: 2, Mu: 2, Sigma: 1, Gamma: 1.5, Threshold: 3.5}
+	if *got != want {
+		t.Errorf("stats = %+v, want %+v", *got, want)
+	}
+
+	// The window keeps only the last WindowSize values: 3, 2, 2, 2.
+	if _, err := replicaB.Segment(ctx, "alice", "c d e"); err != nil {
+		t.Fatalf("Segment: %v", err)
+	}
+	got, _ = replicaA.BoundaryStats(ctx, "alice")
+	if got.Samples != 4 || math.Abs(got.Mu-2.25) > 1e-9 {
+		t.Errorf("stats after trim = %+v, want 4 samples with mu 2.25", *got)
+	}
+
+	// Other users and strategies keep separate windows.
+	if got, _ := replicaA.BoundaryStats(ctx, "bob"); got.Samples != 0 {
+		t.Errorf("bob has %d samples, want 0", got.Samples)
+	}
+	drift := NewDriftSegmenter(provider, store, cfg)
+	if got, _ := drift.BoundaryStats(ctx, "alice"); got.Samples != 0 {
+		t.Errorf("drift window has %d samples, want 0", got.Samples)
+	}
+}
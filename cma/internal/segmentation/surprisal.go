@@ -4,7 +4,6 @@ import (
 	"context"
 	"math"
 	"strings"
-	"sync"
 
 	"github.com/memora/cma/configs"
 	"github.com/memora/cma/internal/llm"
@@ -31,19 +30,20 @@ type SurprisalEngine struct {
 	maxTokens   int     // maximum tokens per episode
 
 	// Per-user rolling statistics for adaptive thresholding.
-	mu    sync.Map // map[userID]*rollingStats
+	stats StatsStore
 }
 
 // rollingStats maintains a sliding window of surprisal values for
-// computing dynamic thresholds per user.
+// computing dynamic thresholds per user. Each segmentation run loads its
+// own, so it is never shared between goroutines.
 type rollingStats struct {
-	values []float64
-	mu     float64
-	sigma  float64
-	idx    int
-	full   bool
-	size   int
-	lock   sync.Mutex
+	values  []float64
+	mu      float64
+	sigma   float64
+	idx     int
+	full    bool
+	size    int
+	pending []float64 // values added since loading, not yet persisted
 }
 
 func newRollingStats(windowSize int) *rollingStats {
@@ -55,10 +55,8 @@ func newRollingStats(windowSize int) *rollingStats {
 
 // update adds a new surprisal value and recomputes rolling μ and σ.
 func (r *rollingStats) update(s float64) {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-
 	r.values[r.idx] = s
+	r.pending = append(r.pending, s)
 	r.idx = (r.idx + 1) % r.size
 	if r.idx == 0 {
 		r.full = true
@@ -90,52 +88,66 @@ func (r *rollingStats) update(s float64) {
 
 // threshold returns the current boundary threshold: μ + γσ.
 func (r *rollingStats) threshold(gamma float64) float64 {
-	r.lock.Lock()
-	defer r.lock.Unlock()
 	return r.mu + gamma*r.sigma
 }
 
 func (r *rollingStats) mean() float64 {
-	r.lock.Lock()
-	defer r.lock.Unlock()
 	return r.mu
 }
 
-// NewSurprisalEngine creates a new event segmentation engine.
-func NewSurprisalEngine(provider llm.Provider, cfg configs.SegmentationConfig) *SurprisalEngine {
+// NewSurprisalEngine creates a new event segmentation engine. Rolling
+// statistics live in stats; nil keeps them in process memory.
+func NewSurprisalEngine(provider llm.Provider, stats StatsStore, cfg configs.SegmentationConfig) *SurprisalEngine {
+	windowSize := cfg.WindowSize
+	if windowSize <= 0 {
+		windowSize = 50
+	}
+	if stats == nil {
+		stats = NewMemoryStatsStore()
+	}
+
 	return &SurprisalEngine{
 		llmProvider: provider,
 		gamma:       cfg.Gamma,
-		windowSize:  cfg.WindowSize,
+		windowSize:  windowSize,
 		minTokens:   cfg.MinEpisodeTokens,
 		maxTokens:   cfg.MaxEpisodeTokens,
+		stats:       stats,
 	}
 }
 
 // Segment processes raw text input and segments it into episodic fragments
 // based on surprisal-driven event boundaries.
 func (s *SurprisalEngine) Segment(ctx context.Context, userID string, text string) ([]models.Episode, error) {
-	// Get or create per-user rolling stats.
-	statsIface, _ := s.mu.LoadOrStore(userID, newRollingStats(s.windowSize))
-	stats := statsIface.(*rollingStats)
-
 	// Get token-level log probabilities from the LLM.
 	tokenProbs, err := s.llmProvider.GetTokenProbabilities(ctx, text)
 	if err != nil {
 		// Fallback: treat entire text as single episode.
-		return s.singleEpisode(ctx, userID, text)
+		return singleEpisode(ctx, s.llmProvider, StrategySurprisal, userID, text)
 	}
 
 	if len(tokenProbs) == 0 {
-		return s.singleEpisode(ctx, userID, text)
+		return singleEpisode(ctx, s.llmProvider, StrategySurprisal, userID, text)
 	}
 
+	// Episodes are sliced from text by byte offset, never rebuilt from
+	// token strings, so they need offsets that index into text.
+	tokenProbs, ok := alignOffsets(text, tokenProbs)
+	if !ok {
+		return singleEpisode(ctx, s.llmProvider, StrategySurprisal, userID, text)
+	}
+
+	// Load the user's rolling stats; new values are persisted on success.
+	key := statsKey(StrategySurprisal, userID)
+	stats := loadStats(ctx, s.stats, key, s.windowSize)
+
 	// Compute surprisal for each token and detect boundaries.
 	var episodes []models.Episode
-	var currentTokens []string
 	var maxSurprisal float64
 	var totalSurprisal float64
 	tokenCount := 0
+	spanStart := 0 // byte offset where the current episode begins
+	prevToken := ""
 
 	for _, tp := range tokenProbs {
 		// Surprisal(x_t) = -log P(x_t | x_<t)
@@ -152,10 +164,11 @@ func (s *SurprisalEngine) Segment(ctx context.Context, userID string, text strin
 		isBoundary := surprisal > threshold && tokenCount >= s.minTokens
 
 		// ADDED: Only allow boundaries at sentence endings to prevent fragmentation
-		// Check if current token is a sentence-ending punctuation
-		isSentenceEnd := strings.HasSuffix(strings.TrimSpace(tp.Token), ".") ||
-			strings.HasSuffix(strings.TrimSpace(tp.Token), "!") ||
-			strings.HasSuffix(strings.TrimSpace(tp.Token), "?")
+		// Check if the previous token closed a sentence, so the episode
+		// ends with it and this token opens the next one
+		isSentenceEnd := strings.HasSuffix(strings.TrimSpace(prevToken), ".") ||
+			strings.HasSuffix(strings.TrimSpace(prevToken), "!") ||
+			strings.HasSuffix(strings.TrimSpace(prevToken), "?")
 
 		// Override: only create boundary if at sentence end
 		if isBoundary && !isSentenceEnd {
@@ -167,25 +180,24 @@ func (s *SurprisalEngine) Segment(ctx context.Context, userID string, text strin
 			isBoundary = true
 		}
 
-		if isBoundary && len(currentTokens) > 0 {
-			// Emit episode.
-			content := strings.Join(currentTokens, " ")
+		// Whitespace-only spans are carried into the next episode.
+		if isBoundary && tokenCount > 0 && strings.TrimSpace(text[spanStart:tp.Offset]) != "" {
+			// Emit episode: everything from spanStart up to this token.
 			avgSurprisal := totalSurprisal / float64(tokenCount)
-			ep, err := s.createEpisode(ctx, userID, content, math.Max(avgSurprisal, maxSurprisal))
+			ep, err := spanEpisode(ctx, s.llmProvider, StrategySurprisal, userID, text, spanStart, tp.Offset, math.Max(avgSurprisal, maxSurprisal))
 			if err != nil {
 				return nil, err
 			}
-			ep.TokenCount = tokenCount
 			episodes = append(episodes, *ep)
 
 			// Reset accumulator.
-			currentTokens = nil
+			spanStart = tp.Offset
 			maxSurprisal = 0
 			totalSurprisal = 0
 			tokenCount = 0
 		}
 
-		currentTokens = append(currentTokens, tp.Token)
+		prevToken = tp.Token
 		totalSurprisal += surprisal
 		if surprisal > maxSurprisal {
 			maxSurprisal = surprisal
@@ -194,40 +206,54 @@ func (s *SurprisalEngine) Segment(ctx context.Context, userID string, text strin
 	}
 
 	// Emit final episode if there are remaining tokens.
-	if len(currentTokens) > 0 {
-		content := strings.Join(currentTokens, " ")
-		avgSurprisal := 0.0
-		if tokenCount > 0 {
-			avgSurprisal = totalSurprisal / float64(tokenCount)
-		}
-		ep, err := s.createEpisode(ctx, userID, content, math.Max(avgSurprisal, maxSurprisal))
+	if tokenCount > 0 {
+		avgSurprisal := totalSurprisal / float64(tokenCount)
+		ep, err := spanEpisode(ctx, s.llmProvider, StrategySurprisal, userID, text, spanStart, len(text), math.Max(avgSurprisal, maxSurprisal))
 		if err != nil {
 			return nil, err
 		}
-		ep.TokenCount = tokenCount
 		episodes = append(episodes, *ep)
 	}
 
+	saveStats(ctx, s.stats, key, stats)
+
 	return episodes, nil
 }
 
-// createEpisode builds an Episode with embedding.
-func (s *SurprisalEngine) createEpisode(ctx context.Context, userID string, content string, surprisal float64) (*models.Episode, error) {
-	embedding, err := s.llmProvider.Embed(ctx, content)
-	if err != nil {
-		return nil, err
-	}
-
-	ep := models.NewEpisode(userID, content, embedding, surprisal)
-	ep.TokenCount = s.llmProvider.CountTokens(content)
-	return ep, nil
+// BoundaryStats returns the user's current surprisal threshold.
+func (s *SurprisalEngine) BoundaryStats(ctx context.Context, userID string) (*BoundaryStats, error) {
+	return boundaryStats(ctx, s.stats, StrategySurprisal, userID, s.windowSize, s.gamma)
 }
 
-// singleEpisode treats the entire input as one episode (fallback).
-func (s *SurprisalEngine) singleEpisode(ctx context.Context, userID string, text string) ([]models.Episode, error) {
-	ep, err := s.createEpisode(ctx, userID, text, 1.0)
-	if err != nil {
-		return nil, err
+// alignOffsets returns probs with Offset as non-decreasing byte offsets
+// into text. Offsets that are out of order or do not point at their token
+// are recomputed by locating each token in text; ok is false if a token
+// cannot be found.
+func alignOffsets(text string, probs []llm.TokenProb) ([]llm.TokenProb, bool) {
+	prev := 0
+	valid := true
+	for _, tp := range probs {
+		if tp.Offset < prev || tp.Offset > len(text) || !strings.HasPrefix(text[tp.Offset:], tp.Token) {
+			valid = false
+			break
+		}
+		prev = tp.Offset
+	}
+	if valid {
+		return probs, true
+	}
+
+	aligned := make([]llm.TokenProb, len(probs))
+	cursor := 0
+	for i, tp := range probs {
+		tok := strings.TrimSpace(tp.Token)
+		idx := strings.Index(text[cursor:], tok)
+		if idx < 0 {
+			return nil, false
+		}
+		aligned[i] = tp
+		aligned[i].Offset = cursor + idx
+		cursor += idx + len(tok)
 	}
-	return []models.Episode{*ep}, nil
+	return aligned, true
 }
@@ -0,0 +1,221 @@
+package segmentation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/llm"
+	"github.com/memora/cma/internal/models"
+)
+
+// flatProbs returns n space-separated tokens with the given log probability.
+// Tokens whose index is in sentenceEnds end with a period.
+func flatProbs(n int, logProb float64, sentenceEnds ...int) []llm.TokenProb {
+	ends := make(map[int]bool)
+	for _, i := range sentenceEnds {
+		ends[i] = true
+	}
+
+	probs := make([]llm.TokenProb, n)
+	for i := range probs {
+		tok := "word"
+		if ends[i] {
+			tok = "end."
+		}
+		probs[i] = llm.TokenProb{Token: tok, LogProb: logProb, Offset: 5 * i}
+	}
+	return probs
+}
+
+// textOf rebuilds the text that probs were scored on.
+func textOf(probs []llm.TokenProb) string {
+	tokens := make([]string, len(probs))
+	for i, tp := range probs {
+		tokens[i] = tp.Token
+	}
+	return strings.Join(tokens, " ")
+}
+
+func TestSurprisalEngineSegment(t *testing.T) {
+	cfg := configs.SegmentationConfig{
+		Gamma:            1.5,
+		WindowSize:       50,
+		MinEpisodeTokens: 5,
+		MaxEpisodeTokens: 100,
+	}
+
+	tests := []struct {
+		name         string
+		probs        []llm.TokenProb
+		tokenErr     error
+		wantEpisodes int
+		wantTokens   []int
+	}{
+		{
+			name:         "flat surprisal yields one episode",
+			probs:        flatProbs(20, -1),
+			wantEpisodes: 1,
+			wantTokens:   []int{20},
+		},
+		{
+			name: "spike after sentence end splits",
+			probs: func() []llm.TokenProb {
+				p := flatProbs(20, -1, 9)
+				p[10].LogProb = -12
+				return p
+			}(),
+			wantEpisodes: 2,
+			wantTokens:   []int{10, 10},
+		},
+		{
+			name: "spike mid-sentence does not split",
+			probs: func() []llm.TokenProb {
+				p := flatProbs(20, -1)
+				p[10].LogProb = -12
+				return p
+			}(),
+			wantEpisodes: 1,
+			wantTokens:   []int{20},
+		},
+		{
+			name: "spike before min tokens does not split",
+			probs: func() []llm.TokenProb {
+				p := flatProbs(20, -1, 2)
+				p[3].LogProb = -12
+				return p
+			}(),
+			wantEpisodes: 1,
+			wantTokens:   []int{20},
+		},
+		{
+			name:         "max tokens forces a boundary",
+			probs:        flatProbs(250, -1),
+			wantEpisodes: 3,
+			wantTokens:   []int{100, 100, 50},
+		},
+		{
+			name:         "provider error falls back to a single episode",
+			tokenErr:     errors.New("logprobs unavailable"),
+			wantEpisodes: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := llm.NewFakeProvider(16)
+			provider.TokenProbErr = tt.tokenErr
+
+			text := "input for " + tt.name
+			if tt.probs != nil {
+				text = textOf(tt.probs)
+				provider.TokenProbs[text] = tt.probs
+			}
+
+			engine := NewSurprisalEngine(provider, nil, cfg)
+			episodes, err := engine.Segment(context.Background(), "user-"+tt.name, text)
+			if err != nil {
+				t.Fatalf("Segment: %v", err)
+			}
+
+			if len(episodes) != tt.wantEpisodes {
+				t.Fatalf("got %d episodes, want %d", len(episodes), tt.wantEpisodes)
+			}
+			for i, want := range tt.wantTokens {
+				if got := len(strings.Fields(episodes[i].Content)); got != want {
+					t.Errorf("episode %d: got %d tokens, want %d", i, got, want)
+				}
+			}
+			for i, ep := range episodes {
+				if want := provider.CountTokens(ep.Content); ep.TokenCount != want {
+					t.Errorf("episode %d: TokenCount %d, want tokenizer count %d", i, ep.TokenCount, want)
+				}
+				if len(ep.Embedding) != 16 {
+					t.Errorf("episode %d: embedding dim %d, want 16", i, len(ep.Embedding))
+				}
+				start, _ := ep.Metadata[models.MetaSpanStart].(int)
+				end, _ := ep.Metadata[models.MetaSpanEnd].(int)
+				if text[start:end] != ep.Content {
+					t.Errorf("episode %d: span [%d:%d] = %q, content %q", i, start, end, text[start:end], ep.Content)
+				}
+			}
+		})
+	}
+}
+
+func TestSurprisalEngineSegmentPreservesText(t *testing.T) {
+	cfg := configs.SegmentationConfig{Gamma: 1.5, WindowSize: 50, MinEpisodeTokens: 2, MaxEpisodeTokens: 100}
+	text := "  Hi there,  café-goers.\nNew   topic: Paris!  "
+
+	tests := []struct {
+		name  string
+		probs []llm.TokenProb
+	}{
+		{
+			// Echo-style BPE tokens carry their own leading whitespace.
+			name: "bpe tokens",
+			probs: []llm.TokenProb{
+				{Token: "  Hi", LogProb: -1, Offset: 0},
+				{Token: " there", LogProb: -1, Offset: 4},
+				{Token: ",", LogProb: -1, Offset: 10},
+				{Token: "  café", LogProb: -1, Offset: 11},
+				{Token: "-go", LogProb: -1, Offset: 18},
+				{Token: "ers.", LogProb: -1, Offset: 21},
+				{Token: "\nNew", LogProb: -9, Offset: 25},
+				{Token: "   topic", LogProb: -1, Offset: 29},
+				{Token: ":", LogProb: -1, Offset: 37},
+				{Token: " Paris!", LogProb: -1, Offset: 38},
+				{Token: "  ", LogProb: -1, Offset: 45},
+			},
+		},
+		{
+			// Offsets that are word indices are realigned against the text.
+			name: "misaligned offsets",
+			probs: []llm.TokenProb{
+				{Token: "Hi", LogProb: -1, Offset: 0},
+				{Token: "there,", LogProb: -1, Offset: 1},
+				{Token: "café-goers.", LogProb: -1, Offset: 2},
+				{Token: "New", LogProb: -9, Offset: 3},
+				{Token: "topic:", LogProb: -1, Offset: 4},
+				{Token: "Paris!", LogProb: -1, Offset: 5},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := llm.NewFakeProvider(16)
+			provider.TokenProbs[text] = tt.probs
+
+			engine := NewSurprisalEngine(provider, nil, cfg)
+			episodes, err := engine.Segment(context.Background(), "user-"+tt.name, text)
+			if err != nil {
+				t.Fatalf("Segment: %v", err)
+			}
+
+			// The spike lands on "New", so the boundary falls after "café-goers.".
+			want := []struct {
+				content    string
+				start, end int
+			}{
+				{"Hi there,  café-goers.", 2, 25},
+				{"New   topic: Paris!", 26, 45},
+			}
+			if len(episodes) != len(want) {
+				t.Fatalf("got %d episodes %+v, want %d", len(episodes), episodes, len(want))
+			}
+			for i, w := range want {
+				ep := episodes[i]
+				if ep.Content != w.content {
+					t.Errorf("episode %d content = %q, want %q", i, ep.Content, w.content)
+				}
+				if ep.Metadata[models.MetaSpanStart] != w.start || ep.Metadata[models.MetaSpanEnd] != w.end {
+					t.Errorf("episode %d span = [%v:%v], want [%d:%d]", i,
+						ep.Metadata[models.MetaSpanStart], ep.Metadata[models.MetaSpanEnd], w.start, w.end)
+				}
+			}
+		})
+	}
+}
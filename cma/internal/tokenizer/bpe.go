@@ -0,0 +1,197 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Pre-tokenization patterns of the tiktoken encodings. RE2 has no
+// lookahead, so their trailing `\s+(?!\S)|\s+` is written `\s+` and the
+// lookahead is applied by splitText.
+var (
+	cl100kPattern = compilePattern(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+	o200kPattern = compilePattern(`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+`)
+)
+
+// compilePattern anchors expr at the start of the input and widens RE2's
+// ASCII-only \s to Unicode whitespace, as in the original patterns.
+func compilePattern(expr string) *regexp.Regexp {
+	const space = `\t\n\v\f\r \x{85}\p{Z}`
+	expr = strings.ReplaceAll(expr, `[^\s`, `[^`+space)
+	expr = strings.ReplaceAll(expr, `\s`, `[`+space+`]`)
+	return regexp.MustCompile(`^(?:` + expr + `)`)
+}
+
+// BPE is a byte-level byte-pair-encoding tokenizer over a tiktoken
+// vocabulary: text is split into pieces by the encoding's pattern, then each
+// piece's bytes are merged pairwise, lowest rank first, until no adjacent
+// pair is in the vocabulary. Special tokens are not recognised.
+type BPE struct {
+	name    string
+	ranks   map[string]int
+	tokens  map[int]string
+	pattern *regexp.Regexp
+}
+
+// NewBPE creates a tokenizer from merge ranks (token bytes → id). The
+// vocabulary must contain every single byte. Encodings named o200k* use the
+// o200k pattern, all others cl100k's.
+func NewBPE(name string, ranks map[string]int) (*BPE, error) {
+	for b := 0; b < 256; b++ {
+		if _, ok := ranks[string([]byte{byte(b)})]; !ok {
+			return nil, fmt.Errorf("tokenizer %s: vocabulary lacks byte %#x", name, b)
+		}
+	}
+
+	tokens := make(map[int]string, len(ranks))
+	for tok, id := range ranks {
+		tokens[id] = tok
+	}
+
+	pattern := cl100kPattern
+	if strings.HasPrefix(name, "o200k") {
+		pattern = o200kPattern
+	}
+	return &BPE{name: name, ranks: ranks, tokens: tokens, pattern: pattern}, nil
+}
+
+// LoadBPE reads a vocabulary in tiktoken format: one "<base64 token> <rank>"
+// per line.
+func LoadBPE(r io.Reader, name string) (*BPE, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		tok, rank, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("tokenizer %s: line %d: want \"<token> <rank>\"", name, line)
+		}
+		raw, err := base64.StdEncoding.DecodeString(tok)
+		if err != nil {
+			return nil, fmt.Errorf("tokenizer %s: line %d: %w", name, line, err)
+		}
+		id, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("tokenizer %s: line %d: %w", name, line, err)
+		}
+		ranks[string(raw)] = id
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("tokenizer %s: %w", name, err)
+	}
+	return NewBPE(name, ranks)
+}
+
+func (b *BPE) Name() string { return b.name }
+
+// Count returns the number of tokens in text.
+func (b *BPE) Count(text string) int {
+	n := 0
+	for _, piece := range b.splitText(text) {
+		if _, ok := b.ranks[piece]; ok {
+			n++
+			continue
+		}
+		n += len(b.merge(piece))
+	}
+	return n
+}
+
+// Encode returns the token IDs of text.
+func (b *BPE) Encode(text string) []int {
+	var ids []int
+	for _, piece := range b.splitText(text) {
+		if id, ok := b.ranks[piece]; ok {
+			ids = append(ids, id)
+			continue
+		}
+		for _, part := range b.merge(piece) {
+			ids = append(ids, b.ranks[part])
+		}
+	}
+	return ids
+}
+
+// Decode returns the text of ids; unknown IDs are skipped.
+func (b *BPE) Decode(ids []int) string {
+	var sb strings.Builder
+	for _, id := range ids {
+		sb.WriteString(b.tokens[id])
+	}
+	return sb.String()
+}
+
+// --- Helpers ---
+
+// splitText splits text into pre-tokenization pieces. A whitespace run
+// without line breaks followed by a non-space gives up its last character
+// to the next piece, as `\s+(?!\S)` does in the original patterns; runs
+// with line breaks were matched by `\s*[\r\n]+` and stay whole.
+func (b *BPE) splitText(text string) []string {
+	var pieces []string
+	for pos := 0; pos < len(text); {
+		loc := b.pattern.FindStringIndex(text[pos:])
+		end := pos + 1
+		if loc != nil && loc[1] > 0 {
+			end = pos + loc[1]
+		}
+
+		if end < len(text) && isSpaceRun(text[pos:end]) && !strings.ContainsAny(text[pos:end], "\r\n") {
+			next, _ := utf8.DecodeRuneInString(text[end:])
+			if !unicode.IsSpace(next) {
+				if _, size := utf8.DecodeLastRuneInString(text[pos:end]); end-size > pos {
+					end -= size
+				}
+			}
+		}
+
+		pieces = append(pieces, text[pos:end])
+		pos = end
+	}
+	return pieces
+}
+
+// merge applies byte-pair merges to piece and returns its tokens.
+func (b *BPE) merge(piece string) []string {
+	// bounds[i] is the start of the i-th part; the last entry is len(piece).
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+
+	for len(bounds) > 2 {
+		best, at := math.MaxInt, -1
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := b.ranks[piece[bounds[i]:bounds[i+2]]]; ok && rank < best {
+				best, at = rank, i
+			}
+		}
+		if at < 0 {
+			break
+		}
+		bounds = append(bounds[:at+1], bounds[at+2:]...)
+	}
+
+	parts := make([]string, len(bounds)-1)
+	for i := range parts {
+		parts[i] = piece[bounds[i]:bounds[i+1]]
+	}
+	return parts
+}
+
+// isSpaceRun reports whether s is non-empty and all whitespace.
+func isSpaceRun(s string) bool {
+	return s != "" && strings.TrimSpace(s) == ""
+}
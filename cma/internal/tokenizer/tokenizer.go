@@ -0,0 +1,113 @@
+// Package tokenizer counts model tokens for token budgets. Episode token
+// counts, knapsack weights and the tokens reported for a query all go
+// through one Tokenizer so the assembled context fits the real window.
+package tokenizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/memora/cma/configs"
+)
+
+// Tokenizer counts the tokens a model sees for a text.
+type Tokenizer interface {
+	// Name identifies the encoding, e.g. "cl100k_base".
+	Name() string
+
+	// Count returns the number of tokens in text.
+	Count(text string) int
+}
+
+// Encodings with a built-in pre-tokenization pattern.
+const (
+	EncodingCL100K = "cl100k_base"
+	EncodingO200K  = "o200k_base"
+)
+
+// modelEncodings maps model name prefixes to their encoding, most specific
+// first. Models of other vendors fall back to cl100k_base, which is close
+// enough for budgeting until their vocabulary is configured.
+var modelEncodings = []struct{ prefix, encoding string }{
+	{"gpt-4o", EncodingO200K},
+	{"chatgpt-4o", EncodingO200K},
+	{"gpt-4.1", EncodingO200K},
+	{"gpt-4.5", EncodingO200K},
+	{"gpt-5", EncodingO200K},
+	{"o1", EncodingO200K},
+	{"o3", EncodingO200K},
+	{"o4", EncodingO200K},
+	{"gpt-4", EncodingCL100K},
+	{"gpt-3.5", EncodingCL100K},
+	{"text-embedding-", EncodingCL100K},
+}
+
+// EncodingForModel returns the encoding for model: cfg.Models overrides
+// first, then the built-in prefix table, then cl100k_base.
+func EncodingForModel(cfg configs.TokenizerConfig, model string) string {
+	if enc, ok := cfg.Models[model]; ok {
+		return enc
+	}
+	for _, m := range modelEncodings {
+		if strings.HasPrefix(model, m.prefix) {
+			return m.encoding
+		}
+	}
+	return EncodingCL100K
+}
+
+// ForModel returns the tokenizer for model. The encoding's vocabulary is
+// read from <cfg.VocabDir>/<encoding>.tiktoken; without a VocabDir the
+// bytes/4 approximation is used. Vocabularies are loaded once per process.
+func ForModel(cfg configs.TokenizerConfig, model string) (Tokenizer, error) {
+	if cfg.VocabDir == "" {
+		return Approx{}, nil
+	}
+	encoding := EncodingForModel(cfg, model)
+	return load(filepath.Join(cfg.VocabDir, encoding+".tiktoken"), encoding)
+}
+
+var (
+	loadedMu sync.Mutex
+	loaded   = make(map[string]*BPE)
+)
+
+func load(path, encoding string) (*BPE, error) {
+	loadedMu.Lock()
+	defer loadedMu.Unlock()
+
+	if bpe, ok := loaded[path]; ok {
+		return bpe, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("tokenizer %s: %w", encoding, err)
+	}
+	defer f.Close()
+
+	bpe, err := LoadBPE(f, encoding)
+	if err != nil {
+		return nil, err
+	}
+	loaded[path] = bpe
+	return bpe, nil
+}
+
+// --- Approximation ---
+
+// Approx estimates one token per 4 bytes, the usual figure for English
+// prose. It undercounts non-English text and code.
+type Approx struct{}
+
+func (Approx) Name() string { return "approx" }
+
+func (Approx) Count(text string) int {
+	count := len(text) / 4
+	if count == 0 && len(text) > 0 {
+		count = 1
+	}
+	return count
+}
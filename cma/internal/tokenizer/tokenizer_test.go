@@ -0,0 +1,159 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/memora/cma/configs"
+)
+
+// writeVocab writes a tiktoken file with every single byte at ranks 0-255
+// followed by merges, and returns its directory.
+func writeVocab(t *testing.T, encoding string, merges ...string) string {
+	t.Helper()
+	var sb strings.Builder
+	rank := 0
+	add := func(tok string) {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(tok)), rank)
+		rank++
+	}
+	for b := 0; b < 256; b++ {
+		add(string([]byte{byte(b)}))
+	}
+	for _, m := range merges {
+		add(m)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, encoding+".tiktoken"), []byte(sb.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestBPEEncode(t *testing.T) {
+	dir := writeVocab(t, EncodingCL100K, "he", "ll", "llo", "hello", " w", "or", "ld")
+	tok, err := ForModel(configs.TokenizerConfig{VocabDir: dir}, "gpt-4")
+	if err != nil {
+		t.Fatalf("ForModel: %v", err)
+	}
+	bpe, ok := tok.(*BPE)
+	if !ok {
+		t.Fatalf("got %T, want *BPE", tok)
+	}
+
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"hello world", []int{259, 260, 261, 262}},
+		{"hello", []int{259}},
+		{"", nil},
+		{"héllo", []int{'h', 0xc3, 0xa9, 258}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			ids := bpe.Encode(tt.text)
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("Encode = %v, want %v", ids, tt.want)
+			}
+			if got := bpe.Count(tt.text); got != len(tt.want) {
+				t.Errorf("Count = %d, want %d", got, len(tt.want))
+			}
+			if got := bpe.Decode(ids); got != tt.text {
+				t.Errorf("Decode = %q, want %q", got, tt.text)
+			}
+		})
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	bpe, err := NewBPE(EncodingCL100K, byteRanks())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"hello world", []string{"hello", " world"}},
+		{"hello  world", []string{"hello", " ", " world"}},
+		{"trailing  ", []string{"trailing", "  "}},
+		{"a\n\n  foo", []string{"a", "\n\n", " ", " foo"}},
+		{"I'm 12345!", []string{"I", "'m", " ", "123", "45", "!"}},
+		{"x = y;\n", []string{"x", " =", " y", ";\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := bpe.splitText(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodingForModel(t *testing.T) {
+	cfg := configs.TokenizerConfig{Models: map[string]string{"llama3.1": "llama3"}}
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"gpt-4o-mini", EncodingO200K},
+		{"o3-mini", EncodingO200K},
+		{"gpt-4-turbo", EncodingCL100K},
+		{"claude-sonnet-4-5", EncodingCL100K},
+		{"llama3.1", "llama3"},
+	}
+	for _, tt := range tests {
+		if got := EncodingForModel(cfg, tt.model); got != tt.want {
+			t.Errorf("EncodingForModel(%q) = %q, want %q", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestForModel(t *testing.T) {
+	tok, err := ForModel(configs.TokenizerConfig{}, "gpt-4o")
+	if err != nil || tok.Name() != "approx" {
+		t.Errorf("no vocab dir: got %v, %v; want approx", tok, err)
+	}
+	if got := tok.Count("abcdefgh"); got != 2 {
+		t.Errorf("approx Count = %d, want 2", got)
+	}
+
+	dir := writeVocab(t, EncodingO200K)
+	tok, err = ForModel(configs.TokenizerConfig{VocabDir: dir}, "gpt-4o")
+	if err != nil {
+		t.Fatalf("ForModel: %v", err)
+	}
+	if tok.Name() != EncodingO200K {
+		t.Errorf("Name = %q, want %q", tok.Name(), EncodingO200K)
+	}
+
+	if _, err := ForModel(configs.TokenizerConfig{VocabDir: dir}, "gpt-4"); err == nil {
+		t.Error("missing cl100k_base.tiktoken: want error")
+	}
+}
+
+func TestLoadBPERejectsIncompleteVocab(t *testing.T) {
+	_, err := LoadBPE(strings.NewReader("YQ== 0\n"), "partial")
+	if err == nil {
+		t.Error("want error for a vocabulary without every byte")
+	}
+}
+
+// --- Helpers ---
+
+func byteRanks() map[string]int {
+	ranks := make(map[string]int, 256)
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	return ranks
+}
@@ -0,0 +1,248 @@
+package vectorstore
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/models"
+	"github.com/memora/cma/pkg"
+)
+
+// InMemoryStore implements VectorStore entirely in process memory.
+//
+// Search is brute-force cosine similarity over the user's episodes, which is
+// exact and fast enough for tests, local demos and single-node deployments
+// with tens of thousands of episodes. Nothing is persisted across restarts.
+type InMemoryStore struct {
+	mu         sync.RWMutex
+	episodes   map[string]models.Episode
+	vectorSize uint64
+}
+
+// NewInMemoryStore creates a new in-memory VectorStore.
+func NewInMemoryStore(cfg configs.QdrantConfig) *InMemoryStore {
+	return &InMemoryStore{
+		episodes:   make(map[string]models.Episode),
+		vectorSize: cfg.VectorSize,
+	}
+}
+
+// EnsureCollection is a no-op; the in-memory collection always exists.
+func (m *InMemoryStore) EnsureCollection(ctx context.Context) error {
+	slog.Info("in-memory vector store ready", "vector_size", m.vectorSize)
+	return nil
+}
+
+// Upsert stores episodic fragments, replacing any existing episode with the same ID.
+func (m *InMemoryStore) Upsert(ctx context.Context, episodes []models.Episode) error {
+	for _, ep := range episodes {
+		if m.vectorSize > 0 && uint64(len(ep.Embedding)) != m.vectorSize {
+			return fmt.Errorf("memory upsert: vector size %d, expected %d", len(ep.Embedding), m.vectorSize)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, ep := range episodes {
+		if ep.ID == "" {
+			ep.ID = uuid.New().String()
+		}
+		m.episodes[ep.ID] = copyEpisode(ep, true)
+	}
+
+	return nil
+}
+
+// Search performs brute-force cosine similarity search over the user's
+// episodes, optionally restricted to one session. topK <= 0 returns nothing.
+func (m *InMemoryStore) Search(ctx context.Context, userID, sessionID string, queryVector []float32, topK int, withVectors bool) ([]models.RetrievalResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := make([]models.RetrievalResult, 0)
+	if topK <= 0 {
+		return results, nil
+	}
+	for _, ep := range m.episodes {
+		if ep.UserID != userID || (sessionID != "" && ep.SessionID != sessionID) {
+			continue
+		}
+		hit := copyEpisode(ep, withVectors)
+		results = append(results, models.RetrievalResult{
+			Episode: &hit,
+			Score:   pkg.CosineSimilarity(queryVector, ep.Embedding),
+			Source:  "vector",
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if len(results) > topK {
+		results = results[:topK]
+	}
+
+	return results, nil
+}
+
+// GetUnconsolidated retrieves pending episodes for a user, including their vectors.
+func (m *InMemoryStore) GetUnconsolidated(ctx context.Context, userID string, limit int) ([]models.Episode, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	episodes := make([]models.Episode, 0)
+	for _, ep := range m.episodes {
+		if ep.UserID == userID && ep.ConsolidationStatus == models.StatusPending {
+			episodes = append(episodes, copyEpisode(ep, true))
+		}
+	}
+
+	// Oldest first so repeated scrolls make progress through the backlog.
+	sort.Slice(episodes, func(i, j int) bool {
+		return episodes[i].Timestamp.Before(episodes[j].Timestamp)
+	})
+
+	if len(episodes) > limit {
+		episodes = episodes[:limit]
+	}
+
+	return episodes, nil
+}
+
+// MarkConsolidated sets consolidation_status = "consolidated" for the given IDs.
+func (m *InMemoryStore) MarkConsolidated(ctx context.Context, ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		if ep, ok := m.episodes[id]; ok {
+			ep.ConsolidationStatus = models.StatusConsolidated
+			m.episodes[id] = ep
+		}
+	}
+
+	return nil
+}
+
+// UpdateDecay sets decay_factor for the given IDs.
+func (m *InMemoryStore) UpdateDecay(ctx context.Context, ids []string, decayFactor float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		if ep, ok := m.episodes[id]; ok {
+			ep.DecayFactor = decayFactor
+			m.episodes[id] = ep
+		}
+	}
+
+	return nil
+}
+
+// DeleteByIDs removes episodes by ID. Unknown IDs are ignored.
+func (m *InMemoryStore) DeleteByIDs(ctx context.Context, ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		delete(m.episodes, id)
+	}
+
+	return nil
+}
+
+// DeleteUserEpisodes removes the user's episodes among ids.
+func (m *InMemoryStore) DeleteUserEpisodes(ctx context.Context, userID string, ids []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+	for _, id := range ids {
+		if ep, ok := m.episodes[id]; ok && ep.UserID == userID {
+			delete(m.episodes, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// CountUnconsolidated returns the number of pending episodes for a user.
+func (m *InMemoryStore) CountUnconsolidated(ctx context.Context, userID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, ep := range m.episodes {
+		if ep.UserID == userID && ep.ConsolidationStatus == models.StatusPending {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// GetRecent retrieves the most recent episodes for a user, sorted by timestamp descending.
+func (m *InMemoryStore) GetRecent(ctx context.Context, userID string, limit int) ([]models.Episode, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	episodes := make([]models.Episode, 0)
+	for _, ep := range m.episodes {
+		if ep.UserID == userID {
+			episodes = append(episodes, copyEpisode(ep, false))
+		}
+	}
+
+	sort.Slice(episodes, func(i, j int) bool {
+		return episodes[i].Timestamp.After(episodes[j].Timestamp)
+	})
+
+	if len(episodes) > limit {
+		episodes = episodes[:limit]
+	}
+
+	return episodes, nil
+}
+
+// Close releases all stored episodes.
+func (m *InMemoryStore) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.episodes = make(map[string]models.Episode)
+	return nil
+}
+
+// copyEpisode returns a copy of ep that shares no mutable state with the store.
+// Vectors are only copied when withVector is set, mirroring Qdrant's
+// WithVectors selector.
+func copyEpisode(ep models.Episode, withVector bool) models.Episode {
+	out := ep
+
+	out.Embedding = nil
+	if withVector && ep.Embedding != nil {
+		out.Embedding = append([]float32(nil), ep.Embedding...)
+	}
+
+	if ep.AssociatedEntities != nil {
+		out.AssociatedEntities = append([]string(nil), ep.AssociatedEntities...)
+	}
+
+	if ep.Metadata != nil {
+		out.Metadata = make(map[string]any, len(ep.Metadata))
+		for k, v := range ep.Metadata {
+			out.Metadata[k] = v
+		}
+	}
+
+	return out
+}
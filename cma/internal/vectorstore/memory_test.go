@@ -0,0 +1,126 @@
+package vectorstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/models"
+)
+
+func TestInMemoryStoreSearch(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStore(configs.QdrantConfig{VectorSize: 2})
+
+	episode := func(id, userID, sessionID string, vec []float32) models.Episode {
+		ep := models.NewEpisode(userID, id, vec, 1)
+		ep.ID, ep.SessionID = id, sessionID
+		return *ep
+	}
+	err := store.Upsert(ctx, []models.Episode{
+		episode("near", "alice", "s1", []float32{1, 0}),
+		episode("mid", "alice", "s2", []float32{1, 1}),
+		episode("far", "alice", "s1", []float32{0, 1}),
+		episode("other-user", "bob", "s1", []float32{1, 0}),
+	})
+	if err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		userID    string
+		sessionID string
+		topK      int
+		want      []string
+	}{
+		{"ranked by similarity", "alice", "", 10, []string{"near", "mid", "far"}},
+		{"capped at topK", "alice", "", 2, []string{"near", "mid"}},
+		{"session filter", "alice", "s1", 10, []string{"near", "far"}},
+		{"user filter", "bob", "", 10, []string{"other-user"}},
+		{"unknown user", "carol", "", 10, nil},
+		{"zero topK", "alice", "", 0, nil},
+		{"negative topK", "alice", "", -1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := store.Search(ctx, tt.userID, tt.sessionID, []float32{1, 0}, tt.topK, true)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if len(results) != len(tt.want) {
+				t.Fatalf("got %d results, want %v", len(results), tt.want)
+			}
+			for i, r := range results {
+				if r.Episode.ID != tt.want[i] {
+					t.Errorf("result %d = %s, want %s", i, r.Episode.ID, tt.want[i])
+				}
+				if len(r.Episode.Embedding) != 2 {
+					t.Errorf("result %d has no embedding", i)
+				}
+			}
+		})
+	}
+
+	// Results are copies: mutating one leaves the store untouched.
+	results, _ := store.Search(ctx, "alice", "", []float32{1, 0}, 1, true)
+	results[0].Episode.Embedding[0] = -1
+	if again, _ := store.Search(ctx, "alice", "", []float32{1, 0}, 1, true); again[0].Episode.Embedding[0] != 1 {
+		t.Errorf("search result shares its embedding with the store")
+	}
+
+	// Without withVectors the embeddings stay in the store.
+	if results, _ := store.Search(ctx, "alice", "", []float32{1, 0}, 1, false); results[0].Episode.Embedding != nil {
+		t.Errorf("search without vectors returned embedding %v", results[0].Episode.Embedding)
+	}
+}
+
+func TestInMemoryStoreConsolidationUpdates(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStore(configs.QdrantConfig{})
+
+	var episodes []models.Episode
+	for _, id := range []string{"a", "b", "c"} {
+		ep := models.NewEpisode("alice", id, []float32{1}, 1)
+		ep.ID = id
+		episodes = append(episodes, *ep)
+	}
+	if err := store.Upsert(ctx, episodes); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	// Unknown IDs are ignored.
+	if err := store.MarkConsolidated(ctx, []string{"a", "b", "missing"}); err != nil {
+		t.Fatalf("MarkConsolidated: %v", err)
+	}
+	if err := store.UpdateDecay(ctx, []string{"b", "missing"}, 0.25); err != nil {
+		t.Fatalf("UpdateDecay: %v", err)
+	}
+
+	pending, err := store.GetUnconsolidated(ctx, "alice", 10)
+	if err != nil {
+		t.Fatalf("GetUnconsolidated: %v", err)
+	}
+	if len(pending) != 1 || pending[0].ID != "c" {
+		t.Errorf("pending = %+v, want only c", pending)
+	}
+	if n, _ := store.CountUnconsolidated(ctx, "alice"); n != 1 {
+		t.Errorf("CountUnconsolidated = %d, want 1", n)
+	}
+
+	recent, err := store.GetRecent(ctx, "alice", 10)
+	if err != nil {
+		t.Fatalf("GetRecent: %v", err)
+	}
+	decay := make(map[string]float64)
+	status := make(map[string]models.ConsolidationStatus)
+	for _, ep := range recent {
+		decay[ep.ID], status[ep.ID] = ep.DecayFactor, ep.ConsolidationStatus
+	}
+	if decay["a"] != 1 || decay["b"] != 0.25 || decay["c"] != 1 {
+		t.Errorf("decay factors = %v, want b decayed to 0.25", decay)
+	}
+	if status["a"] != models.StatusConsolidated || status["b"] != models.StatusConsolidated || status["c"] != models.StatusPending {
+		t.Errorf("statuses = %v, want a and b consolidated", status)
+	}
+}
@@ -51,6 +51,8 @@ func (q *QdrantStore) EnsureCollection(ctx context.Context) error {
 	for _, col := range listResp.GetCollections() {
 		if col.GetName() == q.cfg.Collection {
 			slog.Info("qdrant collection already exists", "collection", q.cfg.Collection)
+			// Indexes added since the collection was created.
+			q.ensureIndexes(ctx)
 			return nil
 		}
 	}
@@ -85,14 +87,24 @@ func (q *QdrantStore) EnsureCollection(ctx context.Context) error {
 
 	slog.Info("qdrant collection created", "collection", q.cfg.Collection)
 
-	// Create payload indices for efficient filtering.
+	q.ensureIndexes(ctx)
+
+	return nil
+}
+
+// ensureIndexes creates the payload indices used for filtering. Creating an
+// existing index is a no-op; failures are logged, not fatal.
+func (q *QdrantStore) ensureIndexes(ctx context.Context) {
 	payloadIndices := map[string]pb.FieldType{
-		"user_id":              pb.FieldType_FieldTypeKeyword,
-		"consolidation_status": pb.FieldType_FieldTypeKeyword,
-		"memory_type":          pb.FieldType_FieldTypeKeyword,
-		"timestamp":            pb.FieldType_FieldTypeInteger,
-		"surprisal_value":      pb.FieldType_FieldTypeFloat,
-		"decay_factor":         pb.FieldType_FieldTypeFloat,
+		"user_id":                       pb.FieldType_FieldTypeKeyword,
+		"session_id":                    pb.FieldType_FieldTypeKeyword,
+		"consolidation_status":          pb.FieldType_FieldTypeKeyword,
+		"memory_type":                   pb.FieldType_FieldTypeKeyword,
+		"timestamp":                     pb.FieldType_FieldTypeInteger,
+		"surprisal_value":               pb.FieldType_FieldTypeFloat,
+		"decay_factor":                  pb.FieldType_FieldTypeFloat,
+		"metadata." + models.MetaRole:   pb.FieldType_FieldTypeKeyword,
+		"metadata." + models.MetaSource: pb.FieldType_FieldTypeKeyword,
 	}
 
 	for field, ftype := range payloadIndices {
@@ -106,8 +118,6 @@ func (q *QdrantStore) EnsureCollection(ctx context.Context) error {
 			slog.Warn("qdrant create index", "field", field, "error", err)
 		}
 	}
-
-	return nil
 }
 
 // Upsert stores episodic fragments as vectors with rich payloads.
@@ -120,26 +130,7 @@ func (q *QdrantStore) Upsert(ctx context.Context, episodes []models.Episode) err
 			pointID = uuid.New().String()
 		}
 
-		entities := make([]*pb.Value, 0, len(ep.AssociatedEntities))
-		for _, e := range ep.AssociatedEntities {
-			entities = append(entities, &pb.Value{
-				Kind: &pb.Value_StringValue{StringValue: e},
-			})
-		}
-
-		payload := map[string]*pb.Value{
-			"content": {Kind: &pb.Value_StringValue{StringValue: ep.Content}},
-			"event_id": {Kind: &pb.Value_StringValue{StringValue: ep.EventID}},
-			"timestamp": {Kind: &pb.Value_IntegerValue{IntegerValue: ep.Timestamp.Unix()}},
-			"user_id": {Kind: &pb.Value_StringValue{StringValue: ep.UserID}},
-			"memory_type": {Kind: &pb.Value_StringValue{StringValue: string(ep.MemoryType)}},
-			"importance_score": {Kind: &pb.Value_DoubleValue{DoubleValue: ep.ImportanceScore}},
-			"consolidation_status": {Kind: &pb.Value_StringValue{StringValue: string(ep.ConsolidationStatus)}},
-			"surprisal_value": {Kind: &pb.Value_DoubleValue{DoubleValue: ep.SurprisalValue}},
-			"decay_factor": {Kind: &pb.Value_DoubleValue{DoubleValue: ep.DecayFactor}},
-			"token_count": {Kind: &pb.Value_IntegerValue{IntegerValue: int64(ep.TokenCount)}},
-			"associated_entities": {Kind: &pb.Value_ListValue{ListValue: &pb.ListValue{Values: entities}}},
-		}
+		payload := episodeToPayload(ep)
 
 		points = append(points, &pb.PointStruct{
 			Id:      &pb.PointId{PointIdOptions: &pb.PointId_Uuid{Uuid: pointID}},
@@ -160,26 +151,19 @@ func (q *QdrantStore) Upsert(ctx context.Context, episodes []models.Episode) err
 }
 
 // Search performs cosine similarity search with user_id payload filter.
-func (q *QdrantStore) Search(ctx context.Context, userID string, queryVector []float32, topK int) ([]models.RetrievalResult, error) {
+func (q *QdrantStore) Search(ctx context.Context, userID, sessionID string, queryVector []float32, topK int, withVectors bool) ([]models.RetrievalResult, error) {
+	must := []*pb.Condition{keywordCondition("user_id", userID)}
+	if sessionID != "" {
+		must = append(must, keywordCondition("session_id", sessionID))
+	}
+
 	resp, err := q.points.Search(ctx, &pb.SearchPoints{
 		CollectionName: q.cfg.Collection,
 		Vector:         queryVector,
 		Limit:          uint64(topK),
 		WithPayload:    &pb.WithPayloadSelector{SelectorOptions: &pb.WithPayloadSelector_Enable{Enable: true}},
-		Filter: &pb.Filter{
-			Must: []*pb.Condition{
-				{
-					ConditionOneOf: &pb.Condition_Field{
-						Field: &pb.FieldCondition{
-							Key: "user_id",
-							Match: &pb.Match{
-								MatchValue: &pb.Match_Keyword{Keyword: userID},
-							},
-						},
-					},
-				},
-			},
-		},
+		WithVectors:    &pb.WithVectorsSelector{SelectorOptions: &pb.WithVectorsSelector_Enable{Enable: withVectors}},
+		Filter:         &pb.Filter{Must: must},
 	})
 	if err != nil {
 		return nil, fmt.Errorf("qdrant search: %w", err)
@@ -188,6 +172,9 @@ func (q *QdrantStore) Search(ctx context.Context, userID string, queryVector []f
 	results := make([]models.RetrievalResult, 0, len(resp.GetResult()))
 	for _, hit := range resp.GetResult() {
 		ep := payloadToEpisode(hit.GetId().GetUuid(), hit.GetPayload())
+		if vec := hit.GetVectors().GetVector(); vec != nil {
+			ep.Embedding = vec.GetData()
+		}
 		results = append(results, models.RetrievalResult{
 			Episode: ep,
 			Score:   float64(hit.GetScore()),
@@ -314,6 +301,52 @@ func (q *QdrantStore) DeleteByIDs(ctx context.Context, ids []string) error {
 	return nil
 }
 
+// DeleteUserEpisodes removes the points among ids whose user_id matches.
+// Deletes do not report how many points matched, so the count comes from a
+// separate Count call beforehand and is best-effort: points written or
+// deleted concurrently between the two calls make it off.
+func (q *QdrantStore) DeleteUserEpisodes(ctx context.Context, userID string, ids []string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	pointIDs := make([]*pb.PointId, 0, len(ids))
+	for _, id := range ids {
+		pointIDs = append(pointIDs, &pb.PointId{PointIdOptions: &pb.PointId_Uuid{Uuid: id}})
+	}
+	filter := &pb.Filter{
+		Must: []*pb.Condition{
+			keywordCondition("user_id", userID),
+			{
+				ConditionOneOf: &pb.Condition_HasId{
+					HasId: &pb.HasIdCondition{HasId: pointIDs},
+				},
+			},
+		},
+	}
+
+	resp, err := q.points.Count(ctx, &pb.CountPoints{
+		CollectionName: q.cfg.Collection,
+		Filter:         filter,
+		Exact:          ptr(true),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("qdrant count user episodes: %w", err)
+	}
+
+	_, err = q.points.Delete(ctx, &pb.DeletePoints{
+		CollectionName: q.cfg.Collection,
+		Points: &pb.PointsSelector{
+			PointsSelectorOneOf: &pb.PointsSelector_Filter{Filter: filter},
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("qdrant delete user episodes: %w", err)
+	}
+
+	return int(resp.GetResult().GetCount()), nil
+}
+
 // CountUnconsolidated returns the number of pending episodes for a user.
 func (q *QdrantStore) CountUnconsolidated(ctx context.Context, userID string) (int, error) {
 	resp, err := q.points.Count(ctx, &pb.CountPoints{
@@ -401,10 +434,44 @@ func (q *QdrantStore) Close() error {
 
 // --- Helpers ---
 
+// episodeToPayload converts an episode to its Qdrant payload. Metadata is
+// stored as a nested struct under "metadata".
+func episodeToPayload(ep models.Episode) map[string]*pb.Value {
+	entities := make([]*pb.Value, 0, len(ep.AssociatedEntities))
+	for _, e := range ep.AssociatedEntities {
+		entities = append(entities, &pb.Value{
+			Kind: &pb.Value_StringValue{StringValue: e},
+		})
+	}
+
+	payload := map[string]*pb.Value{
+		"content": {Kind: &pb.Value_StringValue{StringValue: ep.Content}},
+		"event_id": {Kind: &pb.Value_StringValue{StringValue: ep.EventID}},
+		"timestamp": {Kind: &pb.Value_IntegerValue{IntegerValue: ep.Timestamp.Unix()}},
+		"user_id": {Kind: &pb.Value_StringValue{StringValue: ep.UserID}},
+		"memory_type": {Kind: &pb.Value_StringValue{StringValue: string(ep.MemoryType)}},
+		"importance_score": {Kind: &pb.Value_DoubleValue{DoubleValue: ep.ImportanceScore}},
+		"consolidation_status": {Kind: &pb.Value_StringValue{StringValue: string(ep.ConsolidationStatus)}},
+		"surprisal_value": {Kind: &pb.Value_DoubleValue{DoubleValue: ep.SurprisalValue}},
+		"decay_factor": {Kind: &pb.Value_DoubleValue{DoubleValue: ep.DecayFactor}},
+		"token_count": {Kind: &pb.Value_IntegerValue{IntegerValue: int64(ep.TokenCount)}},
+		"associated_entities": {Kind: &pb.Value_ListValue{ListValue: &pb.ListValue{Values: entities}}},
+	}
+	if ep.SessionID != "" {
+		payload["session_id"] = &pb.Value{Kind: &pb.Value_StringValue{StringValue: ep.SessionID}}
+	}
+	if len(ep.Metadata) > 0 {
+		payload["metadata"] = toValue(ep.Metadata)
+	}
+
+	return payload
+}
+
 func payloadToEpisode(id string, payload map[string]*pb.Value) *models.Episode {
 	ep := &models.Episode{
 		ID:     id,
 		UserID: getStringVal(payload, "user_id"),
+		SessionID: getStringVal(payload, "session_id"),
 		Content: getStringVal(payload, "content"),
 		EventID: getStringVal(payload, "event_id"),
 		MemoryType: models.MemoryType(getStringVal(payload, "memory_type")),
@@ -428,9 +495,85 @@ func payloadToEpisode(id string, payload map[string]*pb.Value) *models.Episode {
 		}
 	}
 
+	if meta, ok := fromValue(payload["metadata"]).(map[string]any); ok {
+		ep.Metadata = meta
+	}
+
 	return ep
 }
 
+// toValue converts a metadata value to a Qdrant payload value. Types with no
+// JSON counterpart are stored as their string form.
+func toValue(v any) *pb.Value {
+	switch v := v.(type) {
+	case nil:
+		return &pb.Value{Kind: &pb.Value_NullValue{NullValue: pb.NullValue_NULL_VALUE}}
+	case string:
+		return &pb.Value{Kind: &pb.Value_StringValue{StringValue: v}}
+	case bool:
+		return &pb.Value{Kind: &pb.Value_BoolValue{BoolValue: v}}
+	case int:
+		return &pb.Value{Kind: &pb.Value_IntegerValue{IntegerValue: int64(v)}}
+	case int32:
+		return &pb.Value{Kind: &pb.Value_IntegerValue{IntegerValue: int64(v)}}
+	case int64:
+		return &pb.Value{Kind: &pb.Value_IntegerValue{IntegerValue: v}}
+	case float32:
+		return &pb.Value{Kind: &pb.Value_DoubleValue{DoubleValue: float64(v)}}
+	case float64:
+		return &pb.Value{Kind: &pb.Value_DoubleValue{DoubleValue: v}}
+	case []string:
+		values := make([]*pb.Value, len(v))
+		for i, e := range v {
+			values[i] = toValue(e)
+		}
+		return &pb.Value{Kind: &pb.Value_ListValue{ListValue: &pb.ListValue{Values: values}}}
+	case []any:
+		values := make([]*pb.Value, len(v))
+		for i, e := range v {
+			values[i] = toValue(e)
+		}
+		return &pb.Value{Kind: &pb.Value_ListValue{ListValue: &pb.ListValue{Values: values}}}
+	case map[string]any:
+		fields := make(map[string]*pb.Value, len(v))
+		for k, e := range v {
+			fields[k] = toValue(e)
+		}
+		return &pb.Value{Kind: &pb.Value_StructValue{StructValue: &pb.Struct{Fields: fields}}}
+	default:
+		return &pb.Value{Kind: &pb.Value_StringValue{StringValue: fmt.Sprint(v)}}
+	}
+}
+
+// fromValue converts a Qdrant payload value back to its Go form: integers
+// as int, lists as []any and structs as map[string]any.
+func fromValue(v *pb.Value) any {
+	switch k := v.GetKind().(type) {
+	case *pb.Value_StringValue:
+		return k.StringValue
+	case *pb.Value_BoolValue:
+		return k.BoolValue
+	case *pb.Value_IntegerValue:
+		return int(k.IntegerValue)
+	case *pb.Value_DoubleValue:
+		return k.DoubleValue
+	case *pb.Value_ListValue:
+		out := make([]any, len(k.ListValue.GetValues()))
+		for i, e := range k.ListValue.GetValues() {
+			out[i] = fromValue(e)
+		}
+		return out
+	case *pb.Value_StructValue:
+		out := make(map[string]any, len(k.StructValue.GetFields()))
+		for key, e := range k.StructValue.GetFields() {
+			out[key] = fromValue(e)
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
 func getStringVal(payload map[string]*pb.Value, key string) string {
 	if v, ok := payload[key]; ok {
 		return v.GetStringValue()
@@ -452,6 +595,18 @@ func getIntVal(payload map[string]*pb.Value, key string) int64 {
 	return 0
 }
 
+// keywordCondition matches payload field key exactly against value.
+func keywordCondition(key, value string) *pb.Condition {
+	return &pb.Condition{
+		ConditionOneOf: &pb.Condition_Field{
+			Field: &pb.FieldCondition{
+				Key:   key,
+				Match: &pb.Match{MatchValue: &pb.Match_Keyword{Keyword: value}},
+			},
+		},
+	}
+}
+
 func ptr[T any](v T) *T {
 	return &v
 }
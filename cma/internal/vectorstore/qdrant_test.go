@@ -0,0 +1,50 @@
+package vectorstore
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/memora/cma/internal/models"
+)
+
+func TestPayloadRoundTrip(t *testing.T) {
+	ep := models.NewEpisode("alice", "Alice works at Google.", nil, 2.5)
+	ep.SessionID = "s1"
+	ep.Timestamp = time.Unix(1700000000, 0)
+	ep.TokenCount = 6
+	ep.AssociatedEntities = []string{"Alice", "Google"}
+	ep.Metadata = map[string]any{
+		models.MetaRole:      "user",
+		models.MetaSource:    "api",
+		models.MetaSpanStart: 0,
+		models.MetaSpanEnd:   21,
+		"score":              0.75,
+		"pinned":             true,
+		"tags":               []any{"work", 3.0},
+		"client":             map[string]any{"name": "dashboard", "build": nil},
+	}
+
+	got := payloadToEpisode(ep.ID, episodeToPayload(*ep))
+
+	if !reflect.DeepEqual(got.Metadata, ep.Metadata) {
+		t.Errorf("metadata = %#v\nwant %#v", got.Metadata, ep.Metadata)
+	}
+	if got.Content != ep.Content || got.UserID != ep.UserID || got.SessionID != ep.SessionID || got.TokenCount != ep.TokenCount ||
+		!got.Timestamp.Equal(ep.Timestamp) || !reflect.DeepEqual(got.AssociatedEntities, ep.AssociatedEntities) {
+		t.Errorf("episode = %+v\nwant %+v", got, ep)
+	}
+}
+
+func TestPayloadWithoutMetadata(t *testing.T) {
+	ep := models.NewEpisode("alice", "hi", nil, 1)
+	ep.Metadata = nil
+
+	payload := episodeToPayload(*ep)
+	if _, ok := payload["metadata"]; ok {
+		t.Error("empty metadata written to payload")
+	}
+	if got := payloadToEpisode(ep.ID, payload); got.Metadata != nil {
+		t.Errorf("metadata = %v, want nil", got.Metadata)
+	}
+}
@@ -2,7 +2,9 @@ package vectorstore
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/memora/cma/configs"
 	"github.com/memora/cma/internal/models"
 )
 
@@ -15,9 +17,10 @@ type VectorStore interface {
 	// Upsert inserts or updates episodic fragments in the vector store.
 	Upsert(ctx context.Context, episodes []models.Episode) error
 
-	// Search performs cosine similarity search filtered by user_id.
-	// Returns up to topK results.
-	Search(ctx context.Context, userID string, queryVector []float32, topK int) ([]models.RetrievalResult, error)
+	// Search performs cosine similarity search filtered by user_id and, when
+	// sessionID is non-empty, by session_id. Returns up to topK results,
+	// with their embeddings if withVectors is set.
+	Search(ctx context.Context, userID, sessionID string, queryVector []float32, topK int, withVectors bool) ([]models.RetrievalResult, error)
 
 	// GetUnconsolidated retrieves episodes that have not yet been consolidated, for a given user.
 	GetUnconsolidated(ctx context.Context, userID string, limit int) ([]models.Episode, error)
@@ -31,6 +34,11 @@ type VectorStore interface {
 	// DeleteByIDs removes episodes by their IDs.
 	DeleteByIDs(ctx context.Context, ids []string) error
 
+	// DeleteUserEpisodes removes the user's episodes among ids and returns
+	// how many were removed, which stores without a transactional delete
+	// report on a best-effort basis; other users' episodes are left untouched.
+	DeleteUserEpisodes(ctx context.Context, userID string, ids []string) (int, error)
+
 	// CountUnconsolidated returns the number of unconsolidated episodes for a user.
 	CountUnconsolidated(ctx context.Context, userID string) (int, error)
 
@@ -40,3 +48,16 @@ type VectorStore interface {
 	// Close releases resources.
 	Close() error
 }
+
+// New creates the VectorStore selected by cfg.Backend.
+// Supported backends are "qdrant" (default) and "memory".
+func New(cfg configs.QdrantConfig) (VectorStore, error) {
+	switch cfg.Backend {
+	case "", "qdrant":
+		return NewQdrantStore(cfg)
+	case "memory":
+		return NewInMemoryStore(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown vector store backend %q", cfg.Backend)
+	}
+}
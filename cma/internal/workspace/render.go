@@ -0,0 +1,277 @@
+package workspace
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/memora/cma/internal/models"
+)
+
+// Renderer formats the packed context for the agent framework consuming it.
+type Renderer interface {
+	// Render lays out the selected items and the query.
+	Render(l Layout) (Rendered, error)
+}
+
+// Layout is the packed context grouped into the sections every format
+// presents, in selection order.
+type Layout struct {
+	Profile  []models.KnapsackItem
+	Turns    []models.KnapsackItem
+	Memories []models.KnapsackItem // episodes and graph facts
+	Query    string
+}
+
+// Rendered is a context in one format. Text is what is sent to the model
+// and counted against the budget.
+type Rendered struct {
+	Text     string
+	Messages []models.ChatMessage // FormatMessages only
+}
+
+// NewRenderer returns the renderer for format; empty selects markdown.
+func NewRenderer(format string) (Renderer, error) {
+	switch format {
+	case "", models.FormatMarkdown:
+		return MarkdownRenderer{}, nil
+	case models.FormatXML:
+		return XMLRenderer{}, nil
+	case models.FormatJSON:
+		return JSONRenderer{}, nil
+	case models.FormatMessages:
+		return MessagesRenderer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown context format %q", format)
+	}
+}
+
+// newLayout groups the selected items by section.
+func newLayout(items []models.KnapsackItem, query string) Layout {
+	l := Layout{Query: query}
+	for _, item := range items {
+		switch {
+		case item.Section == models.SectionProfile:
+			l.Profile = append(l.Profile, item)
+		case item.ForceInclude:
+			l.Turns = append(l.Turns, item)
+		default:
+			l.Memories = append(l.Memories, item)
+		}
+	}
+	return l
+}
+
+// --- Markdown ---
+
+// MarkdownRenderer emits headed sections with [Memory N] prefixes.
+type MarkdownRenderer struct{}
+
+func (MarkdownRenderer) Render(l Layout) (Rendered, error) {
+	var sb strings.Builder
+	writeMarkdownProfile(&sb, l.Profile)
+
+	if len(l.Turns) > 0 {
+		sb.WriteString("## Recent Conversation\n")
+		for _, item := range l.Turns {
+			sb.WriteString(item.Content)
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	writeMarkdownMemories(&sb, l.Memories)
+	sb.WriteString("## Current Query\n")
+	sb.WriteString(l.Query)
+	return Rendered{Text: sb.String()}, nil
+}
+
+// writeMarkdownProfile writes the user profile section.
+func writeMarkdownProfile(sb *strings.Builder, profile []models.KnapsackItem) {
+	if len(profile) > 0 {
+		sb.WriteString("## User Profile\n")
+		for _, item := range profile {
+			sb.WriteString(item.Content)
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// writeMarkdownMemories writes the retrieved memories section.
+func writeMarkdownMemories(sb *strings.Builder, memories []models.KnapsackItem) {
+	if len(memories) > 0 {
+		sb.WriteString("## Retrieved Memories\n")
+		for i, item := range memories {
+			sb.WriteString(fmt.Sprintf("[Memory %d] %s\n", i+1, item.Content))
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// --- XML ---
+
+// XMLRenderer emits tagged blocks carrying source IDs and timestamps, which
+// models trained on tagged prompts separate reliably from instructions.
+type XMLRenderer struct{}
+
+func (XMLRenderer) Render(l Layout) (Rendered, error) {
+	var sb strings.Builder
+	sb.WriteString("<context>\n")
+
+	if len(l.Profile) > 0 {
+		sb.WriteString("<profile>\n")
+		for _, item := range l.Profile {
+			writeXMLElement(&sb, "note", item.Content, "id", item.ID)
+		}
+		sb.WriteString("</profile>\n")
+	}
+
+	if len(l.Turns) > 0 {
+		sb.WriteString("<conversation>\n")
+		for _, item := range l.Turns {
+			writeXMLElement(&sb, "turn", item.Content, "role", item.Role, "timestamp", formatTime(item.Timestamp))
+		}
+		sb.WriteString("</conversation>\n")
+	}
+
+	if len(l.Memories) > 0 {
+		sb.WriteString("<memories>\n")
+		for _, item := range l.Memories {
+			tag := "episode"
+			if item.Section == models.SectionFacts {
+				tag = "fact"
+			}
+			writeXMLElement(&sb, tag, item.Content, "id", item.ID, "timestamp", formatTime(item.Timestamp))
+		}
+		sb.WriteString("</memories>\n")
+	}
+
+	writeXMLElement(&sb, "query", l.Query)
+	sb.WriteString("</context>")
+	return Rendered{Text: sb.String()}, nil
+}
+
+// xmlTextEscaper escapes element text. Unlike xml.EscapeText it keeps
+// newlines and quotes, so multi-line content reads, and counts tokens, as
+// written.
+var xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// writeXMLElement writes <tag k="v"...>content</tag> on its own line,
+// skipping empty attributes.
+func writeXMLElement(sb *strings.Builder, tag, content string, attrs ...string) {
+	sb.WriteString("<" + tag)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i+1] == "" {
+			continue
+		}
+		sb.WriteString(" " + attrs[i] + `="`)
+		xml.EscapeText(sb, []byte(attrs[i+1]))
+		sb.WriteString(`"`)
+	}
+	sb.WriteString(">")
+	xmlTextEscaper.WriteString(sb, content)
+	sb.WriteString("</" + tag + ">\n")
+}
+
+// --- JSON ---
+
+// JSONRenderer emits one compact JSON object with a field per section.
+type JSONRenderer struct{}
+
+type jsonContext struct {
+	Profile      []string    `json:"profile,omitempty"`
+	Conversation []jsonBlock `json:"conversation,omitempty"`
+	Memories     []jsonBlock `json:"memories,omitempty"`
+	Query        string      `json:"query"`
+}
+
+type jsonBlock struct {
+	ID        string `json:"id,omitempty"`
+	Type      string `json:"type,omitempty"` // memories: "episode" or "fact"
+	Role      string `json:"role,omitempty"` // conversation only
+	Content   string `json:"content"`
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+func (JSONRenderer) Render(l Layout) (Rendered, error) {
+	out := jsonContext{Query: l.Query}
+	for _, item := range l.Profile {
+		out.Profile = append(out.Profile, item.Content)
+	}
+	for _, item := range l.Turns {
+		out.Conversation = append(out.Conversation, jsonBlock{
+			Role:      item.Role,
+			Content:   item.Content,
+			Timestamp: formatTime(item.Timestamp),
+		})
+	}
+	for _, item := range l.Memories {
+		typ := "episode"
+		if item.Section == models.SectionFacts {
+			typ = "fact"
+		}
+		out.Memories = append(out.Memories, jsonBlock{
+			ID:        item.ID,
+			Type:      typ,
+			Content:   item.Content,
+			Timestamp: formatTime(item.Timestamp),
+		})
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		return Rendered{}, fmt.Errorf("render json context: %w", err)
+	}
+	return Rendered{Text: string(data)}, nil
+}
+
+// --- Chat messages ---
+
+// MessagesRenderer emits an OpenAI/Anthropic style messages array: the
+// profile and memories in a system message, the recent turns as messages
+// with their own roles, and the query as the final user message.
+type MessagesRenderer struct{}
+
+func (MessagesRenderer) Render(l Layout) (Rendered, error) {
+	var messages []models.ChatMessage
+
+	if len(l.Profile) > 0 || len(l.Memories) > 0 {
+		var sb strings.Builder
+		sb.WriteString("Use the following memories about the user where they are relevant.\n\n")
+		writeMarkdownProfile(&sb, l.Profile)
+		writeMarkdownMemories(&sb, l.Memories)
+		messages = append(messages, models.ChatMessage{Role: "system", Content: strings.TrimSpace(sb.String())})
+	}
+
+	for _, item := range l.Turns {
+		role := item.Role
+		if role != "assistant" && role != "system" {
+			role = "user"
+		}
+		messages = append(messages, models.ChatMessage{Role: role, Content: item.Content})
+	}
+
+	// The query is often the user's latest turn already.
+	if n := len(messages); n == 0 || messages[n-1].Role != "user" || messages[n-1].Content != l.Query {
+		messages = append(messages, models.ChatMessage{Role: "user", Content: l.Query})
+	}
+
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return Rendered{}, fmt.Errorf("render context messages: %w", err)
+	}
+	return Rendered{Text: string(data), Messages: messages}, nil
+}
+
+// --- Helpers ---
+
+// formatTime returns t in RFC 3339, or "" if t is zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
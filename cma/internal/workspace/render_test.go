@@ -0,0 +1,175 @@
+package workspace
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/knapsack"
+	"github.com/memora/cma/internal/models"
+	"github.com/memora/cma/internal/tokenizer"
+)
+
+func testLayout() Layout {
+	at := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	return newLayout([]models.KnapsackItem{
+		{ID: "profile_1", Content: "Prefers tea", Section: models.SectionProfile, ForceInclude: true},
+		{ID: "turn_user", Content: "Where does Alice work?", Section: models.SectionTurns, ForceInclude: true, Role: "user", Timestamp: at},
+		{ID: "ep-1", Content: "Alice works at Google & <Co>", Section: models.SectionEpisodes, Timestamp: at},
+		{Content: "Alice works_at Google", Section: models.SectionFacts},
+	}, "Where does Alice work?")
+}
+
+func TestMarkdownRenderer(t *testing.T) {
+	got, err := MarkdownRenderer{}.Render(testLayout())
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	want := "## User Profile\nPrefers tea\n\n" +
+		"## Recent Conversation\nWhere does Alice work?\n\n" +
+		"## Retrieved Memories\n[Memory 1] Alice works at Google & <Co>\n[Memory 2] Alice works_at Google\n\n" +
+		"## Current Query\nWhere does Alice work?"
+	if got.Text != want {
+		t.Errorf("markdown =\n%s\nwant\n%s", got.Text, want)
+	}
+}
+
+func TestXMLRenderer(t *testing.T) {
+	got, err := XMLRenderer{}.Render(testLayout())
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	for _, want := range []string{
+		`<note id="profile_1">Prefers tea</note>`,
+		`<turn role="user" timestamp="2024-03-01T09:30:00Z">Where does Alice work?</turn>`,
+		`<episode id="ep-1" timestamp="2024-03-01T09:30:00Z">Alice works at Google &amp; &lt;Co&gt;</episode>`,
+		`<fact>Alice works_at Google</fact>`,
+		`<query>Where does Alice work?</query>`,
+	} {
+		if !strings.Contains(got.Text, want) {
+			t.Errorf("xml lacks %s:\n%s", want, got.Text)
+		}
+	}
+
+	// Element text keeps its newlines and quotes; attribute values escape them.
+	got, err = XMLRenderer{}.Render(newLayout([]models.KnapsackItem{
+		{ID: `ep-"2"`, Content: "Alice said \"hi\"\nthen left", Section: models.SectionEpisodes},
+	}, "Who left?"))
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if want := `<episode id="ep-&#34;2&#34;">Alice said "hi"` + "\nthen left</episode>"; !strings.Contains(got.Text, want) {
+		t.Errorf("xml lacks %s:\n%s", want, got.Text)
+	}
+}
+
+func TestJSONRenderer(t *testing.T) {
+	got, err := JSONRenderer{}.Render(testLayout())
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	var out jsonContext
+	if err := json.Unmarshal([]byte(got.Text), &out); err != nil {
+		t.Fatalf("not json: %v\n%s", err, got.Text)
+	}
+	if len(out.Profile) != 1 || len(out.Conversation) != 1 || out.Conversation[0].Role != "user" {
+		t.Errorf("sections = %+v", out)
+	}
+	if len(out.Memories) != 2 || out.Memories[0].ID != "ep-1" || out.Memories[1].Type != "fact" {
+		t.Errorf("memories = %+v", out.Memories)
+	}
+}
+
+func TestMessagesRenderer(t *testing.T) {
+	l := testLayout()
+	l.Turns = append(l.Turns, models.KnapsackItem{Content: "At Google.", Role: "assistant", ForceInclude: true})
+	l.Query = "Since when?"
+
+	got, err := MessagesRenderer{}.Render(l)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	var roles []string
+	for _, m := range got.Messages {
+		roles = append(roles, m.Role)
+	}
+	if !reflect.DeepEqual(roles, []string{"system", "user", "assistant", "user"}) {
+		t.Fatalf("roles = %v", roles)
+	}
+	if !strings.Contains(got.Messages[0].Content, "[Memory 1] Alice works at Google") ||
+		!strings.Contains(got.Messages[0].Content, "Prefers tea") {
+		t.Errorf("system message lacks the memories:\n%s", got.Messages[0].Content)
+	}
+	if got.Messages[3].Content != "Since when?" {
+		t.Errorf("last message = %+v, want the query", got.Messages[3])
+	}
+
+	var decoded []models.ChatMessage
+	if err := json.Unmarshal([]byte(got.Text), &decoded); err != nil || !reflect.DeepEqual(decoded, got.Messages) {
+		t.Errorf("text does not encode the messages: %v\n%s", err, got.Text)
+	}
+
+	// A query that is the latest user turn is not repeated.
+	got, _ = MessagesRenderer{}.Render(testLayout())
+	if n := len(got.Messages); n != 2 || got.Messages[n-1].Content != "Where does Alice work?" {
+		t.Errorf("messages = %+v", got.Messages)
+	}
+}
+
+func TestRenderTrimsToBudget(t *testing.T) {
+	// The items fit in 45 tokens; with the headings only one memory does.
+	// Reserved tokens are held back from the budget for the system prompt.
+	tests := []struct {
+		name     string
+		budget   int
+		reserved int
+	}{
+		{"budget", 45, 0},
+		{"budget less reserve", 80, 35},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Workspace{tokenizer: tokenizer.Approx{}, cfg: configs.KnapsackConfig{ReservedTokens: tt.reserved}}
+			selection := knapsack.SelectionResult{
+				Selected: []models.KnapsackItem{
+					{ID: "turn", Content: strings.Repeat("t", 40), Weight: 10, ForceInclude: true, Section: models.SectionTurns},
+					{ID: "dense", Content: strings.Repeat("d", 40), Weight: 10, Value: 0.9, Density: 0.09, Section: models.SectionEpisodes},
+					{ID: "sparse", Content: strings.Repeat("s", 40), Weight: 10, Value: 0.1, Density: 0.01, Section: models.SectionEpisodes},
+				},
+				TotalTokens: 30,
+				Sections: map[string]models.SectionUsage{
+					models.SectionTurns:    {Used: 10},
+					models.SectionEpisodes: {Used: 20},
+				},
+			}
+
+			_, tokens, err := w.render(MarkdownRenderer{}, &selection, "q", tt.budget)
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			if tokens > tt.budget-tt.reserved {
+				t.Errorf("rendered %d tokens, over budget", tokens)
+			}
+			if len(selection.Rejected) != 1 || selection.Rejected[0].ID != "sparse" {
+				t.Errorf("rejected %+v, want the least dense memory", selection.Rejected)
+			}
+			if selection.TotalTokens != 20 || selection.Sections[models.SectionEpisodes].Used != 10 {
+				t.Errorf("totals not updated: %d tokens, sections %v", selection.TotalTokens, selection.Sections)
+			}
+		})
+	}
+}
+
+func TestNewRenderer(t *testing.T) {
+	for _, format := range []string{"", models.FormatMarkdown, models.FormatXML, models.FormatJSON, models.FormatMessages} {
+		if _, err := NewRenderer(format); err != nil {
+			t.Errorf("NewRenderer(%q): %v", format, err)
+		}
+	}
+	if _, err := NewRenderer("yaml"); err == nil {
+		t.Error("NewRenderer(yaml): want error")
+	}
+}
@@ -0,0 +1,199 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/models"
+)
+
+// TurnStore backs the phonological loop: the most recent raw turns of each
+// conversation, capped in length and expiring after a period of silence.
+//
+// A conversation is identified by user and session; the empty session is
+// the user's default conversation.
+type TurnStore interface {
+	// Append adds a turn to the conversation, dropping the oldest beyond the cap.
+	Append(ctx context.Context, userID, sessionID string, turn models.ConversationTurn) error
+
+	// Recent returns the last n turns, oldest first; n <= 0 returns all.
+	Recent(ctx context.Context, userID, sessionID string, n int) ([]models.ConversationTurn, error)
+}
+
+// NewTurnStore creates the turn store selected by cfg.TurnBackend: "redis"
+// (default), which requires client, or "memory". Configs that bypass
+// configs.Load leave the backend empty, which selects "memory".
+func NewTurnStore(cfg configs.WorkspaceConfig, client *redis.Client) (TurnStore, error) {
+	switch cfg.TurnBackend {
+	case "", "memory":
+		return NewMemoryTurnStore(cfg), nil
+	case "redis":
+		if client == nil {
+			return nil, fmt.Errorf("redis turn store: no redis client")
+		}
+		return NewRedisTurnStore(client, cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown workspace turn backend %q", cfg.TurnBackend)
+	}
+}
+
+// turnLimits applies the defaults for the history cap and TTL.
+func turnLimits(cfg configs.WorkspaceConfig) (int, time.Duration) {
+	maxTurns := cfg.MaxTurns
+	if maxTurns <= 0 {
+		maxTurns = 100
+	}
+	ttl := cfg.TurnTTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return maxTurns, ttl
+}
+
+// --- Redis ---
+
+// RedisTurnStore keeps each conversation in a Redis list of JSON turns.
+type RedisTurnStore struct {
+	client   *redis.Client
+	maxTurns int
+	ttl      time.Duration
+}
+
+// NewRedisTurnStore creates a Redis-backed turn store.
+func NewRedisTurnStore(client *redis.Client, cfg configs.WorkspaceConfig) *RedisTurnStore {
+	maxTurns, ttl := turnLimits(cfg)
+	return &RedisTurnStore{client: client, maxTurns: maxTurns, ttl: ttl}
+}
+
+// key separates the IDs with a NUL byte rather than ":", which user and
+// session IDs may contain: ("a:b", "c") and ("a", "b:c") get distinct lists.
+func (r *RedisTurnStore) key(userID, sessionID string) string {
+	return "cma:turns:" + userID + "\x00" + sessionID
+}
+
+// Append pushes the turn, trims the list and refreshes its TTL atomically.
+func (r *RedisTurnStore) Append(ctx context.Context, userID, sessionID string, turn models.ConversationTurn) error {
+	data, err := json.Marshal(turn)
+	if err != nil {
+		return fmt.Errorf("redis turn append: %w", err)
+	}
+
+	k := r.key(userID, sessionID)
+	pipe := r.client.TxPipeline()
+	pipe.RPush(ctx, k, data)
+	pipe.LTrim(ctx, k, int64(-r.maxTurns), -1)
+	pipe.Expire(ctx, k, r.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis turn append: %w", err)
+	}
+	return nil
+}
+
+// Recent reads the tail of the list.
+func (r *RedisTurnStore) Recent(ctx context.Context, userID, sessionID string, n int) ([]models.ConversationTurn, error) {
+	start := int64(0)
+	if n > 0 {
+		start = int64(-n)
+	}
+
+	raw, err := r.client.LRange(ctx, r.key(userID, sessionID), start, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis turn recent: %w", err)
+	}
+
+	turns := make([]models.ConversationTurn, 0, len(raw))
+	for _, s := range raw {
+		var turn models.ConversationTurn
+		if err := json.Unmarshal([]byte(s), &turn); err != nil {
+			return nil, fmt.Errorf("redis turn recent: %w", err)
+		}
+		turns = append(turns, turn)
+	}
+	return turns, nil
+}
+
+// --- In-memory ---
+
+// MemoryTurnStore keeps conversations in process memory (tests, single node).
+type MemoryTurnStore struct {
+	mu       sync.Mutex
+	convs    map[string]*memConversation
+	maxTurns int
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+type memConversation struct {
+	turns     []models.ConversationTurn
+	expiresAt time.Time
+}
+
+// NewMemoryTurnStore creates an empty in-memory turn store.
+func NewMemoryTurnStore(cfg configs.WorkspaceConfig) *MemoryTurnStore {
+	maxTurns, ttl := turnLimits(cfg)
+	return &MemoryTurnStore{
+		convs:    make(map[string]*memConversation),
+		maxTurns: maxTurns,
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+func (m *MemoryTurnStore) key(userID, sessionID string) string {
+	return userID + "\x00" + sessionID
+}
+
+// Append adds the turn and refreshes the conversation's expiry. Starting a
+// conversation sweeps the expired ones, which may never be read again.
+func (m *MemoryTurnStore) Append(ctx context.Context, userID, sessionID string, turn models.ConversationTurn) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	k := m.key(userID, sessionID)
+	conv, ok := m.convs[k]
+	if !ok || now.After(conv.expiresAt) {
+		for key, c := range m.convs {
+			if now.After(c.expiresAt) {
+				delete(m.convs, key)
+			}
+		}
+		conv = &memConversation{}
+		m.convs[k] = conv
+	}
+
+	conv.turns = append(conv.turns, turn)
+	if len(conv.turns) > m.maxTurns {
+		conv.turns = append([]models.ConversationTurn(nil), conv.turns[len(conv.turns)-m.maxTurns:]...)
+	}
+	conv.expiresAt = now.Add(m.ttl)
+	return nil
+}
+
+// Recent returns a copy of the conversation's last n turns.
+func (m *MemoryTurnStore) Recent(ctx context.Context, userID, sessionID string, n int) ([]models.ConversationTurn, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := m.key(userID, sessionID)
+	conv, ok := m.convs[k]
+	if !ok {
+		return nil, nil
+	}
+	if m.now().After(conv.expiresAt) {
+		delete(m.convs, k)
+		return nil, nil
+	}
+
+	turns := conv.turns
+	if n > 0 && n < len(turns) {
+		turns = turns[len(turns)-n:]
+	}
+	return append([]models.ConversationTurn(nil), turns...), nil
+}
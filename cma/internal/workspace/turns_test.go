@@ -0,0 +1,105 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/models"
+)
+
+func turn(content string) models.ConversationTurn {
+	return models.ConversationTurn{Role: "user", Content: content}
+}
+
+func TestMemoryTurnStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTurnStore(configs.WorkspaceConfig{MaxTurns: 3, TurnTTL: time.Hour})
+
+	clock := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return clock }
+
+	for i := 1; i <= 5; i++ {
+		store.Append(ctx, "alice", "s1", turn(fmt.Sprint(i)))
+	}
+	store.Append(ctx, "alice", "s2", turn("other session"))
+
+	contents := func(turns []models.ConversationTurn) string {
+		var out string
+		for _, t := range turns {
+			out += t.Content + ","
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		userID    string
+		sessionID string
+		n         int
+		want      string
+	}{
+		{"capped at max turns", "alice", "s1", 0, "3,4,5,"},
+		{"last n", "alice", "s1", 2, "4,5,"},
+		{"n beyond history", "alice", "s1", 10, "3,4,5,"},
+		{"sessions are separate", "alice", "s2", 0, "other session,"},
+		{"users are separate", "bob", "s1", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.Recent(ctx, tt.userID, tt.sessionID, tt.n)
+			if err != nil {
+				t.Fatalf("Recent: %v", err)
+			}
+			if contents(got) != tt.want {
+				t.Errorf("turns = %q, want %q", contents(got), tt.want)
+			}
+		})
+	}
+
+	// Conversations expire after TTL without new turns.
+	clock = clock.Add(2 * time.Hour)
+	if got, _ := store.Recent(ctx, "alice", "s1", 0); len(got) != 0 {
+		t.Errorf("expired conversation returned %d turns", len(got))
+	}
+
+	// Expired conversations that are never read again are swept when a
+	// new one starts.
+	store.Append(ctx, "bob", "s1", turn("hello"))
+	if len(store.convs) != 1 {
+		t.Errorf("%d conversations kept, want 1", len(store.convs))
+	}
+}
+
+func TestMemoryTurnStoreConcurrentAppend(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTurnStore(configs.WorkspaceConfig{MaxTurns: 1000})
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				store.Append(ctx, "alice", "", turn(fmt.Sprint(w, i)))
+				store.Recent(ctx, "alice", "", 3)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	got, _ := store.Recent(ctx, "alice", "", 0)
+	if len(got) != 400 {
+		t.Errorf("got %d turns, want 400", len(got))
+	}
+}
+
+func TestRedisTurnStoreKeysAreUnambiguous(t *testing.T) {
+	store := NewRedisTurnStore(nil, configs.WorkspaceConfig{})
+	if a, b := store.key("a:b", "c"), store.key("a", "b:c"); a == b {
+		t.Errorf("distinct conversations share the key %q", a)
+	}
+}
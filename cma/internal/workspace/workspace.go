@@ -1,10 +1,11 @@
 package workspace
 
 import (
+	"container/list"
 	"context"
 	"fmt"
 	"log/slog"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/memora/cma/configs"
@@ -13,6 +14,7 @@ import (
 	"github.com/memora/cma/internal/metrics"
 	"github.com/memora/cma/internal/models"
 	"github.com/memora/cma/internal/retrieval"
+	"github.com/memora/cma/internal/tokenizer"
 )
 
 // Workspace implements the Cognitive Workspace (Layer 2 in the CMA paper).
@@ -28,29 +30,46 @@ type Workspace struct {
 	retriever  *retrieval.Service
 	reranker   *dig.Reranker
 	optimizer  *knapsack.Optimizer
+	tokenizer  tokenizer.Tokenizer
 	cfg        configs.KnapsackConfig
 	metrics    *metrics.Metrics
 
-	// Per-user conversation history (phonological loop).
-	// In production, this would be backed by Redis.
-	history    map[string][]models.ConversationTurn
+	// Per-conversation history (phonological loop).
+	turns      TurnStore
+
+	// Last knapsack decision per conversation, for inspection. Kept in
+	// process memory: each replica reports the queries it served, for at
+	// most maxSelections conversations.
+	selMu      sync.RWMutex
+	selections map[string]*list.Element // of *models.WorkspaceSelection
+	selOrder   *list.List               // front: most recently recorded
 }
 
-// NewWorkspace creates a new cognitive workspace.
+// maxSelections bounds the conversations whose last selection is kept;
+// beyond it the least recently queried conversation's is dropped.
+const maxSelections = 1000
+
+// NewWorkspace creates a new cognitive workspace. tok weighs retrieved
+// memories and should be the tokenizer the optimizer was built with.
 func NewWorkspace(
 	retriever *retrieval.Service,
 	reranker *dig.Reranker,
 	optimizer *knapsack.Optimizer,
+	turns TurnStore,
+	tok tokenizer.Tokenizer,
 	cfg configs.KnapsackConfig,
 	m *metrics.Metrics,
 ) *Workspace {
 	return &Workspace{
-		retriever: retriever,
-		reranker:  reranker,
-		optimizer: optimizer,
-		cfg:       cfg,
-		metrics:   m,
-		history:   make(map[string][]models.ConversationTurn),
+		retriever:  retriever,
+		reranker:   reranker,
+		optimizer:  optimizer,
+		tokenizer:  tok,
+		cfg:        cfg,
+		metrics:    m,
+		turns:      turns,
+		selections: make(map[string]*list.Element),
+		selOrder:   list.New(),
 	}
 }
 
@@ -66,18 +85,25 @@ func (w *Workspace) Query(ctx context.Context, req models.QueryRequest) (*models
 
 	slog.Info("workspace query",
 		"user_id", req.UserID,
+		"session_id", req.SessionID,
 		"query", req.Query,
 		"token_budget", tokenBudget,
 	)
 
-	// Step 1: Hybrid retrieval (concurrent vector + graph search).
-	results, err := w.retriever.Retrieve(ctx, req.UserID, req.Query)
+	renderer, err := NewRenderer(req.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 1: Hybrid retrieval (concurrent vector + graph search). Episode
+	// embeddings are only fetched for a solver that reads them.
+	results, err := w.retriever.Retrieve(ctx, req, w.optimizer.UsesEmbeddings())
 	if err != nil {
 		return nil, fmt.Errorf("retrieval: %w", err)
 	}
 
 	// Step 2: DIG reranking — filter distractors, rank by information gain.
-	digCandidates, err := w.reranker.Rerank(ctx, req.Query, results)
+	digCandidates, err := w.reranker.Rerank(ctx, req.UserID, req.Query, results)
 	if err != nil {
 		return nil, fmt.Errorf("dig reranking: %w", err)
 	}
@@ -91,10 +117,10 @@ func (w *Workspace) Query(ctx context.Context, req models.QueryRequest) (*models
 
 	// Step 3: Convert DIG candidates to knapsack items.
 	knapsackItems := make([]models.KnapsackItem, 0, len(digCandidates))
-	digScores := make(map[string]float64)
+	digScores := make(map[string]models.DIGScore)
 
 	for _, dc := range digCandidates {
-		tokenCount := len(dc.Content) / 4 // approximate
+		tokenCount := w.tokenizer.Count(dc.Content)
 		if tokenCount == 0 {
 			tokenCount = 1
 		}
@@ -109,32 +135,64 @@ func (w *Workspace) Query(ctx context.Context, req models.QueryRequest) (*models
 			Content: dc.Content,
 			Value:   dc.DIGScore,
 			Weight:  tokenCount,
+			Section: models.SectionEpisodes,
+		}
+		if dc.Result.Source == "graph" {
+			item.Section = models.SectionFacts
+		}
+		if dc.Result.Episode != nil {
+			item.Embedding = dc.Result.Episode.Embedding
+			item.Timestamp = dc.Result.Episode.Timestamp
 		}
 
 		knapsackItems = append(knapsackItems, item)
 		if id != "" {
-			digScores[id] = dc.DIGScore
+			digScores[id] = models.DIGScore{Score: dc.DIGScore, Scorer: dc.Scorer, Probability: dc.Probability}
 		}
 	}
 
 	// Step 4: Knapsack optimization — pack context window with highest-value items.
-	recentTurns := w.getRecentTurns(req.UserID)
+	var recentTurns []models.ConversationTurn
+	if !req.ExcludeTurns {
+		recentTurns = w.getRecentTurns(ctx, req.UserID, req.SessionID)
+	}
 
-	// Temporarily override the optimizer budget.
-	w.optimizer.SetTokenBudget(tokenBudget)
-	selection := w.optimizer.Optimize(knapsackItems, recentTurns)
+	// The assembled query and system prompt share the window with the items.
+	queryTokens := w.tokenizer.Count(req.Query)
+	selection := w.optimizer.Optimize(knapsackItems, recentTurns, knapsack.Options{
+		TokenBudget:      tokenBudget,
+		ForceRecentTurns: w.cfg.ForceRecentTurns,
+		ReservedTokens:   w.cfg.ReservedTokens + queryTokens,
+		SectionCaps:      w.cfg.SectionCaps,
+		SectionShares:    w.cfg.Sections,
+		Pinned:           w.profileItems(req.Profile),
+	})
+
+	// Step 5: Render the context in the requested format.
+	rendered, tokensUsed, err := w.render(renderer, &selection, req.Query, tokenBudget)
+	if err != nil {
+		return nil, err
+	}
+	sections := selection.Sections
+	sections[models.SectionQuery] = models.SectionUsage{Budget: queryTokens, Used: queryTokens}
 
 	// Record knapsack metrics.
 	w.metrics.KnapsackUtilization.Observe(selection.Utilization)
 	w.metrics.KnapsackItemsSelected.Observe(float64(len(selection.Selected)))
 
-	// Step 5: Assemble context string.
-	contextStr := w.assembleContext(selection.Selected, req.Query)
+	w.recordSelection(req, selection, tokenBudget)
 
 	// Build sources list.
 	sources := make([]models.RetrievalResult, 0, len(digCandidates))
 	for _, dc := range digCandidates {
-		sources = append(sources, dc.Result)
+		src := dc.Result
+		if src.Episode != nil && src.Episode.Embedding != nil {
+			// Vectors were fetched for packing; keep them out of the response.
+			ep := *src.Episode
+			ep.Embedding = nil
+			src.Episode = &ep
+		}
+		sources = append(sources, src)
 	}
 
 	slog.Info("workspace query completed",
@@ -142,79 +200,178 @@ func (w *Workspace) Query(ctx context.Context, req models.QueryRequest) (*models
 		"candidates", len(results),
 		"after_dig", len(digCandidates),
 		"selected", len(selection.Selected),
-		"tokens_used", selection.TotalTokens,
+		"tokens_used", tokensUsed,
 		"utilization", selection.Utilization,
 		"latency_ms", time.Since(start).Milliseconds(),
 	)
 
 	return &models.QueryResponse{
-		Context:     contextStr,
+		Context:     rendered.Text,
 		Sources:     sources,
-		TokensUsed:  selection.TotalTokens,
+		TokensUsed:  tokensUsed,
 		TokenBudget: tokenBudget,
 		DIGScores:   digScores,
+		Sections:    sections,
+		Format:      formatName(req.Format),
+		Messages:    rendered.Messages,
+		MemoryIDs:   memoryIDs(selection.Selected),
 	}, nil
 }
 
-// AddTurn appends a conversation turn to the user's phonological loop.
-func (w *Workspace) AddTurn(userID string, role string, content string) {
+// AddTurn appends a conversation turn to the session's phonological loop.
+// The empty session is the user's default conversation.
+func (w *Workspace) AddTurn(ctx context.Context, userID, sessionID string, role string, content string) error {
 	turn := models.ConversationTurn{
 		Role:      role,
 		Content:   content,
 		Timestamp: time.Now().UTC(),
 	}
-	w.history[userID] = append(w.history[userID], turn)
+	if err := w.turns.Append(ctx, userID, sessionID, turn); err != nil {
+		return fmt.Errorf("add turn: %w", err)
+	}
+	return nil
+}
+
+// getRecentTurns returns the session turns the optimizer force-includes. A
+// turn store failure degrades to no recent turns rather than failing the query.
+func (w *Workspace) getRecentTurns(ctx context.Context, userID, sessionID string) []models.ConversationTurn {
+	turns, err := w.turns.Recent(ctx, userID, sessionID, w.cfg.ForceRecentTurns)
+	if err != nil {
+		slog.Warn("recent turns unavailable", "user_id", userID, "session_id", sessionID, "error", err)
+		return nil
+	}
+	return turns
+}
 
-	// Keep only the last 100 turns to bound memory.
-	if len(w.history[userID]) > 100 {
-		w.history[userID] = w.history[userID][len(w.history[userID])-100:]
+// profileItems turns the request's profile notes into pinned items.
+func (w *Workspace) profileItems(profile []string) []models.KnapsackItem {
+	items := make([]models.KnapsackItem, 0, len(profile))
+	for i, note := range profile {
+		tokenCount := w.tokenizer.Count(note)
+		if tokenCount == 0 {
+			continue
+		}
+		items = append(items, models.KnapsackItem{
+			ID:      fmt.Sprintf("profile_%d", i+1),
+			Content: note,
+			Value:   1000.0, // pinned like recent turns
+			Weight:  tokenCount,
+			Density: 1000.0 / float64(tokenCount),
+			Section: models.SectionProfile,
+		})
 	}
+	return items
 }
 
-// getRecentTurns returns the conversation history for a user.
-func (w *Workspace) getRecentTurns(userID string) []models.ConversationTurn {
-	turns, ok := w.history[userID]
+// LastSelection returns the knapsack decision of the conversation's most
+// recent query on this replica, or nil if it has not been queried or was
+// evicted by queries of maxSelections other conversations since.
+func (w *Workspace) LastSelection(userID, sessionID string) *models.WorkspaceSelection {
+	w.selMu.RLock()
+	defer w.selMu.RUnlock()
+	el, ok := w.selections[selectionKey(userID, sessionID)]
 	if !ok {
 		return nil
 	}
-	return turns
+	return el.Value.(*models.WorkspaceSelection)
 }
 
-// assembleContext builds the final context string from selected knapsack items.
-func (w *Workspace) assembleContext(items []models.KnapsackItem, query string) string {
-	var sb strings.Builder
+// recordSelection stores the query's selection as the conversation's last.
+func (w *Workspace) recordSelection(req models.QueryRequest, selection knapsack.SelectionResult, tokenBudget int) {
+	items := make([]models.WorkspaceItem, 0, len(selection.Selected)+len(selection.Rejected))
+	for _, item := range selection.Selected {
+		items = append(items, models.WorkspaceItem{KnapsackItem: item, Status: models.ItemKept})
+	}
+	for _, item := range selection.Rejected {
+		items = append(items, models.WorkspaceItem{KnapsackItem: item, Status: models.ItemRejected})
+	}
+
+	rec := &models.WorkspaceSelection{
+		UserID:        req.UserID,
+		SessionID:     req.SessionID,
+		Query:         req.Query,
+		Items:         items,
+		Lambda:        selection.Lambda,
+		TotalTokens:   selection.TotalTokens,
+		TokenBudget:   tokenBudget,
+		Utilization:   selection.Utilization,
+		Solver:        selection.Solver,
+		OptimalityGap: selection.OptimalityGap,
+		Timestamp:     time.Now().UTC(),
+	}
 
-	// Recent conversation turns (force-included items).
-	turnItems := make([]models.KnapsackItem, 0)
-	memoryItems := make([]models.KnapsackItem, 0)
+	key := selectionKey(req.UserID, req.SessionID)
+	w.selMu.Lock()
+	defer w.selMu.Unlock()
 
-	for _, item := range items {
-		if item.ForceInclude {
-			turnItems = append(turnItems, item)
-		} else {
-			memoryItems = append(memoryItems, item)
-		}
+	if el, ok := w.selections[key]; ok {
+		el.Value = rec
+		w.selOrder.MoveToFront(el)
+		return
+	}
+	w.selections[key] = w.selOrder.PushFront(rec)
+	if w.selOrder.Len() > maxSelections {
+		oldest := w.selOrder.Back()
+		w.selOrder.Remove(oldest)
+		old := oldest.Value.(*models.WorkspaceSelection)
+		delete(w.selections, selectionKey(old.UserID, old.SessionID))
 	}
+}
 
-	if len(turnItems) > 0 {
-		sb.WriteString("## Recent Conversation\n")
-		for _, item := range turnItems {
-			sb.WriteString(item.Content)
-			sb.WriteString("\n")
+// render formats the selection and returns it with its token count.
+// Headings and markup are not packed by the optimizer, so while the
+// rendered context exceeds the budget less the tokens reserved for the
+// system prompt, the least dense retrieved memory is moved to the rejected
+// items and the context rendered again.
+func (w *Workspace) render(r Renderer, selection *knapsack.SelectionResult, query string, tokenBudget int) (Rendered, int, error) {
+	limit := tokenBudget - w.cfg.ReservedTokens
+	for {
+		rendered, err := r.Render(newLayout(selection.Selected, query))
+		if err != nil {
+			return Rendered{}, 0, fmt.Errorf("render context: %w", err)
 		}
-		sb.WriteString("\n")
-	}
+		tokens := w.tokenizer.Count(rendered.Text)
 
-	if len(memoryItems) > 0 {
-		sb.WriteString("## Retrieved Memories\n")
-		for i, item := range memoryItems {
-			sb.WriteString(fmt.Sprintf("[Memory %d] %s\n", i+1, item.Content))
+		drop := -1
+		for i, item := range selection.Selected {
+			if !item.ForceInclude && (drop < 0 || item.Density < selection.Selected[drop].Density) {
+				drop = i
+			}
+		}
+		if tokens <= limit || drop < 0 {
+			return rendered, tokens, nil
 		}
-		sb.WriteString("\n")
+
+		item := selection.Selected[drop]
+		selection.Selected = append(selection.Selected[:drop:drop], selection.Selected[drop+1:]...)
+		selection.Rejected = append(selection.Rejected, item)
+		selection.TotalTokens -= item.Weight
+		selection.TotalValue -= item.Value
+		usage := selection.Sections[item.Section]
+		usage.Used -= item.Weight
+		selection.Sections[item.Section] = usage
+	}
+}
+
+// memoryIDs returns the IDs of the selection's memories in the order the
+// renderers number them.
+func memoryIDs(selected []models.KnapsackItem) []string {
+	memories := newLayout(selected, "").Memories
+	ids := make([]string, len(memories))
+	for i, item := range memories {
+		ids[i] = item.ID
 	}
+	return ids
+}
 
-	sb.WriteString("## Current Query\n")
-	sb.WriteString(query)
+// formatName returns the format a request's context is rendered in.
+func formatName(format string) string {
+	if format == "" {
+		return models.FormatMarkdown
+	}
+	return format
+}
 
-	return sb.String()
+func selectionKey(userID, sessionID string) string {
+	return userID + "\x00" + sessionID
 }
@@ -0,0 +1,37 @@
+package workspace
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/memora/cma/configs"
+	"github.com/memora/cma/internal/knapsack"
+	"github.com/memora/cma/internal/models"
+)
+
+func TestLastSelectionEvictsLeastRecentlyQueried(t *testing.T) {
+	w := NewWorkspace(nil, nil, nil, nil, nil, configs.KnapsackConfig{}, nil)
+	record := func(userID, query string) {
+		w.recordSelection(models.QueryRequest{UserID: userID, Query: query}, knapsack.SelectionResult{}, 100)
+	}
+
+	for i := 0; i < maxSelections; i++ {
+		record(fmt.Sprint("user-", i), "first")
+	}
+	// Querying user-0 again makes user-1 the least recently queried.
+	record("user-0", "second")
+	record("newcomer", "first")
+
+	if got := w.LastSelection("user-0", ""); got == nil || got.Query != "second" {
+		t.Errorf("user-0 selection = %+v, want the second query", got)
+	}
+	if w.LastSelection("user-1", "") != nil {
+		t.Error("least recently queried selection was kept")
+	}
+	if w.LastSelection("newcomer", "") == nil {
+		t.Error("newest selection was dropped")
+	}
+	if len(w.selections) != maxSelections || w.selOrder.Len() != maxSelections {
+		t.Errorf("kept %d selections, want %d", len(w.selections), maxSelections)
+	}
+}
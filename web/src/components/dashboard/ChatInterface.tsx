@@ -39,22 +39,19 @@ export default function ChatInterface() {
         setInput("");
         setIsLoading(true);
 
+        const botId = (Date.now() + 1).toString();
         try {
-            // 1. Ingest User Message
-            await cmaApi.ingest(userId, userMsg.content, "user");
+            // The backend remembers both messages and answers from memory.
+            const response = await cmaApi.chat({ user_id: userId, message: userMsg.content }, (delta) => {
+                setIsLoading(false);
+                setMessages(prev => prev.some(m => m.id === botId)
+                    ? prev.map(m => m.id === botId ? { ...m, content: m.content + delta } : m)
+                    : [...prev, { id: botId, role: "assistant", content: delta }]);
+            });
 
-            // 2. Query for response
-            const response = await cmaApi.query(userId, userMsg.content);
-
-            // 3. Ingest Assistant Response (to maintain history in backend)
-            await cmaApi.ingest(userId, response.context, "assistant");
-
-            const botMsg: Message = {
-                id: (Date.now() + 1).toString(),
-                role: "assistant",
-                content: response.context,
-            };
-            setMessages(prev => [...prev, botMsg]);
+            setMessages(prev => prev.some(m => m.id === botId)
+                ? prev.map(m => m.id === botId ? { ...m, content: response.answer } : m)
+                : [...prev, { id: botId, role: "assistant", content: response.answer }]);
 
         } catch (error) {
             console.error("Chat error:", error);
@@ -30,6 +30,7 @@ export default function WorkspaceView() {
     const items = data?.items || [];
     const totalTokens = data?.total_tokens || 0;
     const tokenBudget = data?.token_budget || 4096;
+    const lambda = data?.lambda || 0;
     const usagePercent = Math.min((totalTokens / tokenBudget) * 100, 100);
 
     return (
@@ -67,7 +68,7 @@ export default function WorkspaceView() {
             <div className="bg-white rounded-2xl border border-terracotta/20 shadow-sm overflow-hidden">
                 <div className="p-4 border-b border-terracotta/20 flex justify-between items-center bg-cream/50">
                     <h3 className="font-semibold text-terracotta text-sm">Candidate Memories</h3>
-                    <span className="text-[10px] font-mono text-charcoal/60">Sort: Density (DIG/Weight)</span>
+                    <span className="text-[10px] font-mono text-charcoal/60">Sort: Density (DIG/Weight) · λ = {lambda.toFixed(4)}</span>
                 </div>
                 <div className="divide-y divide-terracotta/10 max-h-[400px] overflow-y-auto custom-scrollbar">
                     {items.map((item: any) => (
@@ -99,6 +100,9 @@ export default function WorkspaceView() {
                                         )}>
                                             DIG: {item.value}
                                         </span>
+                                        <span className="text-[10px] font-mono text-charcoal/60">
+                                            ρ: {(item.density ?? 0).toFixed(4)}
+                                        </span>
                                     </div>
                                 </div>
                             </div>
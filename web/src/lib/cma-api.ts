@@ -14,6 +14,9 @@ export interface QueryRequest {
     user_id: string;
     query: string;
     token_budget?: number;
+    profile?: string[];
+    format?: "markdown" | "xml" | "json" | "messages";
+    exclude_turns?: boolean;
 }
 
 export interface RetrievalResult {
@@ -23,12 +26,51 @@ export interface RetrievalResult {
     source: string;
 }
 
+export interface DIGScore {
+    score: number;
+    scorer: string; // "llm", "listwise", "cross_encoder" or "heuristic"
+    probability?: number; // calibrated P(helpful), once the tenant is calibrated
+}
+
 export interface QueryResponse {
     context: string;
     sources: RetrievalResult[];
     tokens_used: number;
     token_budget: number;
-    dig_scores?: Record<string, number>;
+    dig_scores?: Record<string, DIGScore>;
+    sections?: Record<string, SectionUsage>;
+    format: string;
+    messages?: ChatMessage[];
+}
+
+export interface ChatMessage {
+    role: "system" | "user" | "assistant";
+    content: string;
+}
+
+export interface ChatRequest {
+    user_id: string;
+    session_id?: string;
+    message: string;
+    token_budget?: number;
+    profile?: string[];
+}
+
+export interface Citation {
+    memory: number; // the [Memory N] marker
+    episode_id: string;
+}
+
+export interface ChatResponse {
+    answer: string;
+    citations: Citation[];
+    sources: RetrievalResult[];
+    tokens_used: number;
+}
+
+export interface SectionUsage {
+    budget?: number;
+    used: number;
 }
 
 export interface HealthResponse {
@@ -61,6 +103,43 @@ export const cmaApi = {
         return res.json();
     },
 
+    // chat streams the answer to onDelta as server-sent events and resolves
+    // with the final response.
+    async chat(req: ChatRequest, onDelta?: (delta: string) => void): Promise<ChatResponse> {
+        const res = await fetch(`${API_BASE}/chat`, {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify(req),
+        });
+        if (!res.ok || !res.body) throw new Error(`Chat failed: ${res.statusText}`);
+
+        const reader = res.body.getReader();
+        const decoder = new TextDecoder();
+        let buffer = "";
+        for (;;) {
+            const { done, value } = await reader.read();
+            if (done) break;
+            buffer += decoder.decode(value, { stream: true });
+
+            let end;
+            while ((end = buffer.indexOf("\n\n")) >= 0) {
+                const block = buffer.slice(0, end);
+                buffer = buffer.slice(end + 2);
+                let event = "message";
+                let data = "";
+                for (const line of block.split("\n")) {
+                    if (line.startsWith("event:")) event = line.slice(6).trim();
+                    else if (line.startsWith("data:")) data += line.slice(5);
+                }
+                const payload = JSON.parse(data);
+                if (event === "delta") onDelta?.(payload.content);
+                else if (event === "done") return payload;
+                else if (event === "error") throw new Error(`Chat failed: ${payload.error}`);
+            }
+        }
+        throw new Error("Chat failed: stream ended without an answer");
+    },
+
     async health(): Promise<HealthResponse> {
         const res = await fetch(`http://localhost:8080/health`);
         if (!res.ok) throw new Error(`Health check failed: ${res.statusText}`);